@@ -1,6 +1,12 @@
 package common
 
-import "os"
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Config struct {
 	ListenAddr    string
@@ -8,8 +14,14 @@ type Config struct {
 	Env           string
 	SamplesDir    string
 	Currency      string
-	TaxRatePct    int
+	TaxRatePct    *float64 // nil leaves the tax table's standard rate
 	TaxInclusive  bool
+	MaxBaskets    int
+	TaxTable      string
+	ParkTTL       time.Duration
+	// GiftCardMonths is how long a gift card stays valid after it was last
+	// loaded; 0 means cards never expire.
+	GiftCardMonths int
 }
 
 func ConfigFromEnv() Config {
@@ -30,11 +42,33 @@ func ConfigFromEnv() Config {
 	if curr == "" {
 		curr = "GBP"
 	}
-	rate := 20
-	if v := os.Getenv("UT_TAX_RATE"); v != "" {
-		// simple atoi without import strconv here; keep default if invalid
-		_ = v
-	}
+	rate := ParseTaxRate(os.Getenv("UT_TAX_RATE"))
 	incl := os.Getenv("UT_TAX_INCLUSIVE") == "true"
-	return Config{ListenAddr: addr, DefaultLocale: locale, Env: env, SamplesDir: samples, Currency: curr, TaxRatePct: rate, TaxInclusive: incl}
+	maxBaskets := 0
+	if v, err := strconv.Atoi(os.Getenv("UT_MAX_BASKETS")); err == nil && v > 0 {
+		maxBaskets = v
+	}
+	table := os.Getenv("UT_TAX_TABLE")
+	if table == "" {
+		table = "web/tax/rates.json"
+	}
+	var parkTTL time.Duration
+	if v, err := time.ParseDuration(os.Getenv("UT_PARK_TTL")); err == nil && v > 0 {
+		parkTTL = v
+	}
+	giftCardMonths := 24
+	if v, err := strconv.Atoi(os.Getenv("UT_GIFTCARD_MONTHS")); err == nil && v >= 0 {
+		giftCardMonths = v
+	}
+	return Config{ListenAddr: addr, DefaultLocale: locale, Env: env, SamplesDir: samples, Currency: curr, TaxRatePct: rate, TaxInclusive: incl, MaxBaskets: maxBaskets, TaxTable: table, ParkTTL: parkTTL, GiftCardMonths: giftCardMonths}
+}
+
+// ParseTaxRate reads a percentage such as "17.5". Blank, negative or
+// unreadable rates give nil, so the tax table's rate applies; "0" is a rate.
+func ParseTaxRate(v string) *float64 {
+	r, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || r < 0 || math.IsNaN(r) || math.IsInf(r, 0) {
+		return nil
+	}
+	return &r
 }
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Column is a column added to a table after it first shipped.
+type Column struct{ Table, Name, Def string }
+
+// AddColumns adds any of cols missing from their tables so older databases
+// pick up new fields without a migration step.
+func AddColumns(db *sql.DB, cols []Column) error {
+	have := map[string]bool{}
+	for _, c := range cols {
+		if !have[c.Table] {
+			rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, c.Table)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					rows.Close()
+					return err
+				}
+				have[c.Table+"."+name] = true
+			}
+			rows.Close()
+			have[c.Table] = true
+		}
+		if have[c.Table+"."+c.Name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.Table, c.Name, c.Def)); err != nil {
+			return err
+		}
+		have[c.Table+"."+c.Name] = true
+	}
+	return nil
+}
+
+// RetypeColumn declares an existing column as typ. SQLite can't change a
+// column's type in place, so the table is copied into one declared the new
+// way, its indexes rebuilt, and the copy takes the table's name.
+func RetypeColumn(db *sql.DB, table, column, typ string) error {
+	var cur string
+	if err := db.QueryRow(`SELECT type FROM pragma_table_info(?) WHERE name=?`, table, column).Scan(&cur); err != nil {
+		return fmt.Errorf("%s.%s: %w", table, column, err)
+	}
+	if strings.EqualFold(cur, typ) {
+		return nil
+	}
+	var ddl string
+	if err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type='table' AND name=?`, table).Scan(&ddl); err != nil {
+		return err
+	}
+	decl := regexp.MustCompile(`(?i)\b(` + regexp.QuoteMeta(column) + `\s+)` + regexp.QuoteMeta(cur) + `\b`)
+	if !decl.MatchString(ddl) {
+		return fmt.Errorf("%s.%s: can't find its declaration", table, column)
+	}
+	tmp := table + "_retype"
+	ddl = strings.Replace(decl.ReplaceAllString(ddl, "${1}"+typ), table, tmp, 1)
+	rows, err := db.Query(`SELECT sql FROM sqlite_master WHERE type='index' AND tbl_name=? AND sql IS NOT NULL`, table)
+	if err != nil {
+		return err
+	}
+	var indexes []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, s)
+	}
+	rows.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmts := append([]string{ddl,
+		fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s`, tmp, table),
+		fmt.Sprintf(`DROP TABLE %s`, table),
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, tmp, table),
+	}, indexes...)
+	for _, s := range stmts {
+		if _, err := tx.Exec(s); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
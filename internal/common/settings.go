@@ -23,16 +23,120 @@ type PluginRecord struct {
 	Path  string `json:"path"`
 }
 
+// BarcodeRule describes a variable-measure barcode whose digits carry an
+// item reference and a weight or price, e.g. EAN-13 labels starting 2x.
+// Positions count from 0 across the whole barcode.
+type BarcodeRule struct {
+	Prefix     string `json:"prefix"`
+	Length     int    `json:"length"` // digits including the check digit
+	ItemStart  int    `json:"itemStart"`
+	ItemLen    int    `json:"itemLen"`
+	ValueStart int    `json:"valueStart"`
+	ValueLen   int    `json:"valueLen"`
+	Decimals   int    `json:"decimals"` // implied decimals: 3 for kg to the gram, 2 for price in units
+	Kind       string `json:"kind"`     // "weight" or "price"
+}
+
+// HospitalityRules hold the default service charge offered on a basket
+// and the tip percentages suggested on card payments.
+type HospitalityRules struct {
+	ServiceChargePct float64   `json:"serviceChargePct"`
+	TipPercents      []float64 `json:"tipPercents,omitempty"`
+}
+
+// LoyaltyRules set how customers earn and spend points. Category and
+// promotion multipliers scale the earn rate per line, the customer's tier
+// scales the whole sale.
+type LoyaltyRules struct {
+	Enabled         bool               `json:"enabled"`
+	PointsPerUnit   int                `json:"pointsPerUnit"`   // earned per whole currency unit spent
+	PointValueCents int64              `json:"pointValueCents"` // what one point pays for
+	Categories      map[string]float64 `json:"categories,omitempty"`
+	Promotions      map[string]float64 `json:"promotions,omitempty"` // keyed by promotion ID
+	Tiers           []LoyaltyTier      `json:"tiers,omitempty"`
+}
+
+// LoyaltyTier is reached by earning MinPoints over the customer's lifetime.
+type LoyaltyTier struct {
+	Name       string  `json:"name"`
+	MinPoints  int64   `json:"minPoints"`
+	Multiplier float64 `json:"multiplier"`
+}
+
 type Settings struct {
 	Theme            string                  `json:"theme"`
 	Currency         string                  `json:"currency"`
 	Country          string                  `json:"country"`
 	Region           string                  `json:"region"`
 	TaxInclusive     bool                    `json:"taxInclusive"`
-	TaxRatePct       int                     `json:"taxRatePct"`
+	TaxRatePct       *float64                `json:"taxRatePct,omitempty"` // nil uses the tax table
 	InstalledPlugins map[string]bool         `json:"installedPlugins,omitempty"`
 	MenuPlugins      map[string]MenuPlugin   `json:"menuPlugins,omitempty"`
 	PluginRecords    map[string]PluginRecord `json:"pluginRecords,omitempty"`
+	BarcodeRules     []BarcodeRule           `json:"barcodeRules,omitempty"`
+	// Denominations are the notes and coins (in cents) counted at close,
+	// keyed by currency code
+	Denominations map[string][]int64 `json:"denominations,omitempty"`
+	BlindClose    bool               `json:"blindClose"` // hide expected takings until counted
+	// CashRounding is the step (in cents) cash balances are rounded to,
+	// keyed by currency code; currencies not listed aren't rounded
+	CashRounding map[string]int64 `json:"cashRounding,omitempty"`
+	Loyalty      LoyaltyRules     `json:"loyalty"`
+	Hospitality  HospitalityRules `json:"hospitality"`
+	// TillCatalogAdd lets cashiers add an unknown barcode to the catalog
+	// from the till
+	TillCatalogAdd bool `json:"tillCatalogAdd"`
+}
+
+// CashDenominations returns the denominations for the configured currency,
+// largest first, or nil when none are configured.
+func (s Settings) CashDenominations() []int64 {
+	return s.Denominations[strings.ToUpper(strings.TrimSpace(s.Currency))]
+}
+
+// CashRoundingStep returns the cash rounding step for the configured
+// currency, or 0 when cash is paid to the cent.
+func (s Settings) CashRoundingStep() int64 {
+	return s.CashRounding[strings.ToUpper(strings.TrimSpace(s.Currency))]
+}
+
+// envDefaults are what InitSettingsDefaults took from the environment.
+var envDefaults = struct {
+	Currency     string
+	TaxRatePct   *float64
+	TaxInclusive bool
+}{Currency: "GBP"}
+
+// defaultSettings returns what fills in anything not yet saved (see
+// InitSettingsDefaults). Every call builds its own maps and slices, so
+// callers may change them.
+func defaultSettings() Settings {
+	return Settings{Theme: "default", Currency: envDefaults.Currency, Country: "GB", Region: "",
+		TaxRatePct: envDefaults.TaxRatePct, TaxInclusive: envDefaults.TaxInclusive,
+		BarcodeRules: []BarcodeRule{
+			{Prefix: "21", Length: 13, ItemStart: 2, ItemLen: 5, ValueStart: 7, ValueLen: 5, Decimals: 3, Kind: "weight"},
+			{Prefix: "22", Length: 13, ItemStart: 2, ItemLen: 5, ValueStart: 7, ValueLen: 5, Decimals: 2, Kind: "price"},
+		},
+		Denominations: map[string][]int64{
+			"GBP": {5000, 2000, 1000, 500, 200, 100, 50, 20, 10, 5, 2, 1},
+			"EUR": {50000, 20000, 10000, 5000, 2000, 1000, 500, 200, 100, 50, 20, 10, 5, 2, 1},
+			"USD": {10000, 5000, 2000, 1000, 500, 200, 100, 25, 10, 5, 1},
+		},
+		CashRounding: map[string]int64{"CHF": 5, "DKK": 50, "SEK": 100, "NOK": 100, "AUD": 5, "NZD": 10, "CAD": 5},
+		Hospitality:  HospitalityRules{ServiceChargePct: 12.5, TipPercents: []float64{10, 12.5, 15}},
+		Loyalty: LoyaltyRules{PointsPerUnit: 1, PointValueCents: 1, Tiers: []LoyaltyTier{
+			{Name: "Silver", MinPoints: 500, Multiplier: 1.25},
+			{Name: "Gold", MinPoints: 2000, Multiplier: 1.5},
+		}},
+	}
+}
+
+// InitSettingsDefaults seeds unsaved settings from the environment so
+// UT_CURRENCY, UT_TAX_RATE and UT_TAX_INCLUSIVE apply until changed in the UI.
+func InitSettingsDefaults(cfg Config) {
+	envDefaults.Currency = cfg.Currency
+	envDefaults.TaxRatePct = cfg.TaxRatePct
+	envDefaults.TaxInclusive = cfg.TaxInclusive
 }
 
 type SettingsStore interface {
@@ -121,13 +225,13 @@ func (s *fileSettings) SetTheme(theme string) error {
 func (s *fileSettings) GetAll() Settings {
 	b, err := os.ReadFile(s.path)
 	if err != nil {
-		return Settings{Theme: "default", Currency: "GBP", Country: "GB", Region: "", TaxRatePct: 20}
+		return defaultSettings()
 	}
 	var out Settings
 	if json.Unmarshal(b, &out) == nil {
 		return out
 	}
-	return Settings{Theme: "default", Currency: "GBP", Country: "GB", Region: "", TaxRatePct: 20}
+	return defaultSettings()
 }
 
 func (s *fileSettings) SetAll(in Settings) error {
@@ -143,7 +247,7 @@ func (s *fileSettings) SetAll(in Settings) error {
 }
 
 func mapToSettings(m map[string]string) Settings {
-	out := Settings{Theme: "default", Currency: "GBP", Country: "GB", Region: "", TaxRatePct: 20}
+	out := defaultSettings()
 	if v := m["theme"]; v != "" {
 		out.Theme = v
 	}
@@ -156,13 +260,16 @@ func mapToSettings(m map[string]string) Settings {
 	if v := m["region"]; v != "" {
 		out.Region = v
 	}
-	if v := m["taxInclusive"]; strings.ToLower(v) == "true" {
-		out.TaxInclusive = true
+	if v, ok := m["taxInclusive"]; ok {
+		out.TaxInclusive = strings.ToLower(v) == "true"
 	}
-	if v := m["taxRatePct"]; v != "" {
-		if n, _ := strconv.Atoi(v); n >= 0 {
-			out.TaxRatePct = n
-		}
+	// taxRate is blank for the table's rate; files saved before it kept a
+	// whole percent in taxRatePct, where 0 meant the table
+	if v, ok := m["taxRate"]; ok {
+		out.TaxRatePct = ParseTaxRate(v)
+	} else if n, _ := strconv.Atoi(m["taxRatePct"]); n > 0 {
+		r := float64(n)
+		out.TaxRatePct = &r
 	}
 	if v := m["installedPlugins"]; v != "" {
 		var mp map[string]bool
@@ -182,6 +289,42 @@ func mapToSettings(m map[string]string) Settings {
 			out.PluginRecords = mp
 		}
 	}
+	if v := m["barcodeRules"]; v != "" {
+		var rules []BarcodeRule
+		if json.Unmarshal([]byte(v), &rules) == nil {
+			out.BarcodeRules = rules
+		}
+	}
+	if v := m["denominations"]; v != "" {
+		var d map[string][]int64
+		if json.Unmarshal([]byte(v), &d) == nil {
+			out.Denominations = d
+		}
+	}
+	if v := m["cashRounding"]; v != "" {
+		var r map[string]int64
+		if json.Unmarshal([]byte(v), &r) == nil {
+			out.CashRounding = r
+		}
+	}
+	if v, ok := m["blindClose"]; ok {
+		out.BlindClose = v == "true"
+	}
+	if v, ok := m["tillCatalogAdd"]; ok {
+		out.TillCatalogAdd = v == "true"
+	}
+	if v := m["hospitality"]; v != "" {
+		var h HospitalityRules
+		if json.Unmarshal([]byte(v), &h) == nil {
+			out.Hospitality = h
+		}
+	}
+	if v := m["loyalty"]; v != "" {
+		var l LoyaltyRules
+		if json.Unmarshal([]byte(v), &l) == nil {
+			out.Loyalty = l
+		}
+	}
 	return out
 }
 
@@ -204,13 +347,44 @@ func settingsToMap(s Settings) map[string]string {
 			recs = string(b)
 		}
 	}
+	taxRate := ""
+	if s.TaxRatePct != nil {
+		taxRate = strconv.FormatFloat(*s.TaxRatePct, 'f', -1, 64)
+	}
+	rules := ""
+	if s.BarcodeRules != nil {
+		if b, err := json.Marshal(s.BarcodeRules); err == nil {
+			rules = string(b)
+		}
+	}
+	denoms := ""
+	if s.Denominations != nil {
+		if b, err := json.Marshal(s.Denominations); err == nil {
+			denoms = string(b)
+		}
+	}
+	rounding := ""
+	if s.CashRounding != nil {
+		if b, err := json.Marshal(s.CashRounding); err == nil {
+			rounding = string(b)
+		}
+	}
+	loyalty, _ := json.Marshal(s.Loyalty)
+	hospitality, _ := json.Marshal(s.Hospitality)
 	return map[string]string{
+		"hospitality":      string(hospitality),
+		"cashRounding":     rounding,
+		"loyalty":          string(loyalty),
+		"barcodeRules":     rules,
+		"denominations":    denoms,
+		"blindClose":       map[bool]string{true: "true", false: "false"}[s.BlindClose],
+		"tillCatalogAdd":   map[bool]string{true: "true", false: "false"}[s.TillCatalogAdd],
 		"theme":            s.Theme,
 		"currency":         s.Currency,
 		"country":          s.Country,
 		"region":           s.Region,
 		"taxInclusive":     map[bool]string{true: "true", false: "false"}[s.TaxInclusive],
-		"taxRatePct":       strconv.Itoa(s.TaxRatePct),
+		"taxRate":          taxRate,
 		"installedPlugins": inst,
 		"menuPlugins":      menus,
 		"pluginRecords":    recs,
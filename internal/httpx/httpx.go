@@ -1,6 +1,8 @@
 package httpx
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -13,6 +15,7 @@ import (
 
 var baseFuncs = template.FuncMap{
 	"div100": func(cents int64) float64 { return float64(cents) / 100.0 },
+	"add":    func(a, b int) int { return a + b },
 }
 
 var (
@@ -23,6 +26,7 @@ var (
 
 func InitCurrency(code string) { currencyCode.Store(code) }
 
+// money formats cents in the configured currency.
 func money(amountCents int64) string {
 	code := "GBP"
 	if v := currencyCode.Load(); v != nil {
@@ -30,11 +34,24 @@ func money(amountCents int64) string {
 			code = s
 		}
 	}
+	return moneyIn(code, amountCents)
+}
+
+// moneyIn formats cents in the given currency, so foreign tenders can be
+// shown next to base amounts; a blank code falls back to money.
+func moneyIn(code string, amountCents int64) string {
+	if code == "" {
+		return money(amountCents)
+	}
 	symbol := map[string]string{"GBP": "£", "USD": "$", "EUR": "€"}[code]
 	if symbol == "" {
 		symbol = code + " "
 	}
-	return fmt.Sprintf("%s%.2f", symbol, float64(amountCents)/100.0)
+	sign := ""
+	if amountCents < 0 {
+		sign, amountCents = "-", -amountCents
+	}
+	return fmt.Sprintf("%s%s%.2f", sign, symbol, float64(amountCents)/100.0)
 }
 
 func toJSON(v any) template.JS {
@@ -74,6 +91,57 @@ func ResolveLocale(w http.ResponseWriter, r *http.Request) string {
 	return "en"
 }
 
+// ResolveTerminal identifies the till making the request: the X-Terminal-ID
+// header for fixed terminals, then the ut_terminal cookie, else a new
+// session ID which is stored in a browser-session cookie.
+func ResolveTerminal(w http.ResponseWriter, r *http.Request) string {
+	id, _ := resolveTerminal(w, r)
+	return id
+}
+
+// KnownTerminal is ResolveTerminal for requests that open a basket: it
+// returns "" when the ID was only just issued, so a client that drops the
+// cookie can't open a new basket with every request.
+func KnownTerminal(w http.ResponseWriter, r *http.Request) string {
+	if id, known := resolveTerminal(w, r); known {
+		return id
+	}
+	return ""
+}
+
+// resolveTerminal also reports whether the client sent the ID.
+func resolveTerminal(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if id := r.Header.Get("X-Terminal-ID"); validTerminalID(id) {
+		return id, true
+	}
+	if c, err := r.Cookie("ut_terminal"); err == nil && validTerminalID(c.Value) {
+		return c.Value, true
+	}
+	buf := make([]byte, 6)
+	_, _ = rand.Read(buf)
+	id := "S" + hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "ut_terminal",
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+	})
+	return id, false
+}
+
+// validTerminalID keeps IDs short and safe to embed in receipt numbers.
+func validTerminalID(id string) bool {
+	if id == "" || len(id) > 32 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
 // FuncsFor builds template funcs for a specific request/locale.
 func FuncsFor(locale string) template.FuncMap {
 	funcs := template.FuncMap{}
@@ -81,6 +149,7 @@ func FuncsFor(locale string) template.FuncMap {
 		funcs[k] = v
 	}
 	funcs["money"] = money
+	funcs["moneyIn"] = moneyIn
 	funcs["toJson"] = toJSON
 	funcs["T"] = func(key string) string {
 		if tAny := i18nRef.Load(); tAny != nil {
@@ -107,6 +176,7 @@ func Render(tplPath string, data any) http.HandlerFunc {
 			filepath.Join("web", "ui", "partials", "buttons.html"),
 			filepath.Join("web", "ui", "partials", "buttons_admin.html"),
 			filepath.Join("web", "ui", "partials", "basket.html"),
+			filepath.Join("web", "ui", "partials", "tables.html"),
 		))
 		if err := t.ExecuteTemplate(w, "base", data); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
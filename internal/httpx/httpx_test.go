@@ -49,6 +49,42 @@ func TestResolveLocaleCookieFallback(t *testing.T) {
 	}
 }
 
+func TestResolveTerminalIssuesSessionCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	id := ResolveTerminal(w, r)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "ut_terminal" || cookies[0].Value != id {
+		t.Fatalf("session cookie not set for %q: %v", id, cookies)
+	}
+	if cookies[0].MaxAge != 0 || !cookies[0].Expires.IsZero() {
+		t.Fatalf("cookie outlives the browser session: %v", cookies[0])
+	}
+
+	// a just-issued ID opens no basket; it does once the client sends it back
+	w = httptest.NewRecorder()
+	if got := KnownTerminal(w, httptest.NewRequest("GET", "/", nil)); got != "" || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("known terminal = %q for a new client; cookies %v", got, w.Result().Cookies())
+	}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "ut_terminal", Value: id})
+	if got := KnownTerminal(httptest.NewRecorder(), r); got != id {
+		t.Fatalf("known terminal = %q; want %q", got, id)
+	}
+
+	// header wins over cookie; invalid header falls back to cookie
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Terminal-ID", "till-2")
+	r.AddCookie(&http.Cookie{Name: "ut_terminal", Value: id})
+	if got := ResolveTerminal(httptest.NewRecorder(), r); got != "till-2" {
+		t.Fatalf("terminal = %q; want header value", got)
+	}
+	r.Header.Set("X-Terminal-ID", "bad id/../")
+	if got := ResolveTerminal(httptest.NewRecorder(), r); got != id {
+		t.Fatalf("terminal = %q; want cookie value %q", got, id)
+	}
+}
+
 func TestFuncsForExposesMoneyAndI18n(t *testing.T) {
 	InitCurrency("EUR")
 	locales := filepath.Join("..", "..", "web", "locales")
@@ -67,6 +103,19 @@ func TestFuncsForExposesMoneyAndI18n(t *testing.T) {
 	if got := moneyFn(12345); got != "€123.45" {
 		t.Fatalf("money helper returned %q", got)
 	}
+	if got := moneyFn(-250); got != "-€2.50" {
+		t.Fatalf("money helper returned %q for a refund", got)
+	}
+	moneyInFn, ok := funcs["moneyIn"].(func(string, int64) string)
+	if !ok {
+		t.Fatalf("moneyIn helper not found")
+	}
+	if got := moneyInFn("GBP", 500); got != "£5.00" {
+		t.Fatalf("moneyIn helper returned %q", got)
+	}
+	if got := moneyInFn("CHF", 1250); got != "CHF 12.50" {
+		t.Fatalf("moneyIn helper returned %q", got)
+	}
 
 	tFn, ok := funcs["T"].(func(string) string)
 	if !ok {
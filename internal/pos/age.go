@@ -0,0 +1,101 @@
+package pos
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrAgePending  = errors.New("confirm or refuse the age check first")
+	ErrNoAgeCheck  = errors.New("no age check is waiting")
+	ErrUnderAge    = errors.New("customer is under age; the item was refused")
+	ErrAgeDecision = errors.New("give the age the customer looks over, their date of birth, or refuse")
+	ErrAgeNotShown = errors.New("that age isn't enough for this item; check ID for a date of birth")
+)
+
+// AgeCheck is an age-restricted item held back until the cashier confirms
+// the customer's age.
+type AgeCheck struct {
+	Item   BasketLine `json:"item"`
+	Qty    float64    `json:"qty"`
+	MinAge int        `json:"minAge"`
+}
+
+// AgeDecision is the cashier's answer to an age check: the age the
+// customer plainly looks over (e.g. 25 under Challenge 25), a date of
+// birth read from ID, or a refusal.
+type AgeDecision struct {
+	LooksOver int    `json:"looksOver,omitempty"`
+	DOB       string `json:"dob,omitempty"` // YYYY-MM-DD
+	Refused   bool   `json:"refused,omitempty"`
+}
+
+// ConfirmAge settles the waiting age check and records the decision in the
+// audit trail. An approved item goes into the basket and later items
+// needing no more than the confirmed age go straight in; a refusal, or a
+// date of birth that is too young (ErrUnderAge), keeps the item out.
+func (s *Service) ConfirmAge(terminal string, d AgeDecision) (*Basket, error) {
+	var out Basket
+	var refused error
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		c := b.AgeCheck
+		if c == nil {
+			return ErrNoAgeCheck
+		}
+		now := s.now()
+		ev := AuditEvent{At: now, Terminal: terminal, Kind: AuditAgeApproved, SKU: c.Item.SKU, Name: c.Item.Name}
+		verified := 0
+		switch {
+		case d.Refused:
+			ev.Kind, ev.Detail = AuditAgeRefused, "refused by cashier"
+		case d.DOB != "":
+			dob, err := time.ParseInLocation(dateLayout, d.DOB, now.Location())
+			if err != nil || dob.After(now) {
+				return ErrAgeDecision
+			}
+			age := ageOn(dob, now)
+			ev.Detail = fmt.Sprintf("date of birth %s, age %d", d.DOB, age)
+			if age < c.MinAge {
+				ev.Kind, refused = AuditAgeRefused, ErrUnderAge
+			} else {
+				verified = age
+			}
+		case d.LooksOver > 0:
+			if d.LooksOver < c.MinAge {
+				return ErrAgeNotShown
+			}
+			ev.Detail, verified = fmt.Sprintf("looks over %d", d.LooksOver), d.LooksOver
+		default:
+			return ErrAgeDecision
+		}
+		ev.Detail += fmt.Sprintf("; item needs %d", c.MinAge)
+		if err := s.audit(ev); err != nil {
+			return err
+		}
+		b.AgeCheck = nil
+		if verified > 0 {
+			b.AgeVerified = max(b.AgeVerified, verified)
+			b.add(c.Item, c.Qty)
+			s.recalc(b)
+		}
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refused != nil {
+		return nil, refused
+	}
+	return &out, nil
+}
+
+// ageOn is how old someone born on dob is on day at.
+func ageOn(dob, at time.Time) int {
+	age := at.Year() - dob.Year()
+	if at.Month() < dob.Month() || (at.Month() == dob.Month() && at.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
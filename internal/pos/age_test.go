@@ -0,0 +1,50 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAgeRestrictedItems(t *testing.T) {
+	items := mapResolver{
+		"WINE":  {SKU: "WINE", Name: "Wine", Qty: 1, PriceCents: 800, MinAge: 18},
+		"KNIFE": {SKU: "KNIFE", Name: "Knife", Qty: 1, PriceCents: 1200, MinAge: 18},
+		"BREAD": {SKU: "BREAD", Name: "Bread", Qty: 1, PriceCents: 120},
+	}
+	f := newFixture(t)
+	s := NewServiceWithResolver(Config{Tax: PercentTaxEngine{}, Audit: f.audit}, items)
+	s.now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+
+	b, err := s.Scan("T1", "WINE")
+	if err != nil || b.AgeCheck == nil || len(b.Lines) != 0 {
+		t.Fatalf("scan held = %+v, %v", b, err)
+	}
+	if _, err := s.Scan("T1", "BREAD"); !errors.Is(err, ErrAgePending) {
+		t.Fatalf("scan while pending err = %v", err)
+	}
+	if _, err := s.ConfirmAge("T1", AgeDecision{DOB: "2008-10-18"}); !errors.Is(err, ErrUnderAge) {
+		t.Fatalf("17 year old err = %v", err)
+	}
+	if b := s.Basket("T1"); b.AgeCheck != nil || len(b.Lines) != 0 {
+		t.Fatalf("refused item kept: %+v", b)
+	}
+
+	_, _ = s.Scan("T1", "WINE")
+	if _, err := s.ConfirmAge("T1", AgeDecision{LooksOver: 16}); !errors.Is(err, ErrAgeNotShown) {
+		t.Fatalf("looks over 16 err = %v", err)
+	}
+	b, err = s.ConfirmAge("T1", AgeDecision{LooksOver: 25})
+	if err != nil || len(b.Lines) != 1 || b.AgeVerified != 25 {
+		t.Fatalf("approved = %+v, %v", b, err)
+	}
+	// already checked for this customer
+	if b, _ = s.Scan("T1", "KNIFE"); b.AgeCheck != nil || len(b.Lines) != 2 {
+		t.Fatalf("second restricted item = %+v", b)
+	}
+
+	events, _ := s.AuditTrail(s.now().Add(-time.Hour), s.now().Add(time.Hour))
+	if len(events) != 2 || events[0].Kind != AuditAgeRefused || events[1].Kind != AuditAgeApproved || events[0].SKU != "WINE" {
+		t.Fatalf("audit = %+v", events)
+	}
+}
@@ -0,0 +1,44 @@
+package pos
+
+import "sort"
+
+// allocate splits amount across weights in proportion, handing the
+// remainder cents out by largest remainder (ties to the earliest weight) so
+// the parts always sum to amount.
+func allocate(amount int64, weights []int64) []int64 {
+	out := make([]int64, len(weights))
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 || len(weights) == 0 {
+		if len(out) > 0 {
+			out[0] = amount
+		}
+		return out
+	}
+	sign := int64(1)
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+	type rem struct {
+		i int
+		r int64
+	}
+	rems := make([]rem, len(weights))
+	var given int64
+	for i, w := range weights {
+		out[i] = amount * w / sum
+		rems[i] = rem{i, amount * w % sum}
+		given += out[i]
+	}
+	sort.SliceStable(rems, func(a, b int) bool { return rems[a].r > rems[b].r })
+	for k := 0; given < amount; k++ {
+		out[rems[k%len(rems)].i]++
+		given++
+	}
+	for i := range out {
+		out[i] *= sign
+	}
+	return out
+}
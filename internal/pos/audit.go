@@ -0,0 +1,42 @@
+package pos
+
+import "time"
+
+// Audit event kinds.
+const (
+	AuditAgeApproved = "age_approved"
+	AuditAgeRefused  = "age_refused"
+)
+
+// AuditEvent is a cashier decision kept for later review.
+type AuditEvent struct {
+	ID       int64     `json:"id"`
+	At       time.Time `json:"at"`
+	Terminal string    `json:"terminal"`
+	Kind     string    `json:"kind"`
+	SKU      string    `json:"sku,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// AuditLog keeps the audit trail.
+type AuditLog interface {
+	Record(e AuditEvent) error
+	// List returns the events in [from, to), oldest first.
+	List(from, to time.Time) ([]AuditEvent, error)
+}
+
+func (s *Service) audit(e AuditEvent) error {
+	if s.cfg.Audit == nil {
+		return nil
+	}
+	return s.cfg.Audit.Record(e)
+}
+
+// AuditTrail returns the audit events in [from, to).
+func (s *Service) AuditTrail(from, to time.Time) ([]AuditEvent, error) {
+	if s.cfg.Audit == nil {
+		return nil, nil
+	}
+	return s.cfg.Audit.List(from, to)
+}
@@ -0,0 +1,161 @@
+package pos
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+// Embedded barcode value kinds.
+const (
+	BarcodeWeight = "weight"
+	BarcodePrice  = "price"
+)
+
+var (
+	ErrBadCheckDigit = errors.New("barcode check digit is wrong; rescan the label")
+	ErrBarcodeRule   = errors.New("barcode rule positions fall outside the barcode")
+)
+
+// ValidateBarcodeRule checks a rule's positions fit its length.
+func ValidateBarcodeRule(r common.BarcodeRule) error {
+	fits := func(start, n int) bool { return start >= 0 && n > 0 && start+n < r.Length }
+	if r.Prefix == "" || r.Length <= len(r.Prefix) || !fits(r.ItemStart, r.ItemLen) || !fits(r.ValueStart, r.ValueLen) ||
+		r.Decimals < 0 || (r.Kind != BarcodeWeight && r.Kind != BarcodePrice) {
+		return ErrBarcodeRule
+	}
+	return nil
+}
+
+// SetBarcodeRules replaces the embedded barcode rules used by Scan.
+func (s *Service) SetBarcodeRules(rules []common.BarcodeRule) error {
+	for _, r := range rules {
+		if err := ValidateBarcodeRule(r); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.barcodes = append([]common.BarcodeRule(nil), rules...)
+	return nil
+}
+
+// resolve looks code up as a product first, so long catalog codes aren't
+// mistaken for GS1, then reads GS1 element strings, then variable-measure
+// labels. Label lines carry the scanned barcode so repeat scans stay
+// separate.
+func (s *Service) resolve(code string) (BasketLine, bool, error) {
+	if item, ok := s.resolver.Resolve(code); ok {
+		return item, true, nil
+	}
+	if g, ok, err := ParseGS1At(code, s.now()); ok {
+		if err != nil {
+			return BasketLine{}, false, err
+		}
+		return s.resolveGS1(g, code)
+	}
+	s.mu.RLock()
+	rules := s.barcodes
+	s.mu.RUnlock()
+	for _, r := range rules {
+		if len(code) != r.Length || !strings.HasPrefix(code, r.Prefix) || !allDigits(code) {
+			continue
+		}
+		if !validCheckDigit(code) {
+			return BasketLine{}, false, ErrBadCheckDigit
+		}
+		item, ok := s.resolver.Resolve(code[r.ItemStart : r.ItemStart+r.ItemLen])
+		if !ok {
+			continue
+		}
+		v, _ := strconv.ParseInt(code[r.ValueStart:r.ValueStart+r.ValueLen], 10, 64)
+		item.Barcode = code
+		switch r.Kind {
+		case BarcodeWeight:
+			item.Qty = RoundQty(float64(v) / math.Pow10(r.Decimals))
+			item.Unit = "kg"
+		case BarcodePrice:
+			item.Qty = 1
+			item.PriceCents = scaleCents(v, r.Decimals)
+		}
+		return item, true, nil
+	}
+	return BasketLine{}, false, nil
+}
+
+// resolveGS1 looks the GTIN up and carries batch, expiry, weight and
+// price over to the line. Expired items are refused. A label with an
+// amount payable is sold as one item at that amount; its weight is only
+// noted on the line.
+func (s *Service) resolveGS1(g GS1, code string) (BasketLine, bool, error) {
+	var item BasketLine
+	found := false
+	for _, k := range gtinKeys(g.GTIN) {
+		if item, found = s.resolver.Resolve(k); found {
+			break
+		}
+	}
+	if !found {
+		return BasketLine{}, false, nil
+	}
+	if g.Expiry != "" && g.Expiry < s.now().Format(dateLayout) {
+		return BasketLine{}, false, ErrItemExpired
+	}
+	item.Batch, item.Expiry = g.Batch, g.Expiry
+	if g.Serial != "" {
+		item.Barcode, item.Qty = code, 1
+	}
+	switch {
+	case g.HasPrice:
+		item.Barcode, item.Qty, item.PriceCents = code, 1, g.PriceCents
+		if g.WeightKg > 0 {
+			item.Note = strconv.FormatFloat(g.WeightKg, 'f', 3, 64) + " kg"
+		}
+	case g.WeightKg > 0:
+		item.Barcode, item.Qty, item.Unit = code, g.WeightKg, "kg"
+	}
+	return item, true, nil
+}
+
+// scaleCents turns a value with the given implied decimals into cents.
+func scaleCents(v int64, decimals int) int64 {
+	for ; decimals < 2; decimals++ {
+		v *= 10
+	}
+	for ; decimals > 2; decimals-- {
+		v /= 10
+	}
+	return v
+}
+
+// validCheckDigit checks the GS1 mod-10 check digit that ends EAN-8,
+// UPC-A, EAN-13 and GTIN-14 codes.
+func validCheckDigit(code string) bool {
+	if len(code) < 2 {
+		return false
+	}
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		d := int(code[i] - '0')
+		if (len(code)-2-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// RoundQty rounds a quantity to the gram so repeated sums stay exact.
+func RoundQty(q float64) float64 { return math.Round(q*1000) / 1000 }
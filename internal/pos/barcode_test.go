@@ -0,0 +1,50 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+func TestEmbeddedBarcodes(t *testing.T) {
+	items := mapResolver{"12345": {SKU: "12345", Name: "Ham", Qty: 1, PriceCents: 1800}}
+	s := NewServiceWithResolver(Config{Journal: newFixture(t).journal, Tax: PercentTaxEngine{}}, items)
+	if err := s.SetBarcodeRules([]common.BarcodeRule{
+		{Prefix: "21", Length: 13, ItemStart: 2, ItemLen: 5, ValueStart: 7, ValueLen: 5, Decimals: 3, Kind: BarcodeWeight},
+		{Prefix: "22", Length: 13, ItemStart: 2, ItemLen: 5, ValueStart: 7, ValueLen: 5, Decimals: 2, Kind: BarcodePrice},
+	}); err != nil {
+		t.Fatalf("SetBarcodeRules: %v", err)
+	}
+
+	if _, err := s.Scan("T1", "2112345004526"); !errors.Is(err, ErrBadCheckDigit) {
+		t.Fatalf("bad check digit err = %v", err)
+	}
+	_, _ = s.Scan("T1", "2112345004525")  // 0.452 kg at £18.00/kg
+	b, _ := s.Scan("T1", "2212345003990") // £3.99 label
+	if len(b.Lines) != 2 {
+		t.Fatalf("lines = %+v; want two separate label lines", b.Lines)
+	}
+	if l := b.Lines[0]; l.Qty != 0.452 || l.Unit != "kg" || l.Amount() != 814 {
+		t.Fatalf("weighed line = %+v (amount %d)", l, l.Amount())
+	}
+	if l := b.Lines[1]; l.Qty != 1 || l.PriceCents != 399 {
+		t.Fatalf("priced line = %+v", l)
+	}
+
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if err != nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	if _, err := s.Refund("T1", RefundRequest{ReceiptNo: sale.ReceiptNo, Lines: []RefundLine{{LineNo: 1, Qty: 0.2}}}); err != nil {
+		t.Fatalf("partial weight refund: %v", err)
+	}
+	_, lines, _ := s.Refundable(sale.ReceiptNo)
+	if lines[0].Remaining != 0.252 {
+		t.Fatalf("remaining = %v; want 0.252", lines[0].Remaining)
+	}
+	r, err := s.Refund("T1", RefundRequest{ReceiptNo: sale.ReceiptNo, Lines: []RefundLine{{LineNo: 1, Qty: 0.252}}})
+	if err != nil || r.Total != -(814-360) {
+		t.Fatalf("final weight refund: %+v, %v", r, err)
+	}
+}
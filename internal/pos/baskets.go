@@ -0,0 +1,224 @@
+package pos
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrTooManyBaskets = errors.New("too many open baskets")
+	ErrSameBasket     = errors.New("pick two different baskets")
+	ErrNoTerminal     = errors.New("till not identified yet; reload the page")
+)
+
+// DefaultMaxBaskets bounds the open baskets when Config.MaxBaskets is unset.
+const DefaultMaxBaskets = 64
+
+// Baskets holds one open basket per terminal or session ID. Each basket has
+// its own lock so terminals never wait on each other. Baskets kept by the
+// backing store, such as table tabs, are read from it at the start of each
+// change and written back at the end, so every terminal sees the same one.
+type Baskets struct {
+	mu   sync.Mutex
+	open map[string]*openBasket
+	max  int
+	back basketBacking // nil keeps every basket in memory
+}
+
+// basketBacking keeps the baskets that outlive the process.
+type basketBacking interface {
+	owns(id string) bool
+	load(id string) (Basket, error)
+	// save writes b back, or drops it when it is empty
+	save(id string, b *Basket) error
+}
+
+type openBasket struct {
+	mu     sync.Mutex
+	basket Basket
+	closed bool // set once removed from the map; holders must look up again
+}
+
+func NewBaskets(max int) *Baskets {
+	if max <= 0 {
+		max = DefaultMaxBaskets
+	}
+	return &Baskets{open: map[string]*openBasket{}, max: max}
+}
+
+// With runs fn with exclusive access to the basket for id, opening one if
+// needed. Baskets left empty by fn are released so they don't count
+// against the limit. Backed baskets are only written back when fn succeeds.
+func (m *Baskets) With(id string, fn func(b *Basket) error) error {
+	ob, err := m.lock(id)
+	if err != nil {
+		return err
+	}
+	return m.unlock(id, ob, fn(&ob.basket))
+}
+
+// WithPair runs fn with both baskets held, for moving things between
+// them. They are locked in ID order so two pairs can't deadlock, and the
+// basket left holding something is written back before the one emptied.
+func (m *Baskets) WithPair(a, b string, fn func(a, b *Basket) error) error {
+	if a == b {
+		return ErrSameBasket
+	}
+	first, second := a, b
+	if second < first {
+		first, second = second, first
+	}
+	fo, err := m.lock(first)
+	if err != nil {
+		return err
+	}
+	so, err := m.lock(second)
+	if err != nil {
+		return m.unlock(first, fo, err)
+	}
+	oa, ob := fo, so
+	if first != a {
+		oa, ob = so, fo
+	}
+	err = fn(&oa.basket, &ob.basket)
+	if oa.basket.empty() {
+		return m.unlock(a, oa, m.unlock(b, ob, err))
+	}
+	return m.unlock(b, ob, m.unlock(a, oa, err))
+}
+
+// lock opens the basket for id and takes its lock, loading backed baskets.
+func (m *Baskets) lock(id string) (*openBasket, error) {
+	for {
+		ob, err := m.acquire(id)
+		if err != nil {
+			return nil, err
+		}
+		ob.mu.Lock()
+		if ob.closed {
+			ob.mu.Unlock()
+			continue
+		}
+		if m.backs(id) {
+			if ob.basket, err = m.back.load(id); err != nil {
+				return nil, m.unlock(id, ob, err)
+			}
+		}
+		return ob, nil
+	}
+}
+
+// unlock releases the basket after a change that ended in err, writing
+// backed baskets back when err is nil. Backed and empty baskets leave the
+// map.
+func (m *Baskets) unlock(id string, ob *openBasket, err error) error {
+	backed := m.backs(id)
+	if backed && err == nil {
+		err = m.back.save(id, &ob.basket)
+	}
+	if backed || ob.basket.empty() {
+		m.mu.Lock()
+		if m.open[id] == ob {
+			delete(m.open, id)
+		}
+		m.mu.Unlock()
+		ob.closed = true
+	}
+	ob.mu.Unlock()
+	return err
+}
+
+func (m *Baskets) backs(id string) bool { return m.back != nil && m.back.owns(id) }
+
+// Get returns a copy of the basket for id without opening one.
+func (m *Baskets) Get(id string) Basket {
+	if m.backs(id) {
+		b, _ := m.back.load(id)
+		return b
+	}
+	m.mu.Lock()
+	ob := m.open[id]
+	m.mu.Unlock()
+	if ob == nil {
+		return Basket{}
+	}
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.basket.clone()
+}
+
+// Each runs fn on every open basket, one at a time under its lock.
+func (m *Baskets) Each(fn func(b *Basket)) {
+	m.mu.Lock()
+	list := make([]*openBasket, 0, len(m.open))
+	for _, ob := range m.open {
+		list = append(list, ob)
+	}
+	m.mu.Unlock()
+	for _, ob := range list {
+		ob.mu.Lock()
+		if !ob.closed {
+			fn(&ob.basket)
+		}
+		ob.mu.Unlock()
+	}
+}
+
+// Len reports how many baskets are open.
+func (m *Baskets) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.open)
+}
+
+func (m *Baskets) acquire(id string) (*openBasket, error) {
+	if id == "" {
+		return nil, ErrNoTerminal
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ob, ok := m.open[id]; ok {
+		return ob, nil
+	}
+	if len(m.open) >= m.max {
+		return nil, ErrTooManyBaskets
+	}
+	ob := &openBasket{}
+	m.open[id] = ob
+	return ob, nil
+}
+
+// empty reports whether the basket holds nothing worth keeping open.
+func (b *Basket) empty() bool {
+	return len(b.Lines) == 0 && b.AgeCheck == nil && b.Customer == nil && b.Operator == "" && b.ServiceChargeBP == 0 && b.Covers == 0
+}
+
+func (b *Basket) clone() Basket {
+	out := *b
+	if b.AgeCheck != nil {
+		c := *b.AgeCheck
+		out.AgeCheck = &c
+	}
+	if b.Customer != nil {
+		c := *b.Customer
+		out.Customer = &c
+	}
+	if b.Loyalty != nil {
+		l := *b.Loyalty
+		out.Loyalty = &l
+	}
+	out.Lines = append([]BasketLine(nil), b.Lines...)
+	out.Payments = append([]Payment(nil), b.Payments...)
+	out.TaxBreakdown = append([]TaxBand(nil), b.TaxBreakdown...)
+	out.Discounts = append([]Discount(nil), b.Discounts...)
+	out.Vouchers = append([]Voucher(nil), b.Vouchers...)
+	if b.Split != nil {
+		sp := Split{Ref: b.Split.Ref, Parts: make([]SplitPart, len(b.Split.Parts))}
+		for i, p := range b.Split.Parts {
+			p.Basket = p.Basket.clone()
+			sp.Parts[i] = p
+		}
+		out.Split = &sp
+	}
+	return out
+}
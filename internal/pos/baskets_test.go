@@ -0,0 +1,52 @@
+package pos
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBasketsArePerTerminal(t *testing.T) {
+	s := NewService(Config{})
+	var wg sync.WaitGroup
+	for _, term := range []string{"T1", "T2"} {
+		wg.Add(1)
+		go func(term string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, _ = s.Scan(term, "A")
+			}
+		}(term)
+	}
+	wg.Wait()
+	for _, term := range []string{"T1", "T2"} {
+		if b := s.Basket(term); len(b.Lines) != 1 || b.Lines[0].Qty != 50 {
+			t.Fatalf("%s basket = %+v; want 50 x A", term, b.Lines)
+		}
+	}
+	if _, err := s.Tender("T1", 0, "cash"); err != nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	if b := s.Basket("T2"); len(b.Lines) != 1 {
+		t.Fatalf("tendering T1 touched T2: %+v", b)
+	}
+}
+
+func TestBasketLimit(t *testing.T) {
+	s := NewService(Config{MaxBaskets: 1})
+	if _, err := s.Scan("T1", "A"); err != nil {
+		t.Fatalf("Scan T1: %v", err)
+	}
+	if _, err := s.Scan("T2", "A"); err != ErrTooManyBaskets {
+		t.Fatalf("err = %v; want ErrTooManyBaskets", err)
+	}
+	if _, err := s.Scan("", "A"); err != ErrNoTerminal {
+		t.Fatalf("err = %v; want ErrNoTerminal", err)
+	}
+	// a tendered basket frees its slot
+	if _, err := s.Tender("T1", 0, "cash"); err != nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	if _, err := s.Scan("T2", "A"); err != nil {
+		t.Fatalf("Scan T2 after tender: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package pos
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCustomerNotFound = errors.New("customer not found")
+	ErrCustomerName     = errors.New("customer name is required")
+	ErrCustomerCard     = errors.New("card number is already on another customer")
+	ErrCustomerPrice    = errors.New("customer prices must not be negative")
+)
+
+// Customer is a customer record. Sales for them carry their ID, their
+// price list overrides catalog prices by SKU, and tax-exempt customers
+// are charged without tax.
+type Customer struct {
+	ID        int64            `json:"id"`
+	Name      string           `json:"name"`
+	Email     string           `json:"email,omitempty"`
+	Phone     string           `json:"phone,omitempty"`
+	Card      string           `json:"card,omitempty"` // loyalty or account card, scanned at the till
+	TaxExempt bool             `json:"taxExempt,omitempty"`
+	ExemptRef string           `json:"exemptRef,omitempty"` // exemption certificate or reason
+	Prices    map[string]int64 `json:"prices,omitempty"`    // SKU to unit price in cents
+	Notes     string           `json:"notes,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+// Customers finds customers for the till; see SQLiteCustomerStore.
+type Customers interface {
+	Lookup(id int64) (Customer, error)
+	// LookupCard finds the customer holding a loyalty or account card.
+	LookupCard(card string) (Customer, error)
+}
+
+// price gives l the customer's own price, if they have one for it.
+// Hand-priced and label lines keep theirs.
+func (c *Customer) price(l *BasketLine) {
+	if c == nil || l.Overridden() || l.Barcode != "" || l.GiftCard != "" || l.OpenPrice {
+		return
+	}
+	if p, ok := c.Prices[l.SKU]; ok {
+		l.PriceCents = p + modifierCents(l.Modifiers)
+	}
+}
+
+// AttachCustomer puts the customer with id on the terminal's basket.
+func (s *Service) AttachCustomer(terminal string, id int64) (*Basket, error) {
+	if s.cfg.Customers == nil {
+		return nil, ErrCustomerNotFound
+	}
+	c, err := s.cfg.Customers.Lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.attachCustomer(terminal, c)
+}
+
+// attachCustomer reprices the basket for c. The basket stays open even
+// while empty so the customer is there for the items that follow.
+func (s *Service) attachCustomer(terminal string, c Customer) (*Basket, error) {
+	loyalty, err := s.Loyalty(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	var out Basket
+	err = s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		s.repriceLines(b, &c)
+		b.Customer, b.Loyalty = &c, loyalty
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DetachCustomer takes the customer off the basket and restores catalog
+// prices.
+func (s *Service) DetachCustomer(terminal string) (*Basket, error) {
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		b.Customer, b.Loyalty = nil, nil
+		s.repriceLines(b, nil)
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// repriceLines sets each line back to its catalog price, then applies c's
+// price list.
+func (s *Service) repriceLines(b *Basket, c *Customer) {
+	for i := range b.Lines {
+		l := &b.Lines[i]
+		if l.Overridden() || l.Barcode != "" || l.GiftCard != "" || l.OpenPrice {
+			continue
+		}
+		if item, ok := s.resolver.Resolve(l.SKU); ok {
+			l.PriceCents = item.PriceCents + modifierCents(l.Modifiers)
+		}
+		c.price(l)
+	}
+}
+
+func (b *Basket) customerID() int64 {
+	if b.Customer == nil {
+		return 0
+	}
+	return b.Customer.ID
+}
+
+// lookupCard tries code as a customer card.
+func (s *Service) lookupCard(code string) (Customer, error) {
+	if s.cfg.Customers == nil {
+		return Customer{}, ErrCustomerNotFound
+	}
+	return s.cfg.Customers.LookupCard(strings.TrimSpace(code))
+}
+
+// CustomerHistory returns the customer's sales and refunds, oldest first.
+func (s *Service) CustomerHistory(id int64) ([]Sale, error) {
+	if s.cfg.Journal == nil {
+		return nil, nil
+	}
+	return s.cfg.Journal.ByCustomer(id)
+}
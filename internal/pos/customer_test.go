@@ -0,0 +1,60 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCustomerPricesAndHistory(t *testing.T) {
+	items := mapResolver{
+		"TEA":  {SKU: "TEA", Name: "Tea", Qty: 1, PriceCents: 300},
+		"CAKE": {SKU: "CAKE", Name: "Cake", Qty: 1, PriceCents: 450},
+	}
+	f := newFixture(t)
+	store, j := f.customers, f.journal
+	trade, err := store.Save(Customer{Name: "Cafe Trade", Card: "C100", Prices: map[string]int64{"TEA": 250}})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	charity, _ := store.Save(Customer{Name: "Food Bank", TaxExempt: true, ExemptRef: "CH-42"})
+	if _, err := store.Save(Customer{Name: "Copycat", Card: "C100"}); !errors.Is(err, ErrCustomerCard) {
+		t.Fatalf("duplicate card err = %v", err)
+	}
+	if found, _ := store.Search("trade", 10); len(found) != 1 || found[0].ID != trade.ID {
+		t.Fatalf("search = %+v", found)
+	}
+
+	s := NewServiceWithResolver(Config{Tax: PercentTaxEngine{RatePercent: 20}, Journal: j, Customers: store}, items)
+	_, _ = s.Scan("T1", "TEA")
+	// scanning the card attaches the customer and reprices what's there
+	b, err := s.Scan("T1", "C100")
+	if err != nil || b.Customer == nil || b.Customer.ID != trade.ID || b.Lines[0].PriceCents != 250 {
+		t.Fatalf("card scan = %+v, %v", b, err)
+	}
+	if b, _ = s.Scan("T1", "CAKE"); b.Lines[1].PriceCents != 450 || b.Total != 840 {
+		t.Fatalf("after cake = %+v", b)
+	}
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if err != nil || sale.CustomerID != trade.ID {
+		t.Fatalf("tender = %+v, %v", sale, err)
+	}
+	if b = s.Basket("T1"); b.Customer != nil {
+		t.Fatalf("customer left on next basket: %+v", b)
+	}
+
+	// exempt customers pay no tax; detaching restores it
+	if b, err = s.AttachCustomer("T2", charity.ID); err != nil || len(b.Lines) != 0 || b.Customer == nil {
+		t.Fatalf("attach to empty basket = %+v, %v", b, err)
+	}
+	if b, _ = s.Scan("T2", "CAKE"); b.Tax != 0 || b.Total != 450 {
+		t.Fatalf("exempt = %+v", b)
+	}
+	if b, _ = s.DetachCustomer("T2"); b.Tax != 90 || b.Total != 540 {
+		t.Fatalf("detached = %+v", b)
+	}
+
+	history, err := s.CustomerHistory(trade.ID)
+	if err != nil || len(history) != 1 || history[0].ReceiptNo != sale.ReceiptNo {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+}
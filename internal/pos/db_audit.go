@@ -0,0 +1,61 @@
+package pos
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteAuditLog keeps the audit trail in the edge database.
+type SQLiteAuditLog struct{ db *sql.DB }
+
+func NewSQLiteAuditLog(path string) (*SQLiteAuditLog, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS audit_log(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  created_at TEXT NOT NULL,
+	  terminal TEXT NOT NULL,
+	  kind TEXT NOT NULL,
+	  sku TEXT,
+	  name TEXT,
+	  detail TEXT
+	);
+	CREATE INDEX IF NOT EXISTS audit_log_created_at ON audit_log(created_at);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteAuditLog{db: db}, nil
+}
+
+func (a *SQLiteAuditLog) Record(e AuditEvent) error {
+	_, err := a.db.Exec(`INSERT INTO audit_log(created_at,terminal,kind,sku,name,detail) VALUES(?,?,?,?,?,?)`,
+		e.At.UTC().Format(tsLayout), e.Terminal, e.Kind, nullIfEmpty(e.SKU), nullIfEmpty(e.Name), nullIfEmpty(e.Detail))
+	return err
+}
+
+func (a *SQLiteAuditLog) List(from, to time.Time) ([]AuditEvent, error) {
+	rows, err := a.db.Query(`SELECT id, created_at, terminal, kind, sku, name, detail FROM audit_log
+	  WHERE created_at >= ? AND created_at < ? ORDER BY created_at, id`,
+		from.UTC().Format(tsLayout), to.UTC().Format(tsLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		var at string
+		var sku, name, detail sql.NullString
+		if err := rows.Scan(&e.ID, &at, &e.Terminal, &e.Kind, &sku, &name, &detail); err != nil {
+			return nil, err
+		}
+		e.At, _ = time.Parse(tsLayout, at)
+		e.SKU, e.Name, e.Detail = sku.String, name.String, detail.String
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,144 @@
+package pos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteCustomerStore keeps customer records. Card numbers are unique so
+// a scan finds exactly one customer.
+type SQLiteCustomerStore struct{ db *sql.DB }
+
+func NewSQLiteCustomerStore(path string) (*SQLiteCustomerStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS customers(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  name TEXT NOT NULL,
+	  email TEXT,
+	  phone TEXT,
+	  card TEXT UNIQUE,
+	  tax_exempt INTEGER NOT NULL DEFAULT 0,
+	  exempt_ref TEXT,
+	  prices TEXT,
+	  notes TEXT,
+	  created_at TEXT NOT NULL
+	);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteCustomerStore{db: db}, nil
+}
+
+const customerColumns = `SELECT id, name, email, phone, card, tax_exempt, exempt_ref, prices, notes, created_at FROM customers`
+
+func scanCustomer(row interface{ Scan(...any) error }) (Customer, error) {
+	var c Customer
+	var email, phone, card, ref, prices, notes sql.NullString
+	var created string
+	if err := row.Scan(&c.ID, &c.Name, &email, &phone, &card, &c.TaxExempt, &ref, &prices, &notes, &created); err != nil {
+		return Customer{}, err
+	}
+	c.Email, c.Phone, c.Card, c.ExemptRef, c.Notes = email.String, phone.String, card.String, ref.String, notes.String
+	if prices.Valid {
+		if err := json.Unmarshal([]byte(prices.String), &c.Prices); err != nil {
+			return Customer{}, err
+		}
+	}
+	c.CreatedAt, _ = time.Parse(tsLayout, created)
+	return c, nil
+}
+
+func (s *SQLiteCustomerStore) Lookup(id int64) (Customer, error) {
+	c, err := scanCustomer(s.db.QueryRow(customerColumns+` WHERE id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Customer{}, ErrCustomerNotFound
+	}
+	return c, err
+}
+
+func (s *SQLiteCustomerStore) LookupCard(card string) (Customer, error) {
+	card = strings.TrimSpace(card)
+	if card == "" {
+		return Customer{}, ErrCustomerNotFound
+	}
+	c, err := scanCustomer(s.db.QueryRow(customerColumns+` WHERE card=?`, card))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Customer{}, ErrCustomerNotFound
+	}
+	return c, err
+}
+
+// Search finds up to limit customers whose name, email, phone or card
+// contains q, by name. A blank q lists them all.
+func (s *SQLiteCustomerStore) Search(q string, limit int) ([]Customer, error) {
+	like := "%" + strings.TrimSpace(q) + "%"
+	rows, err := s.db.Query(customerColumns+`
+	  WHERE name LIKE ?1 OR email LIKE ?1 OR phone LIKE ?1 OR card LIKE ?1
+	  ORDER BY name, id LIMIT ?2`, like, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Customer
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Save adds c when its ID is zero and updates it otherwise, returning the
+// stored record.
+func (s *SQLiteCustomerStore) Save(c Customer) (Customer, error) {
+	c.Name, c.Card = strings.TrimSpace(c.Name), strings.TrimSpace(c.Card)
+	if c.Name == "" {
+		return Customer{}, ErrCustomerName
+	}
+	for _, p := range c.Prices {
+		if p < 0 {
+			return Customer{}, ErrCustomerPrice
+		}
+	}
+	var prices any
+	if len(c.Prices) > 0 {
+		b, err := json.Marshal(c.Prices)
+		if err != nil {
+			return Customer{}, err
+		}
+		prices = string(b)
+	}
+	if other, err := s.LookupCard(c.Card); err == nil && other.ID != c.ID {
+		return Customer{}, ErrCustomerCard
+	}
+	args := []any{c.Name, nullIfEmpty(c.Email), nullIfEmpty(c.Phone), nullIfEmpty(c.Card), c.TaxExempt,
+		nullIfEmpty(c.ExemptRef), prices, nullIfEmpty(c.Notes)}
+	if c.ID == 0 {
+		res, err := s.db.Exec(`INSERT INTO customers(name,email,phone,card,tax_exempt,exempt_ref,prices,notes,created_at)
+		  VALUES(?,?,?,?,?,?,?,?,?)`, append(args, time.Now().UTC().Format(tsLayout))...)
+		if err != nil {
+			return Customer{}, err
+		}
+		c.ID, _ = res.LastInsertId()
+		return s.Lookup(c.ID)
+	}
+	res, err := s.db.Exec(`UPDATE customers SET name=?, email=?, phone=?, card=?, tax_exempt=?, exempt_ref=?, prices=?, notes=?
+	  WHERE id=?`, append(args, c.ID)...)
+	if err != nil {
+		return Customer{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Customer{}, ErrCustomerNotFound
+	}
+	return s.Lookup(c.ID)
+}
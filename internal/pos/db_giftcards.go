@@ -0,0 +1,162 @@
+package pos
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteGiftCardStore keeps gift cards and every movement on them; a
+// card's balance is the sum of its ledger.
+type SQLiteGiftCardStore struct{ db *sql.DB }
+
+func NewSQLiteGiftCardStore(path string) (*SQLiteGiftCardStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS gift_cards(
+	  number TEXT PRIMARY KEY,
+	  issued_at TEXT NOT NULL,
+	  expires_at TEXT
+	);
+	CREATE TABLE IF NOT EXISTS gift_card_entries(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  number TEXT NOT NULL REFERENCES gift_cards(number),
+	  kind TEXT NOT NULL,
+	  amount_cents INTEGER NOT NULL,
+	  receipt_no TEXT,
+	  terminal TEXT NOT NULL,
+	  created_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS gift_card_entries_number ON gift_card_entries(number);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteGiftCardStore{db: db}, nil
+}
+
+func (s *SQLiteGiftCardStore) Lookup(number string) (GiftCard, error) {
+	var g GiftCard
+	var issued string
+	var expires sql.NullString
+	err := s.db.QueryRow(`SELECT number, issued_at, expires_at,
+	  (SELECT COALESCE(SUM(amount_cents),0) FROM gift_card_entries e WHERE e.number=c.number)
+	  FROM gift_cards c WHERE number=?`, number).Scan(&g.Number, &issued, &expires, &g.BalanceCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GiftCard{}, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return GiftCard{}, err
+	}
+	g.IssuedAt, _ = time.Parse(tsLayout, issued)
+	if expires.Valid {
+		g.ExpiresAt, _ = time.Parse(tsLayout, expires.String)
+	}
+	return g, nil
+}
+
+func (s *SQLiteGiftCardStore) Post(entries []GiftCardEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if posted, err := giftCardEntryPosted(tx, e); err != nil || posted {
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			continue
+		}
+		if err := postGiftCardEntry(tx, e); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// giftCardEntryPosted reports whether e's receipt already has an entry of
+// its kind on the card.
+func giftCardEntryPosted(tx *sql.Tx, e GiftCardEntry) (bool, error) {
+	if e.ReceiptNo == "" {
+		return false, nil
+	}
+	kinds := []any{e.Kind, e.Kind}
+	if e.Kind == GiftCardIssue || e.Kind == GiftCardTopUp {
+		kinds = []any{GiftCardIssue, GiftCardTopUp}
+	}
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM gift_card_entries WHERE receipt_no=? AND number=? AND kind IN (?,?)`,
+		append([]any{e.ReceiptNo, e.Number}, kinds...)...).Scan(&n)
+	return n > 0, err
+}
+
+func postGiftCardEntry(tx *sql.Tx, e GiftCardEntry) error {
+	at := e.CreatedAt.UTC().Format(tsLayout)
+	var expires any
+	if !e.ExpiresAt.IsZero() {
+		expires = e.ExpiresAt.UTC().Format(tsLayout)
+	}
+	switch e.Kind {
+	case GiftCardIssue, GiftCardTopUp:
+		if _, err := tx.Exec(`INSERT INTO gift_cards(number,issued_at,expires_at) VALUES(?,?,?)
+		  ON CONFLICT(number) DO UPDATE SET expires_at=excluded.expires_at`, e.Number, at, expires); err != nil {
+			return err
+		}
+	case GiftCardRedeem:
+		var exp sql.NullString
+		err := tx.QueryRow(`SELECT expires_at FROM gift_cards WHERE number=?`, e.Number).Scan(&exp)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrGiftCardNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if exp.Valid && at >= exp.String {
+			return ErrGiftCardExpired
+		}
+	}
+	// the guard keeps takings from overdrawing the card across tills
+	res, err := tx.Exec(`INSERT INTO gift_card_entries(number,kind,amount_cents,receipt_no,terminal,created_at)
+	  SELECT ?,?,?,?,?,? WHERE EXISTS(SELECT 1 FROM gift_cards WHERE number=?)
+	    AND (? >= 0 OR (SELECT COALESCE(SUM(amount_cents),0) FROM gift_card_entries WHERE number=?) + ? >= 0)`,
+		e.Number, e.Kind, e.AmountCents, nullIfEmpty(e.ReceiptNo), e.Terminal, at,
+		e.Number, e.AmountCents, e.Number, e.AmountCents)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var one int
+		if err := tx.QueryRow(`SELECT 1 FROM gift_cards WHERE number=?`, e.Number).Scan(&one); errors.Is(err, sql.ErrNoRows) {
+			return ErrGiftCardNotFound
+		}
+		return ErrGiftCardBalance
+	}
+	return nil
+}
+
+func (s *SQLiteGiftCardStore) Entries(number string) ([]GiftCardEntry, error) {
+	rows, err := s.db.Query(`SELECT id, number, kind, amount_cents, receipt_no, terminal, created_at
+	  FROM gift_card_entries WHERE number=? ORDER BY id`, number)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []GiftCardEntry
+	for rows.Next() {
+		var e GiftCardEntry
+		var receipt sql.NullString
+		var at string
+		if err := rows.Scan(&e.ID, &e.Number, &e.Kind, &e.AmountCents, &receipt, &e.Terminal, &at); err != nil {
+			return nil, err
+		}
+		e.ReceiptNo = receipt.String
+		e.CreatedAt, _ = time.Parse(tsLayout, at)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,409 @@
+package pos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/universaltill/universal-till/internal/common"
+	_ "modernc.org/sqlite"
+)
+
+// timestamps are stored as fixed-width UTC text so they sort and compare as strings
+const tsLayout = "2006-01-02T15:04:05Z"
+
+type SQLiteJournal struct{ db *sql.DB }
+
+func NewSQLiteJournal(path string) (*SQLiteJournal, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS receipt_seq(
+	  terminal TEXT PRIMARY KEY,
+	  last INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS sales(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  terminal TEXT NOT NULL,
+	  seq INTEGER NOT NULL,
+	  receipt_no TEXT NOT NULL UNIQUE,
+	  created_at TEXT NOT NULL,
+	  subtotal INTEGER NOT NULL,
+	  tax INTEGER NOT NULL,
+	  total INTEGER NOT NULL,
+	  UNIQUE(terminal, seq)
+	);
+	CREATE INDEX IF NOT EXISTS sales_created_at ON sales(created_at);
+	CREATE TABLE IF NOT EXISTS sale_lines(
+	  sale_id INTEGER NOT NULL REFERENCES sales(id),
+	  line_no INTEGER NOT NULL,
+	  sku TEXT NOT NULL,
+	  name TEXT NOT NULL,
+	  qty REAL NOT NULL,
+	  price_cents INTEGER NOT NULL,
+	  image_url TEXT,
+	  PRIMARY KEY(sale_id, line_no)
+	);
+	CREATE TABLE IF NOT EXISTS sale_payments(
+	  sale_id INTEGER NOT NULL REFERENCES sales(id),
+	  seq INTEGER NOT NULL,
+	  method TEXT NOT NULL,
+	  amount_cents INTEGER NOT NULL,
+	  PRIMARY KEY(sale_id, seq)
+	);
+	CREATE TABLE IF NOT EXISTS sale_discounts(
+	  sale_id INTEGER NOT NULL REFERENCES sales(id),
+	  seq INTEGER NOT NULL,
+	  promo_id TEXT NOT NULL,
+	  name TEXT NOT NULL,
+	  amount_cents INTEGER NOT NULL,
+	  lines TEXT,
+	  PRIMARY KEY(sale_id, seq)
+	);
+	CREATE TABLE IF NOT EXISTS sale_pending(
+	  sale_id INTEGER NOT NULL REFERENCES sales(id),
+	  ledger TEXT NOT NULL,
+	  PRIMARY KEY(sale_id, ledger)
+	);`); err != nil {
+		return nil, err
+	}
+	if err := common.AddColumns(db, journalColumns); err != nil {
+		return nil, err
+	}
+	// sale_lines first shipped with whole quantities
+	if err := common.RetypeColumn(db, "sale_lines", "qty", "REAL"); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS sales_refund_of ON sales(refund_of)`); err != nil {
+		return nil, err
+	}
+	return &SQLiteJournal{db: db}, nil
+}
+
+// journalColumns were added after the tables first shipped; AddColumns
+// brings older databases up to date.
+var journalColumns = []common.Column{
+	{Table: "sale_lines", Name: "note", Def: "TEXT"},
+	{Table: "sale_lines", Name: "original_price_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "override_reason", Def: "TEXT"},
+	{Table: "sales", Name: "change_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "kind", Def: "TEXT NOT NULL DEFAULT 'sale'"},
+	{Table: "sales", Name: "refund_of", Def: "TEXT"},
+	{Table: "sales", Name: "reason", Def: "TEXT"},
+	{Table: "sale_lines", Name: "tax_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "total_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "refund_of_line", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "restock", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "tax_class", Def: "TEXT"},
+	{Table: "sale_lines", Name: "tax_rate_bp", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "category", Def: "TEXT"},
+	{Table: "sale_lines", Name: "discount_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "discount_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "vouchers", Def: "TEXT"},
+	{Table: "sale_lines", Name: "unit", Def: "TEXT"},
+	{Table: "sale_lines", Name: "barcode", Def: "TEXT"},
+	{Table: "sale_lines", Name: "batch", Def: "TEXT"},
+	{Table: "sale_lines", Name: "expiry", Def: "TEXT"},
+	{Table: "sales", Name: "session_id", Def: "INTEGER"},
+	{Table: "sales", Name: "customer_id", Def: "INTEGER"},
+	{Table: "sales", Name: "points_earned", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "points_redeemed", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_payments", Name: "ref", Def: "TEXT"},
+	{Table: "sale_lines", Name: "gift_card", Def: "TEXT"},
+	{Table: "sales", Name: "rounding_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_payments", Name: "currency", Def: "TEXT"},
+	{Table: "sale_payments", Name: "foreign_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_payments", Name: "rate", Def: "REAL NOT NULL DEFAULT 0"},
+	{Table: "sale_payments", Name: "tip_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "service_charge_bp", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "service_charge_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "tip_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "operator", Def: "TEXT"},
+	{Table: "sale_lines", Name: "open_price", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "table_id", Def: "TEXT"},
+	{Table: "sales", Name: "covers", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sales", Name: "split_ref", Def: "TEXT"},
+	{Table: "sales", Name: "split_part", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "seat", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "share", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "sale_lines", Name: "modifiers", Def: "TEXT"},
+}
+
+const saleColumns = `SELECT id, terminal, seq, receipt_no, created_at, subtotal, tax, total, change_cents, kind, refund_of, reason, discount_cents, vouchers, session_id, customer_id, points_earned, points_redeemed, rounding_cents, service_charge_bp, service_charge_cents, tip_cents, operator, table_id, covers, split_ref, split_part`
+
+func receiptNo(terminal string, seq int64) string {
+	return fmt.Sprintf("%s-%06d", terminal, seq)
+}
+
+func (j *SQLiteJournal) Record(s *Sale) error {
+	tx, err := j.db.Begin()
+	if err != nil {
+		return err
+	}
+	var seq int64
+	if err := tx.QueryRow(`INSERT INTO receipt_seq(terminal,last) VALUES(?,1)
+	  ON CONFLICT(terminal) DO UPDATE SET last=last+1 RETURNING last`, s.Terminal).Scan(&seq); err != nil {
+		tx.Rollback()
+		return err
+	}
+	no := receiptNo(s.Terminal, seq)
+	if s.Kind == "" {
+		s.Kind = KindSale
+	}
+	res, err := tx.Exec(`INSERT INTO sales(terminal,seq,receipt_no,created_at,subtotal,tax,total,change_cents,kind,refund_of,reason,discount_cents,vouchers,session_id,customer_id,
+	  points_earned,points_redeemed,rounding_cents,service_charge_bp,service_charge_cents,tip_cents,operator,table_id,covers,split_ref,split_part)
+	  VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		s.Terminal, seq, no, s.CreatedAt.UTC().Format(tsLayout), s.Subtotal, s.Tax, s.Total, s.Change,
+		s.Kind, nullIfEmpty(s.RefundOf), nullIfEmpty(s.Reason), s.Discount, nullIfEmpty(strings.Join(s.Vouchers, ",")), nullIfZero(s.SessionID), nullIfZero(s.CustomerID),
+		s.PointsEarned, s.PointsRedeemed, s.Rounding, s.ServiceChargeBP, s.ServiceCharge, s.Tip, nullIfEmpty(s.Operator), nullIfEmpty(s.Table), s.Covers,
+		nullIfEmpty(s.SplitRef), s.SplitPart)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, l := range s.Lines {
+		var mods any
+		if len(l.Modifiers) > 0 {
+			raw, _ := json.Marshal(l.Modifiers)
+			mods = string(raw)
+		}
+		if _, err := tx.Exec(`INSERT INTO sale_lines(sale_id,line_no,sku,name,qty,price_cents,image_url,note,original_price_cents,override_reason,
+		  tax_cents,total_cents,refund_of_line,restock,tax_class,tax_rate_bp,category,discount_cents,unit,barcode,batch,expiry,gift_card,open_price,seat,share,modifiers)
+		  VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+			id, l.LineNo, l.SKU, l.Name, l.Qty, l.PriceCents, nullIfEmpty(l.ImageURL), nullIfEmpty(l.Note), l.OriginalPriceCents, nullIfEmpty(l.OverrideReason),
+			l.TaxCents, l.TotalCents, l.RefundOfLine, l.Restock, nullIfEmpty(l.TaxClass), l.TaxRateBP, nullIfEmpty(l.Category), l.DiscountCents,
+			nullIfEmpty(l.Unit), nullIfEmpty(l.Barcode), nullIfEmpty(l.Batch), nullIfEmpty(l.Expiry), nullIfEmpty(l.GiftCard), l.OpenPrice, l.Seat, l.Share, mods); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for i, p := range s.Payments {
+		if _, err := tx.Exec(`INSERT INTO sale_payments(sale_id,seq,method,amount_cents,ref,currency,foreign_cents,rate,tip_cents) VALUES(?,?,?,?,?,?,?,?,?)`,
+			id, i+1, p.Method, p.AmountCents, nullIfEmpty(p.Ref), nullIfEmpty(p.Currency), p.ForeignCents, p.Rate, p.TipCents); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for i, d := range s.Discounts {
+		lines, _ := json.Marshal(d.Lines)
+		if _, err := tx.Exec(`INSERT INTO sale_discounts(sale_id,seq,promo_id,name,amount_cents,lines) VALUES(?,?,?,?,?,?)`,
+			id, i+1, d.PromoID, d.Name, d.AmountCents, string(lines)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, ledger := range s.Pending {
+		if _, err := tx.Exec(`INSERT INTO sale_pending(sale_id,ledger) VALUES(?,?)`, id, ledger); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.ID, s.Seq, s.ReceiptNo = id, seq, no
+	return nil
+}
+
+func (j *SQLiteJournal) Unposted() ([]Sale, error) {
+	rows, err := j.db.Query(saleColumns + ` FROM sales WHERE id IN (SELECT sale_id FROM sale_pending) ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return j.scanSales(rows)
+}
+
+func (j *SQLiteJournal) MarkPosted(receiptNo, ledger string) error {
+	_, err := j.db.Exec(`DELETE FROM sale_pending WHERE ledger=? AND sale_id=(SELECT id FROM sales WHERE receipt_no=?)`, ledger, receiptNo)
+	return err
+}
+
+func (j *SQLiteJournal) Get(receiptNo string) (*Sale, error) {
+	rows, err := j.db.Query(saleColumns+` FROM sales WHERE receipt_no=?`, receiptNo)
+	if err != nil {
+		return nil, err
+	}
+	out, err := j.scanSales(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrSaleNotFound
+	}
+	return &out[0], nil
+}
+
+func (j *SQLiteJournal) Refunds(receiptNo string) ([]Sale, error) {
+	rows, err := j.db.Query(saleColumns+` FROM sales WHERE kind=? AND refund_of=? ORDER BY id`, KindRefund, receiptNo)
+	if err != nil {
+		return nil, err
+	}
+	return j.scanSales(rows)
+}
+
+func (j *SQLiteJournal) BySession(id int64) ([]Sale, error) {
+	rows, err := j.db.Query(saleColumns+` FROM sales WHERE session_id=? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	return j.scanSales(rows)
+}
+
+func (j *SQLiteJournal) ByCustomer(id int64) ([]Sale, error) {
+	rows, err := j.db.Query(saleColumns+` FROM sales WHERE customer_id=? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	return j.scanSales(rows)
+}
+
+func (j *SQLiteJournal) BySplit(ref string) ([]Sale, error) {
+	rows, err := j.db.Query(saleColumns+` FROM sales WHERE split_ref=? ORDER BY split_part, id`, ref)
+	if err != nil {
+		return nil, err
+	}
+	return j.scanSales(rows)
+}
+
+func (j *SQLiteJournal) List(from, to time.Time) ([]Sale, error) {
+	rows, err := j.db.Query(saleColumns+` FROM sales WHERE created_at >= ? AND created_at < ? ORDER BY created_at, id`,
+		from.UTC().Format(tsLayout), to.UTC().Format(tsLayout))
+	if err != nil {
+		return nil, err
+	}
+	return j.scanSales(rows)
+}
+
+// scanSales reads sale headers from rows (closing them) and loads their lines and payments.
+func (j *SQLiteJournal) scanSales(rows *sql.Rows) ([]Sale, error) {
+	var out []Sale
+	for rows.Next() {
+		var s Sale
+		var at string
+		var refundOf, reason, vouchers, operator, table, splitRef sql.NullString
+		var session, customer sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.Terminal, &s.Seq, &s.ReceiptNo, &at, &s.Subtotal, &s.Tax, &s.Total, &s.Change,
+			&s.Kind, &refundOf, &reason, &s.Discount, &vouchers, &session, &customer, &s.PointsEarned, &s.PointsRedeemed, &s.Rounding, &s.ServiceChargeBP, &s.ServiceCharge, &s.Tip, &operator, &table, &s.Covers, &splitRef, &s.SplitPart); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if vouchers.String != "" {
+			s.Vouchers = strings.Split(vouchers.String, ",")
+		}
+		s.RefundOf, s.Reason, s.SessionID = refundOf.String, reason.String, session.Int64
+		s.CustomerID, s.Operator, s.Table, s.SplitRef = customer.Int64, operator.String, table.String, splitRef.String
+		s.CreatedAt, _ = time.Parse(tsLayout, at)
+		out = append(out, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if err := j.loadDetail(&out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (j *SQLiteJournal) loadDetail(s *Sale) error {
+	rows, err := j.db.Query(`SELECT line_no, sku, name, qty, price_cents, image_url, note, original_price_cents, override_reason,
+	  tax_cents, total_cents, refund_of_line, restock, tax_class, tax_rate_bp, category, discount_cents, unit, barcode, batch, expiry, gift_card, open_price, seat, share, modifiers
+	  FROM sale_lines WHERE sale_id=? ORDER BY line_no`, s.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l BasketLine
+		var img, note, reason, class, category, unit, barcode, batch, expiry, giftCard, mods sql.NullString
+		if err := rows.Scan(&l.LineNo, &l.SKU, &l.Name, &l.Qty, &l.PriceCents, &img, &note, &l.OriginalPriceCents, &reason,
+			&l.TaxCents, &l.TotalCents, &l.RefundOfLine, &l.Restock, &class, &l.TaxRateBP, &category, &l.DiscountCents,
+			&unit, &barcode, &batch, &expiry, &giftCard, &l.OpenPrice, &l.Seat, &l.Share, &mods); err != nil {
+			return err
+		}
+		if mods.String != "" {
+			_ = json.Unmarshal([]byte(mods.String), &l.Modifiers)
+		}
+		l.TaxClass, l.Category = class.String, category.String
+		l.Unit, l.Barcode, l.Batch, l.Expiry = unit.String, barcode.String, batch.String, expiry.String
+		l.GiftCard = giftCard.String
+		l.ImageURL, l.Note, l.OverrideReason = img.String, note.String, reason.String
+		s.Lines = append(s.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s.TaxBreakdown = Breakdown(s.Lines)
+	prows, err := j.db.Query(`SELECT method, amount_cents, ref, currency, foreign_cents, rate, tip_cents FROM sale_payments WHERE sale_id=? ORDER BY seq`, s.ID)
+	if err != nil {
+		return err
+	}
+	defer prows.Close()
+	for prows.Next() {
+		var p Payment
+		var ref, currency sql.NullString
+		if err := prows.Scan(&p.Method, &p.AmountCents, &ref, &currency, &p.ForeignCents, &p.Rate, &p.TipCents); err != nil {
+			return err
+		}
+		p.Ref, p.Currency = ref.String, currency.String
+		s.Payments = append(s.Payments, p)
+	}
+	if err := prows.Err(); err != nil {
+		return err
+	}
+	drows, err := j.db.Query(`SELECT promo_id, name, amount_cents, lines FROM sale_discounts WHERE sale_id=? ORDER BY seq`, s.ID)
+	if err != nil {
+		return err
+	}
+	defer drows.Close()
+	for drows.Next() {
+		var d Discount
+		var lines sql.NullString
+		if err := drows.Scan(&d.PromoID, &d.Name, &d.AmountCents, &lines); err != nil {
+			return err
+		}
+		_ = json.Unmarshal([]byte(lines.String), &d.Lines)
+		s.Discounts = append(s.Discounts, d)
+	}
+	if err := drows.Err(); err != nil {
+		return err
+	}
+	lrows, err := j.db.Query(`SELECT ledger FROM sale_pending WHERE sale_id=? ORDER BY ledger`, s.ID)
+	if err != nil {
+		return err
+	}
+	defer lrows.Close()
+	for lrows.Next() {
+		var ledger string
+		if err := lrows.Scan(&ledger); err != nil {
+			return err
+		}
+		s.Pending = append(s.Pending, ledger)
+	}
+	return lrows.Err()
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullIfZero(n int64) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package pos
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteLoyaltyLedger keeps every points movement; balances are summed
+// from it so a refund's reversal lines up with what the sale earned.
+type SQLiteLoyaltyLedger struct{ db *sql.DB }
+
+func NewSQLiteLoyaltyLedger(path string) (*SQLiteLoyaltyLedger, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS loyalty_points(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  customer_id INTEGER NOT NULL,
+	  kind TEXT NOT NULL,
+	  points INTEGER NOT NULL,
+	  receipt_no TEXT,
+	  terminal TEXT NOT NULL,
+	  created_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS loyalty_points_customer ON loyalty_points(customer_id);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteLoyaltyLedger{db: db}, nil
+}
+
+func (l *SQLiteLoyaltyLedger) Balance(customerID int64) (LoyaltyStatus, error) {
+	var st LoyaltyStatus
+	err := l.db.QueryRow(`SELECT COALESCE(SUM(points),0), COALESCE(SUM(CASE WHEN kind IN (?,?) THEN points END),0)
+	  FROM loyalty_points WHERE customer_id=?`, PointsEarn, PointsReverse, customerID).Scan(&st.Points, &st.Lifetime)
+	return st, err
+}
+
+func (l *SQLiteLoyaltyLedger) Post(entries []PointsEntry) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.ReceiptNo != "" {
+			var n int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM loyalty_points WHERE receipt_no=? AND customer_id=? AND kind=?`,
+				e.ReceiptNo, e.CustomerID, e.Kind).Scan(&n); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if n > 0 {
+				continue
+			}
+		}
+		// the guard makes the balance the arbiter between tills
+		res, err := tx.Exec(`INSERT INTO loyalty_points(customer_id,kind,points,receipt_no,terminal,created_at)
+		  SELECT ?,?,?,?,?,? WHERE ? <> ? OR (SELECT COALESCE(SUM(points),0) FROM loyalty_points WHERE customer_id=?) + ? >= 0`,
+			e.CustomerID, e.Kind, e.Points, nullIfEmpty(e.ReceiptNo), e.Terminal, e.CreatedAt.UTC().Format(tsLayout),
+			e.Kind, PointsRedeem, e.CustomerID, e.Points)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			tx.Rollback()
+			return ErrPointsBalance
+		}
+	}
+	return tx.Commit()
+}
+
+func (l *SQLiteLoyaltyLedger) Entries(customerID int64) ([]PointsEntry, error) {
+	rows, err := l.db.Query(`SELECT id, customer_id, kind, points, receipt_no, terminal, created_at
+	  FROM loyalty_points WHERE customer_id=? ORDER BY id`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PointsEntry
+	for rows.Next() {
+		var e PointsEntry
+		var receipt sql.NullString
+		var at string
+		if err := rows.Scan(&e.ID, &e.CustomerID, &e.Kind, &e.Points, &receipt, &e.Terminal, &at); err != nil {
+			return nil, err
+		}
+		e.ReceiptNo = receipt.String
+		e.CreatedAt, _ = time.Parse(tsLayout, at)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
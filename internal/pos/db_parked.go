@@ -0,0 +1,98 @@
+package pos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteParkStore keeps parked baskets in the edge database so they
+// survive a restart and can be recalled from any till sharing it.
+type SQLiteParkStore struct{ db *sql.DB }
+
+func NewSQLiteParkStore(path string) (*SQLiteParkStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS parked_baskets(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  label TEXT,
+	  terminal TEXT NOT NULL,
+	  parked_at TEXT NOT NULL,
+	  expires_at TEXT NOT NULL,
+	  basket TEXT NOT NULL
+	);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteParkStore{db: db}, nil
+}
+
+func (s *SQLiteParkStore) Park(p ParkedBasket) (ParkedBasket, error) {
+	b, err := json.Marshal(p.Basket)
+	if err != nil {
+		return ParkedBasket{}, err
+	}
+	// timestamps are stored to the second, so hand back what was stored
+	p.ParkedAt, p.ExpiresAt = p.ParkedAt.UTC().Truncate(time.Second), p.ExpiresAt.UTC().Truncate(time.Second)
+	res, err := s.db.Exec(`INSERT INTO parked_baskets(label,terminal,parked_at,expires_at,basket) VALUES(?,?,?,?,?)`,
+		nullIfEmpty(p.Label), p.Terminal, p.ParkedAt.Format(tsLayout), p.ExpiresAt.Format(tsLayout), string(b))
+	if err != nil {
+		return ParkedBasket{}, err
+	}
+	p.ID, err = res.LastInsertId()
+	return p, err
+}
+
+// Recall deletes and returns the basket in one statement, so two tills
+// recalling it at once can't both get it.
+func (s *SQLiteParkStore) Recall(id int64, at time.Time) (ParkedBasket, error) {
+	p, err := scanParked(s.db.QueryRow(`DELETE FROM parked_baskets WHERE id=? AND expires_at>?
+	  RETURNING id, label, terminal, parked_at, expires_at, basket`, id, at.UTC().Format(tsLayout)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ParkedBasket{}, ErrParkedNotFound
+	}
+	return p, err
+}
+
+// List returns the unexpired baskets, clearing out expired ones first.
+func (s *SQLiteParkStore) List(at time.Time) ([]ParkedBasket, error) {
+	ts := at.UTC().Format(tsLayout)
+	if _, err := s.db.Exec(`DELETE FROM parked_baskets WHERE expires_at<=?`, ts); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT id, label, terminal, parked_at, expires_at, basket FROM parked_baskets ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ParkedBasket
+	for rows.Next() {
+		p, err := scanParked(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func scanParked(row interface{ Scan(...any) error }) (ParkedBasket, error) {
+	var p ParkedBasket
+	var label sql.NullString
+	var parked, expires, basket string
+	if err := row.Scan(&p.ID, &label, &p.Terminal, &parked, &expires, &basket); err != nil {
+		return ParkedBasket{}, err
+	}
+	if err := json.Unmarshal([]byte(basket), &p.Basket); err != nil {
+		return ParkedBasket{}, err
+	}
+	p.Label = label.String
+	p.ParkedAt, _ = time.Parse(tsLayout, parked)
+	p.ExpiresAt, _ = time.Parse(tsLayout, expires)
+	return p, nil
+}
@@ -0,0 +1,125 @@
+package pos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLitePromotionStore keeps promotion rules as JSON rows and serves them
+// to the till from memory, so applying promotions never touches the disk.
+type SQLitePromotionStore struct {
+	db *sql.DB
+
+	mu     sync.RWMutex
+	promos []Promotion
+}
+
+func NewSQLitePromotionStore(path string) (*SQLitePromotionStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS promotions(
+	  id TEXT PRIMARY KEY,
+	  rule TEXT NOT NULL
+	);`); err != nil {
+		return nil, err
+	}
+	s := &SQLitePromotionStore{db: db}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLitePromotionStore) load() error {
+	rows, err := s.db.Query(`SELECT rule FROM promotions ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var out []Promotion
+	for rows.Next() {
+		var rule string
+		if err := rows.Scan(&rule); err != nil {
+			return err
+		}
+		var p Promotion
+		if err := json.Unmarshal([]byte(rule), &p); err != nil {
+			return err
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.promos = out
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns every rule, including ones outside their validity window.
+func (s *SQLitePromotionStore) List() []Promotion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Promotion(nil), s.promos...)
+}
+
+func (s *SQLitePromotionStore) Active(at time.Time) []Promotion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Promotion
+	for _, p := range s.promos {
+		if p.ActiveAt(at) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Save adds or replaces the rule with p.ID.
+func (s *SQLitePromotionStore) Save(p Promotion) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.Exec(`INSERT INTO promotions(id,rule) VALUES(?,?)
+	  ON CONFLICT(id) DO UPDATE SET rule=excluded.rule`, p.ID, string(b)); err != nil {
+		return err
+	}
+	i := sort.Search(len(s.promos), func(i int) bool { return s.promos[i].ID >= p.ID })
+	if i < len(s.promos) && s.promos[i].ID == p.ID {
+		s.promos[i] = p
+		return nil
+	}
+	s.promos = append(s.promos, Promotion{})
+	copy(s.promos[i+1:], s.promos[i:])
+	s.promos[i] = p
+	return nil
+}
+
+func (s *SQLitePromotionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.Exec(`DELETE FROM promotions WHERE id=?`, id); err != nil {
+		return err
+	}
+	for i, p := range s.promos {
+		if p.ID == id {
+			s.promos = append(s.promos[:i], s.promos[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
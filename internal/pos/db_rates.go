@@ -0,0 +1,79 @@
+package pos
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteRateStore keeps the exchange rate table, one row per currency.
+type SQLiteRateStore struct{ db *sql.DB }
+
+func NewSQLiteRateStore(path string) (*SQLiteRateStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS exchange_rates(
+	  currency TEXT PRIMARY KEY,
+	  rate REAL NOT NULL,
+	  override REAL NOT NULL DEFAULT 0,
+	  updated_at TEXT NOT NULL
+	);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteRateStore{db: db}, nil
+}
+
+func (s *SQLiteRateStore) Get(currency string) (ExchangeRate, error) {
+	r := ExchangeRate{Currency: currency}
+	var at string
+	err := s.db.QueryRow(`SELECT rate, override, updated_at FROM exchange_rates WHERE currency=?`, currency).Scan(&r.Rate, &r.Override, &at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ExchangeRate{}, ErrNoRate
+	}
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	r.UpdatedAt, _ = time.Parse(tsLayout, at)
+	return r, nil
+}
+
+func (s *SQLiteRateStore) List() ([]ExchangeRate, error) {
+	rows, err := s.db.Query(`SELECT currency, rate, override, updated_at FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ExchangeRate
+	for rows.Next() {
+		var r ExchangeRate
+		var at string
+		if err := rows.Scan(&r.Currency, &r.Rate, &r.Override, &at); err != nil {
+			return nil, err
+		}
+		r.UpdatedAt, _ = time.Parse(tsLayout, at)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Save adds or replaces the rate for r.Currency, stamping it now.
+func (s *SQLiteRateStore) Save(r ExchangeRate) error {
+	r.Currency = NormalizeCurrency(r.Currency)
+	if err := ValidateExchangeRate(r); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO exchange_rates(currency,rate,override,updated_at) VALUES(?,?,?,?)
+	  ON CONFLICT(currency) DO UPDATE SET rate=excluded.rate, override=excluded.override, updated_at=excluded.updated_at`,
+		r.Currency, r.Rate, r.Override, time.Now().UTC().Format(tsLayout))
+	return err
+}
+
+func (s *SQLiteRateStore) Delete(currency string) error {
+	_, err := s.db.Exec(`DELETE FROM exchange_rates WHERE currency=?`, NormalizeCurrency(currency))
+	return err
+}
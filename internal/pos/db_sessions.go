@@ -0,0 +1,200 @@
+package pos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/universaltill/universal-till/internal/common"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteSessionStore keeps till sessions and cash movements in the edge
+// database.
+type SQLiteSessionStore struct{ db *sql.DB }
+
+func NewSQLiteSessionStore(path string) (*SQLiteSessionStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS till_sessions(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  terminal TEXT NOT NULL,
+	  float_cents INTEGER NOT NULL,
+	  opened_at TEXT NOT NULL,
+	  closed_at TEXT,
+	  counted TEXT
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS till_sessions_open ON till_sessions(terminal) WHERE closed_at IS NULL;
+	CREATE TABLE IF NOT EXISTS cash_movements(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  session_id INTEGER NOT NULL REFERENCES till_sessions(id),
+	  kind TEXT NOT NULL,
+	  amount_cents INTEGER NOT NULL,
+	  reason TEXT,
+	  created_at TEXT NOT NULL
+	);`); err != nil {
+		return nil, err
+	}
+	if err := common.AddColumns(db, sessionStoreColumns); err != nil {
+		return nil, err
+	}
+	return &SQLiteSessionStore{db: db}, nil
+}
+
+// sessionStoreColumns were added after the tables first shipped.
+var sessionStoreColumns = []common.Column{
+	{Table: "till_sessions", Name: "denominations", Def: "TEXT"},
+	{Table: "till_sessions", Name: "expected", Def: "TEXT"},
+	{Table: "till_sessions", Name: "variance_cents", Def: "INTEGER NOT NULL DEFAULT 0"},
+}
+
+const sessionColumns = `SELECT id, terminal, float_cents, opened_at, closed_at, counted, denominations, expected, variance_cents FROM till_sessions`
+
+func scanSession(row interface{ Scan(...any) error }) (Session, error) {
+	var s Session
+	var opened string
+	var closed, counted, denoms, expected sql.NullString
+	if err := row.Scan(&s.ID, &s.Terminal, &s.FloatCents, &opened, &closed, &counted, &denoms, &expected, &s.VarianceCents); err != nil {
+		return Session{}, err
+	}
+	s.OpenedAt, _ = time.Parse(tsLayout, opened)
+	if closed.Valid {
+		s.ClosedAt, _ = time.Parse(tsLayout, closed.String)
+	}
+	for _, f := range []struct {
+		col sql.NullString
+		v   any
+	}{{counted, &s.Counted}, {denoms, &s.Denominations}, {expected, &s.Expected}} {
+		if f.col.Valid {
+			if err := json.Unmarshal([]byte(f.col.String), f.v); err != nil {
+				return Session{}, err
+			}
+		}
+	}
+	return s, nil
+}
+
+func (st *SQLiteSessionStore) Open(s Session) (Session, error) {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return Session{}, err
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM till_sessions WHERE terminal=? AND closed_at IS NULL`, s.Terminal).Scan(&n); err != nil {
+		return Session{}, err
+	}
+	if n > 0 {
+		return Session{}, ErrTillOpen
+	}
+	s.OpenedAt = s.OpenedAt.UTC().Truncate(time.Second)
+	res, err := tx.Exec(`INSERT INTO till_sessions(terminal,float_cents,opened_at) VALUES(?,?,?)`,
+		s.Terminal, s.FloatCents, s.OpenedAt.Format(tsLayout))
+	if err != nil {
+		return Session{}, err
+	}
+	if s.ID, err = res.LastInsertId(); err != nil {
+		return Session{}, err
+	}
+	return s, tx.Commit()
+}
+
+func (st *SQLiteSessionStore) Current(terminal string) (Session, error) {
+	s, err := scanSession(st.db.QueryRow(sessionColumns+` WHERE terminal=? AND closed_at IS NULL`, terminal))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrTillClosed
+	}
+	return s, err
+}
+
+func (st *SQLiteSessionStore) Get(id int64) (Session, error) {
+	s, err := scanSession(st.db.QueryRow(sessionColumns+` WHERE id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionGone
+	}
+	return s, err
+}
+
+func (st *SQLiteSessionStore) List(from, to time.Time) ([]Session, error) {
+	rows, err := st.db.Query(sessionColumns+` WHERE opened_at >= ? AND opened_at < ? ORDER BY opened_at, id`,
+		from.UTC().Format(tsLayout), to.UTC().Format(tsLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (st *SQLiteSessionStore) Close(s Session) error {
+	counted, err := json.Marshal(s.Counted)
+	if err != nil {
+		return err
+	}
+	expected, err := json.Marshal(s.Expected)
+	if err != nil {
+		return err
+	}
+	var denoms any
+	if s.Denominations != nil {
+		b, err := json.Marshal(s.Denominations)
+		if err != nil {
+			return err
+		}
+		denoms = string(b)
+	}
+	res, err := st.db.Exec(`UPDATE till_sessions SET closed_at=?, counted=?, denominations=?, expected=?, variance_cents=?
+	  WHERE id=? AND closed_at IS NULL`,
+		s.ClosedAt.UTC().Format(tsLayout), string(counted), denoms, string(expected), s.VarianceCents, s.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTillClosed
+	}
+	return nil
+}
+
+func (st *SQLiteSessionStore) AddMovement(m CashMovement) (CashMovement, error) {
+	m.At = m.At.UTC().Truncate(time.Second)
+	res, err := st.db.Exec(`INSERT INTO cash_movements(session_id,kind,amount_cents,reason,created_at) VALUES(?,?,?,?,?)`,
+		m.SessionID, m.Kind, m.AmountCents, nullIfEmpty(m.Reason), m.At.Format(tsLayout))
+	if err != nil {
+		return CashMovement{}, err
+	}
+	m.ID, err = res.LastInsertId()
+	return m, err
+}
+
+func (st *SQLiteSessionStore) Movements(sessionID int64) ([]CashMovement, error) {
+	rows, err := st.db.Query(`SELECT id, session_id, kind, amount_cents, reason, created_at FROM cash_movements
+	  WHERE session_id=? ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []CashMovement
+	for rows.Next() {
+		var m CashMovement
+		var reason sql.NullString
+		var at string
+		if err := rows.Scan(&m.ID, &m.SessionID, &m.Kind, &m.AmountCents, &reason, &at); err != nil {
+			return nil, err
+		}
+		m.Reason = reason.String
+		m.At, _ = time.Parse(tsLayout, at)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
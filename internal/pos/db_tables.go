@@ -0,0 +1,121 @@
+package pos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteTableStore keeps the floor plan and open tabs in the edge
+// database, so tabs outlive a restart and every till sharing it sees them.
+type SQLiteTableStore struct{ db *sql.DB }
+
+func NewSQLiteTableStore(path string) (*SQLiteTableStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS floor_tables(
+	  id TEXT PRIMARY KEY,
+	  name TEXT,
+	  seats INTEGER NOT NULL DEFAULT 0,
+	  x INTEGER NOT NULL DEFAULT 0,
+	  y INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS tabs(
+	  table_id TEXT PRIMARY KEY,
+	  opened_at TEXT NOT NULL,
+	  updated_at TEXT NOT NULL,
+	  basket TEXT NOT NULL
+	);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteTableStore{db: db}, nil
+}
+
+func (s *SQLiteTableStore) Tables() ([]Table, error) {
+	rows, err := s.db.Query(`SELECT id, name, seats, x, y FROM floor_tables ORDER BY y, x, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Table
+	for rows.Next() {
+		var t Table
+		var name sql.NullString
+		if err := rows.Scan(&t.ID, &name, &t.Seats, &t.X, &t.Y); err != nil {
+			return nil, err
+		}
+		t.Name = name.String
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteTableStore) SaveTable(t Table) error {
+	_, err := s.db.Exec(`INSERT INTO floor_tables(id,name,seats,x,y) VALUES(?,?,?,?,?)
+	  ON CONFLICT(id) DO UPDATE SET name=excluded.name, seats=excluded.seats, x=excluded.x, y=excluded.y`,
+		t.ID, nullIfEmpty(t.Name), t.Seats, t.X, t.Y)
+	return err
+}
+
+func (s *SQLiteTableStore) DeleteTable(id string) error {
+	_, err := s.db.Exec(`DELETE FROM floor_tables WHERE id=?`, id)
+	return err
+}
+
+func (s *SQLiteTableStore) Tab(table string) (Basket, error) {
+	var raw string
+	err := s.db.QueryRow(`SELECT basket FROM tabs WHERE table_id=?`, table).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Basket{}, nil
+	}
+	if err != nil {
+		return Basket{}, err
+	}
+	var b Basket
+	err = json.Unmarshal([]byte(raw), &b)
+	return b, err
+}
+
+// SaveTab writes the tab, keeping when it was first opened.
+func (s *SQLiteTableStore) SaveTab(table string, b Basket) error {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO tabs(table_id,opened_at,updated_at,basket) VALUES(?,?,?,?)
+	  ON CONFLICT(table_id) DO UPDATE SET updated_at=excluded.updated_at, basket=excluded.basket`,
+		table, b.OpenedAt.UTC().Format(tsLayout), time.Now().UTC().Format(tsLayout), string(raw))
+	return err
+}
+
+func (s *SQLiteTableStore) DeleteTab(table string) error {
+	_, err := s.db.Exec(`DELETE FROM tabs WHERE table_id=?`, table)
+	return err
+}
+
+func (s *SQLiteTableStore) Tabs() ([]Basket, error) {
+	rows, err := s.db.Query(`SELECT basket FROM tabs ORDER BY opened_at, table_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Basket
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var b Basket
+		if err := json.Unmarshal([]byte(raw), &b); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
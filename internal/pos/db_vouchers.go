@@ -0,0 +1,160 @@
+package pos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var ErrVoucherCode = errors.New("voucher code is required and may not contain commas or spaces")
+
+// SQLiteVoucherStore keeps voucher codes and every redemption. Uses are
+// counted in the database so a code can't be spent twice across tills.
+type SQLiteVoucherStore struct{ db *sql.DB }
+
+func NewSQLiteVoucherStore(path string) (*SQLiteVoucherStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS vouchers(
+	  code TEXT PRIMARY KEY,
+	  name TEXT NOT NULL,
+	  discount TEXT NOT NULL,
+	  max_uses INTEGER NOT NULL DEFAULT 0,
+	  uses INTEGER NOT NULL DEFAULT 0,
+	  min_spend_cents INTEGER NOT NULL DEFAULT 0,
+	  expires_at TEXT
+	);
+	CREATE TABLE IF NOT EXISTS voucher_redemptions(
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  code TEXT NOT NULL REFERENCES vouchers(code),
+	  terminal TEXT NOT NULL,
+	  redeemed_at TEXT NOT NULL
+	);`); err != nil {
+		return nil, err
+	}
+	return &SQLiteVoucherStore{db: db}, nil
+}
+
+const voucherColumns = `SELECT code, name, discount, max_uses, uses, min_spend_cents, expires_at FROM vouchers`
+
+func scanVoucher(row interface{ Scan(...any) error }) (Voucher, error) {
+	var v Voucher
+	var discount string
+	var expires sql.NullString
+	if err := row.Scan(&v.Code, &v.Name, &discount, &v.MaxUses, &v.Uses, &v.MinSpendCents, &expires); err != nil {
+		return Voucher{}, err
+	}
+	if err := json.Unmarshal([]byte(discount), &v.Discount); err != nil {
+		return Voucher{}, err
+	}
+	if expires.Valid {
+		v.Expires, _ = time.Parse(tsLayout, expires.String)
+	}
+	return v, nil
+}
+
+func (s *SQLiteVoucherStore) Lookup(code string) (Voucher, error) {
+	v, err := scanVoucher(s.db.QueryRow(voucherColumns+` WHERE code=?`, NormalizeVoucherCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Voucher{}, ErrVoucherNotFound
+	}
+	return v, err
+}
+
+func (s *SQLiteVoucherStore) List() ([]Voucher, error) {
+	rows, err := s.db.Query(voucherColumns + ` ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Voucher
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// Save adds or updates a voucher; its use count is left alone.
+func (s *SQLiteVoucherStore) Save(v Voucher) error {
+	v.Code = NormalizeVoucherCode(v.Code)
+	if v.Code == "" || strings.ContainsAny(v.Code, ", \t") {
+		return ErrVoucherCode
+	}
+	d := v.Discount
+	d.ID = v.Code
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(v.Discount)
+	if err != nil {
+		return err
+	}
+	var expires any
+	if !v.Expires.IsZero() {
+		expires = v.Expires.UTC().Format(tsLayout)
+	}
+	_, err = s.db.Exec(`INSERT INTO vouchers(code,name,discount,max_uses,min_spend_cents,expires_at) VALUES(?,?,?,?,?,?)
+	  ON CONFLICT(code) DO UPDATE SET name=excluded.name, discount=excluded.discount, max_uses=excluded.max_uses,
+	    min_spend_cents=excluded.min_spend_cents, expires_at=excluded.expires_at`,
+		v.Code, v.Name, string(b), v.MaxUses, v.MinSpendCents, expires)
+	return err
+}
+
+func (s *SQLiteVoucherStore) Redeem(codes []string, terminal string, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	ts := at.UTC().Format(tsLayout)
+	for _, code := range codes {
+		// the guard makes the use count the arbiter between tills
+		res, err := tx.Exec(`UPDATE vouchers SET uses=uses+1
+		  WHERE code=? AND (max_uses=0 OR uses<max_uses) AND (expires_at IS NULL OR expires_at>?)`, code, ts)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			tx.Rollback()
+			if v, err := s.Lookup(code); err == nil && v.Usable(at) == ErrVoucherExpired {
+				return ErrVoucherExpired
+			}
+			return ErrVoucherUsed
+		}
+		if _, err := tx.Exec(`INSERT INTO voucher_redemptions(code,terminal,redeemed_at) VALUES(?,?,?)`, code, terminal, ts); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteVoucherStore) Release(codes []string, terminal string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec(`UPDATE vouchers SET uses=uses-1 WHERE code=? AND uses>0`, code); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM voucher_redemptions WHERE id=(
+		  SELECT MAX(id) FROM voucher_redemptions WHERE code=? AND terminal=?)`, code, terminal); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
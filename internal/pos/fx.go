@@ -0,0 +1,108 @@
+package pos
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoRate        = errors.New("no exchange rate for that currency")
+	ErrRateCurrency  = errors.New("currency must be a three-letter code")
+	ErrRateValue     = errors.New("exchange rate must be more than zero")
+	ErrForeignTender = errors.New("foreign currency can only be taken as cash")
+)
+
+// ExchangeRate converts a foreign currency into the base currency the
+// till prices in. Both currencies are counted in hundredths.
+type ExchangeRate struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"` // base units per unit of Currency
+	// Override, when set, is used instead of Rate until it is cleared
+	Override  float64   `json:"override,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Effective returns the rate tenders are taken at.
+func (r ExchangeRate) Effective() float64 {
+	if r.Override > 0 {
+		return r.Override
+	}
+	return r.Rate
+}
+
+// ExchangeRates is the locally maintained rate table.
+type ExchangeRates interface {
+	// Get returns the rate for currency, or ErrNoRate.
+	Get(currency string) (ExchangeRate, error)
+	List() ([]ExchangeRate, error)
+	Save(r ExchangeRate) error
+	Delete(currency string) error
+}
+
+// NormalizeCurrency upper-cases a currency code and trims it.
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidateExchangeRate checks a rate before it is saved.
+func ValidateExchangeRate(r ExchangeRate) error {
+	if len(r.Currency) != 3 {
+		return ErrRateCurrency
+	}
+	for _, c := range r.Currency {
+		if c < 'A' || c > 'Z' {
+			return ErrRateCurrency
+		}
+	}
+	if r.Rate <= 0 || r.Override < 0 || math.IsInf(r.Rate, 0) || math.IsInf(r.Override, 0) {
+		return ErrRateValue
+	}
+	return nil
+}
+
+// SetBaseCurrency sets the currency baskets are priced in; tenders in it
+// need no exchange rate.
+func (s *Service) SetBaseCurrency(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currency = NormalizeCurrency(code)
+}
+
+func (s *Service) baseCurrency() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.currency
+}
+
+// ExchangeRate returns the rate for a foreign currency.
+func (s *Service) ExchangeRate(currency string) (ExchangeRate, error) {
+	if s.cfg.Rates == nil {
+		return ExchangeRate{}, ErrNoRate
+	}
+	return s.cfg.Rates.Get(NormalizeCurrency(currency))
+}
+
+// toBase converts a foreign amount at rate, to the nearest hundredth.
+func toBase(foreign int64, rate float64) int64 {
+	return int64(math.Round(float64(foreign) * rate))
+}
+
+// foreignFor is the least foreign amount worth at least base at rate.
+func foreignFor(base int64, rate float64) int64 {
+	f := int64(math.Ceil(float64(base)/rate - 1e-9))
+	for toBase(f, rate) < base {
+		f++
+	}
+	return f
+}
+
+// TenderKey names the drawer a payment goes into: the method, with the
+// currency for foreign cash (e.g. "cash:EUR").
+func TenderKey(p Payment) string {
+	if p.Currency == "" {
+		return p.Method
+	}
+	return p.Method + ":" + p.Currency
+}
@@ -0,0 +1,67 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestForeignCashTender(t *testing.T) {
+	items := mapResolver{"A": {SKU: "A", Name: "A", Qty: 1, PriceCents: 1000}}
+	f := newFixture(t)
+	j, rates := f.journal, f.rates
+	if err := rates.Save(ExchangeRate{Currency: "eur", Rate: 0.85}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := rates.Save(ExchangeRate{Currency: "EURO", Rate: 1}); !errors.Is(err, ErrRateCurrency) {
+		t.Fatalf("bad currency err = %v", err)
+	}
+	s := NewServiceWithResolver(Config{Journal: j, Rates: rates, Tax: PercentTaxEngine{}}, items)
+	s.SetBaseCurrency("GBP")
+
+	// change comes back in pounds; both amounts are kept
+	_, _ = s.Scan("T1", "A")
+	if _, err := s.TenderPayment("T1", Payment{Method: MethodCard, Currency: "EUR"}); !errors.Is(err, ErrForeignTender) {
+		t.Fatalf("foreign card err = %v", err)
+	}
+	if _, err := s.TenderPayment("T1", Payment{Method: MethodCash, Currency: "USD", ForeignCents: 2000}); !errors.Is(err, ErrNoRate) {
+		t.Fatalf("no rate err = %v", err)
+	}
+	sale, err := s.TenderPayment("T1", Payment{Method: MethodCash, Currency: "EUR", ForeignCents: 2000})
+	if err != nil || sale == nil || sale.Change != 700 {
+		t.Fatalf("euro sale = %+v, %v", sale, err)
+	}
+	got, _ := j.Get(sale.ReceiptNo)
+	if p := got.Payments[0]; p.Currency != "EUR" || p.ForeignCents != 2000 || p.Rate != 0.85 || p.AmountCents != 1700 {
+		t.Fatalf("journalled payment = %+v", p)
+	}
+
+	// no amount takes enough euros to cover the balance, at the override
+	if err := rates.Save(ExchangeRate{Currency: "EUR", Rate: 0.85, Override: 0.8}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = s.Scan("T2", "A")
+	exact, err := s.TenderPayment("T2", Payment{Method: MethodCash, Currency: "EUR"})
+	if err != nil || exact == nil || exact.Payments[0].ForeignCents != 1250 || exact.Change != 0 {
+		t.Fatalf("exact euro sale = %+v, %v", exact, err)
+	}
+	_, _ = s.Scan("T3", "A")
+	if base, _ := s.TenderPayment("T3", Payment{Method: MethodCash, Currency: "gbp", AmountCents: 1000}); base == nil || base.Payments[0].Currency != "" {
+		t.Fatalf("base currency sale = %+v", base)
+	}
+
+	// refunds are paid in pounds
+	r, err := s.Refund("T1", RefundRequest{ReceiptNo: sale.ReceiptNo})
+	if err != nil || len(r.Payments) != 1 || r.Payments[0].Currency != "" || r.Payments[0].AmountCents != -1000 {
+		t.Fatalf("refund = %+v, %v", r, err)
+	}
+
+	rep := BuildSessionReport(ReportX, Session{}, []Sale{*sale, *exact}, nil)
+	for _, tt := range rep.Tenders {
+		if tt.Method == "cash:EUR" && (tt.Currency != "EUR" || tt.Expected != 3250) {
+			t.Fatalf("euro tender = %+v", tt)
+		}
+		if tt.Method == MethodCash && tt.Expected != -700 {
+			t.Fatalf("cash tender = %+v", tt)
+		}
+	}
+}
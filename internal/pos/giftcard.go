@@ -0,0 +1,287 @@
+package pos
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// MethodGiftCard pays from the gift card named by the payment's Ref.
+	MethodGiftCard = "giftcard"
+	// GiftCardSKU is the SKU of gift card issue and top-up lines.
+	GiftCardSKU = "GIFTCARD"
+)
+
+// Gift card ledger entry kinds. Issues, top-ups and refunds onto the card
+// add to its balance; redemptions and cancellations take from it.
+const (
+	GiftCardIssue  = "issue"
+	GiftCardTopUp  = "topup"
+	GiftCardRedeem = "redeem"
+	GiftCardRefund = "refund" // a refunded sale paid back onto the card
+	GiftCardCancel = "cancel" // the card's own sale refunded
+)
+
+var (
+	ErrNoGiftCards      = errors.New("gift cards need a gift card store")
+	ErrGiftCardNotFound = errors.New("gift card not found")
+	ErrGiftCardNumber   = errors.New("gift card numbers are 6 to 32 letters or digits")
+	ErrGiftCardAmount   = errors.New("gift card amount must be positive")
+	ErrGiftCardExpired  = errors.New("gift card has expired")
+	ErrGiftCardBalance  = errors.New("not enough left on the gift card")
+	ErrGiftCardSpent    = errors.New("gift card has been spent and can't be refunded in full")
+)
+
+// GiftCard is a card's state; the balance is summed from its ledger.
+type GiftCard struct {
+	Number       string    `json:"number"`
+	BalanceCents int64     `json:"balanceCents"`
+	IssuedAt     time.Time `json:"issuedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"` // zero never expires
+}
+
+// Expired reports whether the card can no longer be spent at t.
+func (g GiftCard) Expired(t time.Time) bool {
+	return !g.ExpiresAt.IsZero() && !t.Before(g.ExpiresAt)
+}
+
+// GiftCardEntry is one movement on a card; AmountCents is signed.
+type GiftCardEntry struct {
+	ID          int64     `json:"id"`
+	Number      string    `json:"number"`
+	Kind        string    `json:"kind"`
+	AmountCents int64     `json:"amountCents"`
+	ReceiptNo   string    `json:"receiptNo,omitempty"`
+	Terminal    string    `json:"terminal"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// ExpiresAt is the card's new expiry, set by issues and top-ups
+	ExpiresAt time.Time `json:"-"`
+}
+
+// GiftCards keeps cards and their ledger; see SQLiteGiftCardStore.
+type GiftCards interface {
+	Lookup(number string) (GiftCard, error)
+	// Post writes entries all or none. Issues create the card and top-ups
+	// move its expiry; redemptions and cancellations fail with
+	// ErrGiftCardBalance rather than overdraw, and redemptions with
+	// ErrGiftCardExpired once the card has expired. An entry whose receipt
+	// already has one of its kind on the card is skipped, an issue and a
+	// top-up counting as the same kind, so a sale can be posted again.
+	Post(entries []GiftCardEntry) error
+	Entries(number string) ([]GiftCardEntry, error)
+}
+
+// NormalizeGiftCardNumber upper-cases a typed or scanned number and drops
+// spaces and dashes.
+func NormalizeGiftCardNumber(number string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(number)))
+}
+
+func validGiftCardNumber(n string) bool {
+	if len(n) < 6 || len(n) > 32 {
+		return false
+	}
+	for i := 0; i < len(n); i++ {
+		if c := n[i]; (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// GiftCard returns the card for a balance enquiry.
+func (s *Service) GiftCard(number string) (GiftCard, error) {
+	if s.cfg.GiftCards == nil {
+		return GiftCard{}, ErrNoGiftCards
+	}
+	return s.cfg.GiftCards.Lookup(NormalizeGiftCardNumber(number))
+}
+
+// GiftCardStatement returns the card's ledger, oldest first.
+func (s *Service) GiftCardStatement(number string) ([]GiftCardEntry, error) {
+	if s.cfg.GiftCards == nil {
+		return nil, ErrNoGiftCards
+	}
+	return s.cfg.GiftCards.Entries(NormalizeGiftCardNumber(number))
+}
+
+// SellGiftCard adds a line issuing a new card, or topping up an existing
+// one, for amount. The card is only loaded once the sale is paid. Gift
+// card lines are outside the scope of tax and promotions.
+func (s *Service) SellGiftCard(terminal, number string, amount int64) (*Basket, error) {
+	if s.cfg.GiftCards == nil {
+		return nil, ErrNoGiftCards
+	}
+	number = NormalizeGiftCardNumber(number)
+	if !validGiftCardNumber(number) {
+		return nil, ErrGiftCardNumber
+	}
+	if amount <= 0 {
+		return nil, ErrGiftCardAmount
+	}
+	name := "Gift card " + maskGiftCard(number)
+	switch g, err := s.cfg.GiftCards.Lookup(number); {
+	case err == nil && g.Expired(s.now()):
+		return nil, ErrGiftCardExpired
+	case err == nil:
+		name = "Gift card top-up " + maskGiftCard(number)
+	case !errors.Is(err, ErrGiftCardNotFound):
+		return nil, err
+	}
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		b.Lines = append(b.Lines, BasketLine{LineNo: b.nextLineNo(), SKU: GiftCardSKU, Name: name, Qty: 1,
+			PriceCents: amount, TaxClass: TaxOutside, GiftCard: number})
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// maskGiftCard shows only the last four characters of a card number.
+func maskGiftCard(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return "…" + number[len(number)-4:]
+}
+
+// redeemGiftCard takes a payment off the card straight away, so two tills
+// can't spend the same balance. Unless exact, the payment is cut down to
+// what is left on the card.
+func (s *Service) redeemGiftCard(terminal, number string, amount int64, exact bool) (int64, error) {
+	if s.cfg.GiftCards == nil {
+		return 0, ErrNoGiftCards
+	}
+	g, err := s.cfg.GiftCards.Lookup(number)
+	if err != nil {
+		return 0, err
+	}
+	if g.Expired(s.now()) {
+		return 0, ErrGiftCardExpired
+	}
+	if !exact {
+		amount = min(amount, g.BalanceCents)
+	}
+	if amount <= 0 || amount > g.BalanceCents {
+		return 0, ErrGiftCardBalance
+	}
+	err = s.cfg.GiftCards.Post([]GiftCardEntry{{Number: number, Kind: GiftCardRedeem, AmountCents: -amount,
+		Terminal: terminal, CreatedAt: s.now()}})
+	if err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+// unredeemGiftCard puts back a redemption whose payment then failed or
+// was voided.
+func (s *Service) unredeemGiftCard(terminal, number string, amount int64) error {
+	if amount == 0 || s.cfg.GiftCards == nil {
+		return nil
+	}
+	return s.cfg.GiftCards.Post([]GiftCardEntry{{Number: number, Kind: GiftCardRefund, AmountCents: amount,
+		Terminal: terminal, CreatedAt: s.now()}})
+}
+
+// checkGiftCardRefund refuses to refund a gift card line whose card no
+// longer holds what is being given back.
+func (s *Service) checkGiftCardRefund(refund *Sale) error {
+	for _, l := range refund.Lines {
+		if l.GiftCard == "" || s.cfg.GiftCards == nil {
+			continue
+		}
+		g, err := s.cfg.GiftCards.Lookup(l.GiftCard)
+		if err != nil {
+			return err
+		}
+		if g.BalanceCents < -l.TotalCents {
+			return ErrGiftCardSpent
+		}
+	}
+	return nil
+}
+
+// postGiftCards loads the cards a journalled sale sold, or for a refund
+// cancels the cards it returned and pays gift card tenders back onto
+// their cards. Redemptions were posted as they were tendered.
+func (s *Service) postGiftCards(sale *Sale) error {
+	if s.cfg.GiftCards == nil {
+		return nil
+	}
+	var entries []GiftCardEntry
+	add := func(number, kind string, amount int64) {
+		for i := range entries {
+			// one entry per card and kind, as the ledger keys them by receipt
+			if entries[i].Number == number && entries[i].Kind == kind {
+				entries[i].AmountCents += amount
+				return
+			}
+		}
+		e := GiftCardEntry{Number: number, Kind: kind, AmountCents: amount, ReceiptNo: sale.ReceiptNo,
+			Terminal: sale.Terminal, CreatedAt: sale.CreatedAt}
+		if kind == GiftCardIssue || kind == GiftCardTopUp {
+			e.ExpiresAt = s.giftCardExpiry(sale.CreatedAt)
+		}
+		entries = append(entries, e)
+	}
+	for _, l := range sale.Lines {
+		switch {
+		case l.GiftCard == "":
+		case sale.Kind == KindRefund:
+			add(l.GiftCard, GiftCardCancel, l.TotalCents)
+		default:
+			kind := GiftCardIssue
+			if _, err := s.cfg.GiftCards.Lookup(l.GiftCard); err == nil {
+				kind = GiftCardTopUp
+			}
+			add(l.GiftCard, kind, l.TotalCents)
+		}
+	}
+	if sale.Kind == KindRefund {
+		for _, p := range sale.Payments {
+			if p.Method == MethodGiftCard && p.Ref != "" {
+				add(p.Ref, GiftCardRefund, -p.AmountCents)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.cfg.GiftCards.Post(entries)
+}
+
+// hasGiftCardEntries reports whether postGiftCards has anything to post
+// for the sale.
+func hasGiftCardEntries(sale *Sale) bool {
+	for _, l := range sale.Lines {
+		if l.GiftCard != "" {
+			return true
+		}
+	}
+	if sale.Kind == KindRefund {
+		for _, p := range sale.Payments {
+			if p.Method == MethodGiftCard && p.Ref != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// giftCardExpiry is when a card loaded at t expires; zero when cards
+// don't expire.
+func (s *Service) giftCardExpiry(t time.Time) time.Time {
+	if s.cfg.GiftCardMonths <= 0 {
+		return time.Time{}
+	}
+	return t.AddDate(0, s.cfg.GiftCardMonths, 0)
+}
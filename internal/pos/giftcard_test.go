@@ -0,0 +1,77 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGiftCards(t *testing.T) {
+	items := mapResolver{"TEA": {SKU: "TEA", Name: "Tea", Qty: 1, PriceCents: 1000}}
+	f := newFixture(t)
+	cards := f.giftCards
+	s := NewServiceWithResolver(Config{Tax: PercentTaxEngine{RatePercent: 20}, Journal: f.journal, GiftCards: cards, GiftCardMonths: 12}, items)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// the card is outside the scope of tax and only loaded once paid for
+	if _, err := s.SellGiftCard("T1", "GC-1234-56", 5000); err != nil {
+		t.Fatalf("SellGiftCard: %v", err)
+	}
+	b, _ := s.Scan("T1", "TEA")
+	if b.Tax != 200 || b.Total != 6200 || len(b.TaxBreakdown) != 1 || b.TaxBreakdown[0].Gross != 1200 {
+		t.Fatalf("basket = %+v", b)
+	}
+	if _, err := s.GiftCard("GC123456"); !errors.Is(err, ErrGiftCardNotFound) {
+		t.Fatalf("card before sale err = %v", err)
+	}
+	issued, err := s.Tender("T1", 0, MethodCard)
+	if err != nil {
+		t.Fatalf("tender: %v", err)
+	}
+	g, err := s.GiftCard("gc123456")
+	if err != nil || g.BalanceCents != 5000 || !g.ExpiresAt.Equal(now.AddDate(1, 0, 0)) {
+		t.Fatalf("card = %+v, %v", g, err)
+	}
+
+	// partial use, then the card pays what it has left
+	_, _ = s.Scan("T2", "TEA")
+	spent, err := s.TenderPayment("T2", Payment{Method: MethodGiftCard, Ref: "GC123456"})
+	if err != nil || spent == nil || spent.Payments[0].Ref != "GC123456" {
+		t.Fatalf("gift card tender = %+v, %v", spent, err)
+	}
+	_, _ = s.ScanQty("T3", "TEA", 4)
+	if _, err := s.TenderPayment("T3", Payment{Method: MethodGiftCard, AmountCents: 4000, Ref: "GC123456"}); !errors.Is(err, ErrGiftCardBalance) {
+		t.Fatalf("overdraw err = %v", err)
+	}
+	if _, err := s.TenderPayment("T3", Payment{Method: MethodGiftCard, Ref: "GC123456"}); err != nil {
+		t.Fatalf("rest of card: %v", err)
+	}
+	if b := s.Basket("T3"); b.Due != 1000 {
+		t.Fatalf("due after card = %d", b.Due)
+	}
+	if g, _ := s.GiftCard("GC123456"); g.BalanceCents != 0 {
+		t.Fatalf("balance = %d", g.BalanceCents)
+	}
+
+	// refunds pay back onto the card; a spent card can't be refunded
+	if _, err := s.Refund("T2", RefundRequest{ReceiptNo: spent.ReceiptNo}); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if g, _ := s.GiftCard("GC123456"); g.BalanceCents != 1200 {
+		t.Fatalf("balance after refund = %d", g.BalanceCents)
+	}
+	if _, err := s.Refund("T1", RefundRequest{ReceiptNo: issued.ReceiptNo, Lines: []RefundLine{{LineNo: 1, Qty: 1}}}); !errors.Is(err, ErrGiftCardSpent) {
+		t.Fatalf("refund spent card err = %v", err)
+	}
+
+	now = now.AddDate(1, 0, 1)
+	_, _ = s.Scan("T4", "TEA")
+	if _, err := s.TenderPayment("T4", Payment{Method: MethodGiftCard, Ref: "GC123456"}); !errors.Is(err, ErrGiftCardExpired) {
+		t.Fatalf("expired card err = %v", err)
+	}
+	entries, _ := s.GiftCardStatement("GC123456")
+	if len(entries) != 4 || entries[0].Kind != GiftCardIssue || entries[3].Kind != GiftCardRefund || entries[3].ReceiptNo == "" {
+		t.Fatalf("ledger = %+v", entries)
+	}
+}
@@ -0,0 +1,206 @@
+package pos
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gs is the ASCII group separator scanners send for FNC1.
+const gs = "\x1d"
+
+var (
+	ErrGS1         = errors.New("unreadable GS1 barcode")
+	ErrItemExpired = errors.New("item is past its expiry date")
+)
+
+// GS1 holds the application identifiers (AIs) read from a GS1-128,
+// GS1 DataMatrix or GS1 QR code.
+type GS1 struct {
+	GTIN     string
+	Batch    string // AI 10
+	Serial   string // AI 21
+	Expiry   string // AI 17 as YYYY-MM-DD
+	WeightKg float64
+	// PriceCents is set from AI 392n; HasPrice tells a zero price from none.
+	PriceCents int64
+	HasPrice   bool
+	AIs        map[string]string
+}
+
+// gs1Fixed gives the data length of AIs with a predefined length, keyed by
+// the AI's first two digits (GS1 General Specifications, figure 7.8.5-2).
+var gs1Fixed = map[string]int{
+	"00": 18, "01": 14, "02": 14, "03": 14, "04": 16,
+	"11": 6, "12": 6, "13": 6, "14": 6, "15": 6, "16": 6, "17": 6, "18": 6, "19": 6,
+	"20": 2, "31": 6, "32": 6, "33": 6, "34": 6, "35": 6, "36": 6, "41": 13,
+}
+
+// gs1AILen is how many digits the AI itself takes, by its first two digits.
+func gs1AILen(p string) int {
+	switch {
+	case p <= "22", p == "30", p == "37", p >= "90":
+		return 2
+	case p >= "31" && p <= "36", p == "39", p == "70", p >= "72" && p <= "89":
+		return 4
+	default:
+		return 3
+	}
+}
+
+// symbology identifiers some scanners put in front of GS1 data
+var gs1Symbologies = []string{"]C1", "]d2", "]Q3", "]e0", "]J1"}
+
+// ParseGS1 reads s as GS1 element strings, bare or in the "(01)…(10)…"
+// human readable form. It reports false when s doesn't look like GS1 at
+// all, so ordinary product codes fall through untouched. Dates are read
+// relative to today; see ParseGS1At.
+func ParseGS1(s string) (GS1, bool, error) {
+	return ParseGS1At(s, time.Now())
+}
+
+// ParseGS1At is ParseGS1 with two-digit years placed relative to now.
+func ParseGS1At(s string, now time.Time) (GS1, bool, error) {
+	flagged := false
+	for _, id := range gs1Symbologies {
+		if strings.HasPrefix(s, id) {
+			s, flagged = s[len(id):], true
+			break
+		}
+	}
+	s = strings.TrimPrefix(s, gs)
+	if strings.HasPrefix(s, "(") {
+		s, flagged = fromHumanReadable(s), true
+	}
+	if !flagged && !strings.Contains(s, gs) && !(strings.HasPrefix(s, "01") && len(s) >= 16 && allDigits(s[:16])) {
+		return GS1{}, false, nil
+	}
+	out := GS1{AIs: map[string]string{}}
+	for s != "" {
+		if len(s) < 2 {
+			return GS1{}, true, ErrGS1
+		}
+		n := gs1AILen(s[:2])
+		if len(s) < n || !allDigits(s[:n]) {
+			return GS1{}, true, ErrGS1
+		}
+		ai := s[:n]
+		s = s[n:]
+		var v string
+		if size, ok := gs1Fixed[ai[:2]]; ok {
+			if len(s) < size {
+				return GS1{}, true, ErrGS1
+			}
+			v, s = s[:size], s[size:]
+		} else if i := strings.Index(s, gs); i >= 0 {
+			v, s = s[:i], s[i:]
+		} else {
+			v, s = s, ""
+		}
+		s = strings.TrimPrefix(s, gs)
+		out.AIs[ai] = v
+		if err := out.set(ai, v, now); err != nil {
+			return GS1{}, true, err
+		}
+	}
+	if out.GTIN == "" {
+		return GS1{}, true, ErrGS1
+	}
+	return out, true, nil
+}
+
+func (g *GS1) set(ai, v string, now time.Time) error {
+	switch {
+	case ai == "01" || ai == "02":
+		if !allDigits(v) || !validCheckDigit(v) {
+			return ErrBadCheckDigit
+		}
+		g.GTIN = v
+	case ai == "10":
+		g.Batch = v
+	case ai == "21":
+		g.Serial = v
+	case ai == "17":
+		d, err := gs1Date(v, now)
+		if err != nil {
+			return err
+		}
+		g.Expiry = d
+	case strings.HasPrefix(ai, "310"):
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return ErrGS1
+		}
+		g.WeightKg = RoundQty(float64(n) / math.Pow10(int(ai[3]-'0')))
+	case strings.HasPrefix(ai, "392"):
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return ErrGS1
+		}
+		g.PriceCents, g.HasPrice = scaleCents(n, int(ai[3]-'0')), true
+	}
+	return nil
+}
+
+// gs1Date turns YYMMDD into YYYY-MM-DD. Day 00 means the end of the month.
+// The century follows the GS1 sliding window: the year falls from 49 years
+// before now to 50 years after (General Specifications 7.12). Days the
+// month doesn't have are refused.
+func gs1Date(v string, now time.Time) (string, error) {
+	if len(v) != 6 || !allDigits(v) {
+		return "", ErrGS1
+	}
+	yy, _ := strconv.Atoi(v[:2])
+	mm, _ := strconv.Atoi(v[2:4])
+	dd, _ := strconv.Atoi(v[4:])
+	if mm < 1 || mm > 12 {
+		return "", ErrGS1
+	}
+	year := now.Year()/100*100 + yy
+	switch diff := yy - now.Year()%100; {
+	case diff >= 51:
+		year -= 100
+	case diff <= -50:
+		year += 100
+	}
+	if dd == 0 {
+		// day 0 of the next month is the last day of this one
+		return time.Date(year, time.Month(mm)+1, 0, 0, 0, 0, 0, time.UTC).Format(dateLayout), nil
+	}
+	d := time.Date(year, time.Month(mm), dd, 0, 0, 0, 0, time.UTC)
+	if d.Month() != time.Month(mm) || d.Day() != dd {
+		return "", ErrGS1
+	}
+	return d.Format(dateLayout), nil
+}
+
+// fromHumanReadable turns "(01)0950…(10)AB" into element strings with a
+// separator after each value, which is harmless after fixed-length ones.
+func fromHumanReadable(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "(")[1:] {
+		ai, v, ok := strings.Cut(part, ")")
+		if !ok {
+			return s
+		}
+		if b.Len() > 0 {
+			b.WriteString(gs)
+		}
+		b.WriteString(ai + v)
+	}
+	return b.String()
+}
+
+// gtinKeys lists the catalog codes a GTIN-14 may be stored under, longest
+// first: the GTIN itself, then EAN-13, UPC-A and EAN-8 with padding removed.
+func gtinKeys(gtin string) []string {
+	keys := []string{gtin}
+	for _, n := range []int{13, 12, 8} {
+		if pad := len(gtin) - n; pad > 0 && strings.Trim(gtin[:pad], "0") == "" {
+			keys = append(keys, gtin[pad:])
+		}
+	}
+	return keys
+}
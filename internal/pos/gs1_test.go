@@ -0,0 +1,68 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGS1Barcodes(t *testing.T) {
+	items := mapResolver{"5012345678900": {SKU: "5012345678900", Name: "Milk", Qty: 1, PriceCents: 120}}
+	s := NewServiceWithResolver(Config{Journal: newFixture(t).journal, Tax: PercentTaxEngine{}}, items)
+	s.now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+
+	if _, ok, _ := ParseGS1("5012345678900"); ok {
+		t.Fatal("plain EAN-13 parsed as GS1")
+	}
+	for in, want := range map[string]string{
+		"17751231": "2075-12-31", // 49 years ahead stays in this century
+		"17770101": "1977-01-01", // 51 years ahead is last century
+		"17240200": "2024-02-29",
+	} {
+		if g, _, err := ParseGS1At("0105012345678900"+in, s.now()); err != nil || g.Expiry != want {
+			t.Errorf("%s: expiry = %q, %v; want %s", in, g.Expiry, err, want)
+		}
+	}
+	if _, _, err := ParseGS1At("010501234567890017310231", s.now()); !errors.Is(err, ErrGS1) {
+		t.Fatalf("31 Feb err = %v", err)
+	}
+	if _, err := s.Scan("T1", "]d2010501234567890017261016"); !errors.Is(err, ErrItemExpired) {
+		t.Fatalf("expired err = %v", err)
+	}
+	if _, err := s.Scan("T1", "0105012345678901"); !errors.Is(err, ErrBadCheckDigit) {
+		t.Fatalf("bad GTIN err = %v", err)
+	}
+	_, _ = s.Scan("T1", "\x1d0105012345678900"+"10ABC1\x1d17261031")
+	_, _ = s.Scan("T1", "010501234567890017261031"+"10ABC1")
+	b, _ := s.Scan("T1", "(01)05012345678900(17)261000(10)XYZ")
+	if len(b.Lines) != 2 {
+		t.Fatalf("lines = %+v; want one line per batch", b.Lines)
+	}
+	if l := b.Lines[0]; l.Qty != 2 || l.Batch != "ABC1" || l.Expiry != "2026-10-31" {
+		t.Fatalf("first batch line = %+v", l)
+	}
+	if l := b.Lines[1]; l.Batch != "XYZ" || l.Expiry != "2026-10-31" {
+		t.Fatalf("second batch line = %+v", l)
+	}
+
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if err != nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	_, lines, _ := s.Refundable(sale.ReceiptNo)
+	if lines[1].Batch != "XYZ" || lines[1].Expiry != "2026-10-31" {
+		t.Fatalf("journalled line = %+v", lines[1])
+	}
+
+	// weight and amount payable: the amount is the line total
+	b, err = s.Scan("T1", "]C1010501234567890031030005003922250")
+	if err != nil || len(b.Lines) != 1 || b.Lines[0].Qty != 1 || b.Lines[0].Unit != "" || b.Total != 250 || b.Lines[0].Note != "0.500 kg" {
+		t.Fatalf("weighed priced label = %+v, %v", b, err)
+	}
+
+	// a long catalog code starting "01" is the catalog item, not GS1
+	s = NewServiceWithResolver(Config{Tax: PercentTaxEngine{}}, mapResolver{"0123456789012345": {SKU: "0123456789012345", Name: "Long", Qty: 1, PriceCents: 99}})
+	if b, err := s.Scan("T1", "0123456789012345"); err != nil || b.Total != 99 {
+		t.Fatalf("long catalog code = %+v, %v", b, err)
+	}
+}
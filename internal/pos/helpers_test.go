@@ -0,0 +1,67 @@
+package pos
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fixture holds every SQLite store opened on one database in a temporary
+// directory, the way main opens them on its data file.
+type fixture struct {
+	path      string
+	journal   *SQLiteJournal
+	customers *SQLiteCustomerStore
+	loyalty   *SQLiteLoyaltyLedger
+	giftCards *SQLiteGiftCardStore
+	vouchers  *SQLiteVoucherStore
+	parking   *SQLiteParkStore
+	sessions  *SQLiteSessionStore
+	audit     *SQLiteAuditLog
+	rates     *SQLiteRateStore
+	tables    *SQLiteTableStore
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{path: filepath.Join(t.TempDir(), "test.db")}
+	check := func(name string, err error) {
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	var err error
+	f.journal, err = NewSQLiteJournal(f.path)
+	check("NewSQLiteJournal", err)
+	f.customers, err = NewSQLiteCustomerStore(f.path)
+	check("NewSQLiteCustomerStore", err)
+	f.loyalty, err = NewSQLiteLoyaltyLedger(f.path)
+	check("NewSQLiteLoyaltyLedger", err)
+	f.giftCards, err = NewSQLiteGiftCardStore(f.path)
+	check("NewSQLiteGiftCardStore", err)
+	f.vouchers, err = NewSQLiteVoucherStore(f.path)
+	check("NewSQLiteVoucherStore", err)
+	f.parking, err = NewSQLiteParkStore(f.path)
+	check("NewSQLiteParkStore", err)
+	f.sessions, err = NewSQLiteSessionStore(f.path)
+	check("NewSQLiteSessionStore", err)
+	f.audit, err = NewSQLiteAuditLog(f.path)
+	check("NewSQLiteAuditLog", err)
+	f.rates, err = NewSQLiteRateStore(f.path)
+	check("NewSQLiteRateStore", err)
+	f.tables, err = NewSQLiteTableStore(f.path)
+	check("NewSQLiteTableStore", err)
+	return f
+}
+
+type promoList []Promotion
+
+func (l promoList) Active(at time.Time) []Promotion {
+	var out []Promotion
+	for _, p := range l {
+		if p.ActiveAt(at) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+package pos
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+var (
+	ErrServiceCharge    = errors.New("service charge must be between 0 and 100 percent")
+	ErrTipMethod        = errors.New("tips can only be added to card payments")
+	ErrTipAmount        = errors.New("tip must be zero or more")
+	ErrHospitalityRules = errors.New("service charge and tip percentages must be between 0 and 100")
+)
+
+// TipSuggestion is a suggested tip and what it comes to on the basket.
+type TipSuggestion struct {
+	Percent float64 `json:"percent"`
+	Cents   int64   `json:"cents"`
+}
+
+// ValidateHospitalityRules checks the percentages are usable.
+func ValidateHospitalityRules(r common.HospitalityRules) error {
+	if r.ServiceChargePct < 0 || r.ServiceChargePct > 100 {
+		return ErrHospitalityRules
+	}
+	for _, p := range r.TipPercents {
+		if p <= 0 || p > 100 {
+			return ErrHospitalityRules
+		}
+	}
+	return nil
+}
+
+// SetHospitalityRules replaces the default service charge and the tip
+// suggestions.
+func (s *Service) SetHospitalityRules(r common.HospitalityRules) error {
+	if err := ValidateHospitalityRules(r); err != nil {
+		return err
+	}
+	r.TipPercents = append([]float64(nil), r.TipPercents...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hospitality = r
+	return nil
+}
+
+func (s *Service) hospitalityRules() common.HospitalityRules {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hospitality
+}
+
+// SetServiceCharge puts a service charge of percent on the basket; a
+// negative percent uses the default from the hospitality rules and 0
+// takes it off. The charge is worked out on the lines' total, outside the
+// scope of tax, and is fixed once tendering starts.
+func (s *Service) SetServiceCharge(terminal string, percent float64) (*Basket, error) {
+	if percent < 0 {
+		percent = s.hospitalityRules().ServiceChargePct
+	}
+	if percent > 100 || math.IsNaN(percent) {
+		return nil, ErrServiceCharge
+	}
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		b.ServiceChargeBP = int(math.Round(percent * 100))
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetOperator names who is serving the basket; tips taken on it are
+// theirs.
+func (s *Service) SetOperator(terminal, operator string) (*Basket, error) {
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		b.Operator = strings.TrimSpace(operator)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TipFor works out a tip of percent on the basket's bill: its total and
+// service charge. On a split bill it is the next part's.
+func (s *Service) TipFor(terminal string, percent float64) int64 {
+	b := s.baskets.Get(terminal)
+	if b.Split != nil {
+		if i, err := b.Split.open(0); err == nil {
+			b = b.Split.Parts[i].Basket
+		}
+	}
+	return int64(math.Round(float64(b.Total+b.ServiceCharge) * percent / 100))
+}
+
+// TipSuggestions returns the suggested tip percentages with what each
+// comes to on the terminal's basket.
+func (s *Service) TipSuggestions(terminal string) []TipSuggestion {
+	var out []TipSuggestion
+	for _, p := range s.hospitalityRules().TipPercents {
+		out = append(out, TipSuggestion{Percent: p, Cents: s.TipFor(terminal, p)})
+	}
+	return out
+}
+
+// Tips sums the tips taken in [from, to) by the operator who served the
+// sale; tips on sales with no operator are under "".
+func (s *Service) Tips(from, to time.Time) (map[string]int64, error) {
+	sales, err := s.Sales(from, to)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]int64{}
+	for _, sale := range sales {
+		if sale.Tip != 0 {
+			out[sale.Operator] += sale.Tip
+		}
+	}
+	return out, nil
+}
+
+// chargeable sums the lines a service charge is worked out on; gift cards
+// aren't served.
+func chargeable(lines []BasketLine) int64 {
+	var n int64
+	for _, l := range lines {
+		if l.GiftCard == "" {
+			n += l.TotalCents
+		}
+	}
+	return n
+}
+
+func serviceCharge(lines []BasketLine, bp int) int64 {
+	if bp == 0 {
+		return 0
+	}
+	return int64(math.Round(float64(chargeable(lines)) * float64(bp) / 10000))
+}
+
+// refundServiceCharge works out the service charge a refund pays back, in
+// proportion to the lines returned; the refund that completes the return
+// settles the remainder.
+func refundServiceCharge(orig *Sale, prior []Sale, refund *Sale) int64 {
+	base := chargeable(orig.Lines)
+	if orig.ServiceCharge == 0 || base <= 0 {
+		return 0
+	}
+	var doneBase, done int64
+	for _, r := range prior {
+		doneBase -= chargeable(r.Lines)
+		done -= r.ServiceCharge
+	}
+	back := -chargeable(refund.Lines)
+	if doneBase+back >= base {
+		return -(orig.ServiceCharge - done)
+	}
+	return -orig.ServiceCharge * back / base
+}
+
+// ServiceChargePercent is the basket's service charge rate for display.
+func (b *Basket) ServiceChargePercent() float64 {
+	return float64(b.ServiceChargeBP) / 100
+}
+
+// payable is what the basket is paid at: its total, service charge, tips
+// and cash rounding.
+func (b *Basket) payable() int64 {
+	return b.Total + b.ServiceCharge + b.Tip + b.Rounding
+}
+
+// Payable is what the sale was paid at, before change: its total, service
+// charge, tips and cash rounding.
+func (s *Sale) Payable() int64 {
+	return s.Total + s.ServiceCharge + s.Tip + s.Rounding
+}
@@ -0,0 +1,58 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+func TestServiceChargeAndTips(t *testing.T) {
+	items := mapResolver{"A": {SKU: "A", Name: "A", Qty: 1, PriceCents: 1000}}
+	j := newFixture(t).journal
+	s := NewServiceWithResolver(Config{Journal: j, Tax: PercentTaxEngine{RatePercent: 20}}, items)
+	if err := s.SetHospitalityRules(common.HospitalityRules{ServiceChargePct: 12.5, TipPercents: []float64{10, 15}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = s.Scan("T1", "A")
+	_, _ = s.SetOperator("T1", " Sam ")
+	b, err := s.SetServiceCharge("T1", -1)
+	if err != nil {
+		t.Fatalf("SetServiceCharge: %v", err)
+	}
+	// the charge sits outside the total and isn't taxed
+	if b.ServiceChargeBP != 1250 || b.ServiceCharge != 150 || b.Tax != 200 || b.Total != 1200 || b.Due != 1350 {
+		t.Fatalf("basket = %+v", b)
+	}
+	if got := s.TipSuggestions("T1"); len(got) != 2 || got[0].Cents != 135 {
+		t.Fatalf("suggestions = %+v", got)
+	}
+	if _, err := s.TenderPayment("T1", Payment{Method: MethodCash, TipCents: 100}); !errors.Is(err, ErrTipMethod) {
+		t.Fatalf("cash tip err = %v", err)
+	}
+	sale, err := s.TenderPayment("T1", Payment{Method: MethodCard, TipCents: s.TipFor("T1", 10)})
+	if err != nil || sale == nil || sale.Tip != 135 || sale.Change != 0 || sale.Payments[0].AmountCents != 1485 {
+		t.Fatalf("sale = %+v, %v", sale, err)
+	}
+	got, _ := j.Get(sale.ReceiptNo)
+	if got.Operator != "Sam" || got.ServiceCharge != 150 || got.Tip != 135 || got.Payments[0].TipCents != 135 {
+		t.Fatalf("journalled = %+v", got)
+	}
+	tips, _ := s.Tips(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if tips["Sam"] != 135 {
+		t.Fatalf("tips = %v", tips)
+	}
+
+	rep := BuildSessionReport(ReportX, Session{}, []Sale{*sale}, nil)
+	if rep.ServiceCharge != 150 || rep.Tips != 135 || rep.TipsBy["Sam"] != 135 {
+		t.Fatalf("report = %+v", rep)
+	}
+
+	// the service charge goes back with the goods; the tip doesn't
+	r, err := s.Refund("T1", RefundRequest{ReceiptNo: sale.ReceiptNo})
+	if err != nil || r.ServiceCharge != -150 || r.Tip != 0 || r.Payments[0].AmountCents != -1350 {
+		t.Fatalf("refund = %+v, %v", r, err)
+	}
+}
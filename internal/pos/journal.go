@@ -0,0 +1,91 @@
+package pos
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrSaleNotFound = errors.New("sale not found")
+
+// Sale kinds. Refunds carry negative quantities and amounts.
+const (
+	KindSale   = "sale"
+	KindRefund = "refund"
+)
+
+// Payment is a single tender taken against a sale.
+type Payment struct {
+	Method      string `json:"method"`
+	AmountCents int64  `json:"amountCents"`
+	Ref         string `json:"ref,omitempty"`      // gift card number
+	TipCents    int64  `json:"tipCents,omitempty"` // part of AmountCents that is a tip; card only
+	Points      int64  `json:"points,omitempty"`   // loyalty points taken; kept on the basket so a void can return them
+	// Currency is set on foreign cash: ForeignCents were taken at Rate and
+	// AmountCents is what they are worth in the base currency
+	Currency     string  `json:"currency,omitempty"`
+	ForeignCents int64   `json:"foreignCents,omitempty"`
+	Rate         float64 `json:"rate,omitempty"`
+}
+
+// Sale is a completed transaction as written to the journal.
+type Sale struct {
+	ID        int64        `json:"id"`
+	Kind      string       `json:"kind"`
+	RefundOf  string       `json:"refundOf,omitempty"` // original receipt for refunds
+	Reason    string       `json:"reason,omitempty"`
+	Terminal  string       `json:"terminal"`
+	Seq       int64        `json:"seq"`
+	ReceiptNo string       `json:"receiptNo"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Lines     []BasketLine `json:"lines"`
+	Payments  []Payment    `json:"payments"`
+	Subtotal  int64        `json:"subtotal"`
+	Discounts []Discount   `json:"discounts,omitempty"`
+	Discount  int64        `json:"discount"`
+	Vouchers  []string     `json:"vouchers,omitempty"` // codes redeemed
+	Tax       int64        `json:"tax"`
+	Total     int64        `json:"total"`
+	Change    int64        `json:"change"`             // cash handed back
+	Rounding  int64        `json:"rounding,omitempty"` // cash rounding adjustment; payments settle Payable()
+	// ServiceCharge and Tip are paid on top of Total; Operator served the sale
+	ServiceChargeBP int    `json:"serviceChargeBP,omitempty"`
+	ServiceCharge   int64  `json:"serviceCharge,omitempty"`
+	Tip             int64  `json:"tip,omitempty"`
+	Operator        string `json:"operator,omitempty"`
+	Table           string `json:"table,omitempty"` // the tab the sale settled
+	Covers          int    `json:"covers,omitempty"`
+	// SplitRef names the split bill the sale paid part SplitPart of
+	SplitRef   string `json:"splitRef,omitempty"`
+	SplitPart  int    `json:"splitPart,omitempty"`
+	SessionID  int64  `json:"sessionId,omitempty"` // till session taken in
+	CustomerID int64  `json:"customerId,omitempty"`
+	// loyalty points the sale earned and paid with; negative on refunds
+	PointsEarned   int64 `json:"pointsEarned,omitempty"`
+	PointsRedeemed int64 `json:"pointsRedeemed,omitempty"`
+	// TaxBreakdown is derived from the lines; it is not stored separately
+	TaxBreakdown []TaxBand `json:"taxBreakdown"`
+	// Pending lists the ledgers (LedgerGiftCards...) the sale still has to
+	// be posted to; the journal keeps them until MarkPosted
+	Pending []string `json:"pending,omitempty"`
+}
+
+// Journal persists completed sales.
+type Journal interface {
+	// Record writes the sale atomically, assigning ID, Seq and ReceiptNo.
+	Record(s *Sale) error
+	Get(receiptNo string) (*Sale, error)
+	// List returns sales created in [from, to), oldest first.
+	List(from, to time.Time) ([]Sale, error)
+	// Refunds returns the refunds recorded against a receipt.
+	Refunds(receiptNo string) ([]Sale, error)
+	// BySession returns the sales and refunds taken in a till session.
+	BySession(id int64) ([]Sale, error)
+	// ByCustomer returns a customer's sales and refunds, oldest first.
+	ByCustomer(id int64) ([]Sale, error)
+	// BySplit returns the sales that paid the parts of a split bill.
+	BySplit(ref string) ([]Sale, error)
+	// Unposted returns the sales with ledgers still pending, oldest first.
+	Unposted() ([]Sale, error)
+	// MarkPosted clears a pending ledger once the sale is posted to it.
+	MarkPosted(receiptNo, ledger string) error
+}
@@ -0,0 +1,55 @@
+package pos
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalKeepsLineNumbersAndFractionalQty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// the first sale_lines table declared quantities whole
+	if _, err := old.Exec(`CREATE TABLE sales(id INTEGER PRIMARY KEY AUTOINCREMENT, terminal TEXT NOT NULL, seq INTEGER NOT NULL,
+	  receipt_no TEXT NOT NULL UNIQUE, created_at TEXT NOT NULL, subtotal INTEGER NOT NULL, tax INTEGER NOT NULL, total INTEGER NOT NULL,
+	  UNIQUE(terminal, seq));
+	CREATE TABLE sale_lines(sale_id INTEGER NOT NULL REFERENCES sales(id), line_no INTEGER NOT NULL, sku TEXT NOT NULL,
+	  name TEXT NOT NULL, qty INTEGER NOT NULL, price_cents INTEGER NOT NULL, image_url TEXT, PRIMARY KEY(sale_id, line_no));
+	INSERT INTO sales VALUES(1,'T1',1,'T1-000001','2026-01-01T00:00:00Z',200,0,200);
+	INSERT INTO sale_lines VALUES(1,1,'A','A',2,100,NULL);`); err != nil {
+		t.Fatalf("old schema: %v", err)
+	}
+	old.Close()
+
+	j, err := NewSQLiteJournal(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteJournal: %v", err)
+	}
+	var typ string
+	if err := j.db.QueryRow(`SELECT type FROM pragma_table_info('sale_lines') WHERE name='qty'`).Scan(&typ); err != nil || typ != "REAL" {
+		t.Fatalf("qty type = %q, %v", typ, err)
+	}
+	if got, err := j.Get("T1-000001"); err != nil || len(got.Lines) != 1 || got.Lines[0].Qty != 2 {
+		t.Fatalf("old sale = %+v, %v", got, err)
+	}
+
+	items := mapResolver{
+		"A":   {SKU: "A", Name: "A", Qty: 1, PriceCents: 100},
+		"CHZ": {SKU: "CHZ", Name: "Cheese", Qty: 1, PriceCents: 1200, Unit: "kg"},
+	}
+	s := NewServiceWithResolver(Config{Journal: j}, items)
+	_, _ = s.Scan("T2", "A")
+	_, _ = s.ScanQty("T2", "CHZ", 0.375)
+	_, _ = s.VoidLine("T2", 1)
+	sale, err := s.Tender("T2", 0, MethodCard)
+	if err != nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	got, err := j.Get(sale.ReceiptNo)
+	if err != nil || len(got.Lines) != 1 || got.Lines[0].LineNo != 2 || got.Lines[0].Qty != 0.375 {
+		t.Fatalf("journalled lines = %+v, %v", got.Lines, err)
+	}
+}
@@ -0,0 +1,129 @@
+package pos
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrLineNotFound   = errors.New("basket line not found")
+	ErrInvalidQty     = errors.New("quantity must not be negative")
+	ErrInvalidPrice   = errors.New("price must not be negative")
+	ErrReasonRequired = errors.New("a reason is required to override a price")
+	ErrGiftCardLine   = errors.New("gift card lines can only be voided")
+)
+
+// VoidLine removes a line from the terminal's basket.
+func (s *Service) VoidLine(terminal string, lineNo int) (*Basket, error) {
+	return s.editLine(terminal, lineNo, func(b *Basket, i int) error {
+		b.Lines = append(b.Lines[:i], b.Lines[i+1:]...)
+		return nil
+	})
+}
+
+// SetLineQty changes a line's quantity; zero voids the line.
+func (s *Service) SetLineQty(terminal string, lineNo int, qty float64) (*Basket, error) {
+	qty = RoundQty(qty)
+	if qty < 0 {
+		return nil, ErrInvalidQty
+	}
+	return s.editLine(terminal, lineNo, func(b *Basket, i int) error {
+		if qty == 0 {
+			b.Lines = append(b.Lines[:i], b.Lines[i+1:]...)
+			return nil
+		}
+		if b.Lines[i].GiftCard != "" {
+			return ErrGiftCardLine
+		}
+		b.Lines[i].Qty = qty
+		return nil
+	})
+}
+
+// OverridePrice sets a line's unit price by hand. The resolved price is kept
+// alongside the reason so the override can be audited.
+func (s *Service) OverridePrice(terminal string, lineNo int, priceCents int64, reason string) (*Basket, error) {
+	reason = strings.TrimSpace(reason)
+	if priceCents < 0 {
+		return nil, ErrInvalidPrice
+	}
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	return s.editLine(terminal, lineNo, func(b *Basket, i int) error {
+		l := &b.Lines[i]
+		if l.GiftCard != "" {
+			return ErrGiftCardLine
+		}
+		if !l.Overridden() {
+			l.OriginalPriceCents = l.PriceCents
+		}
+		l.PriceCents = priceCents
+		l.OverrideReason = reason
+		return nil
+	})
+}
+
+// SetLineNote attaches free text to a line; an empty note clears it.
+func (s *Service) SetLineNote(terminal string, lineNo int, note string) (*Basket, error) {
+	note = strings.TrimSpace(note)
+	return s.editLine(terminal, lineNo, func(b *Basket, i int) error {
+		b.Lines[i].Note = note
+		return nil
+	})
+}
+
+// SetLineSeat puts a line on a diner's seat, for splitting the bill by
+// seat; seat 0 shares the line across the table.
+func (s *Service) SetLineSeat(terminal string, lineNo, seat int) (*Basket, error) {
+	if seat < 0 {
+		return nil, ErrSeat
+	}
+	return s.editLine(terminal, lineNo, func(b *Basket, i int) error {
+		b.Lines[i].Seat = seat
+		return nil
+	})
+}
+
+// editLine applies fn to the numbered line and recomputes the totals.
+func (s *Service) editLine(terminal string, lineNo int, fn func(b *Basket, i int) error) (*Basket, error) {
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		i := b.lineIndex(lineNo)
+		if i < 0 {
+			return ErrLineNotFound
+		}
+		if err := fn(b, i); err != nil {
+			return err
+		}
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (b *Basket) lineIndex(lineNo int) int {
+	for i := range b.Lines {
+		if b.Lines[i].LineNo == lineNo {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *Basket) nextLineNo() int {
+	n := 0
+	for _, l := range b.Lines {
+		if l.LineNo > n {
+			n = l.LineNo
+		}
+	}
+	return n + 1
+}
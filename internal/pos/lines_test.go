@@ -0,0 +1,43 @@
+package pos
+
+import (
+	"testing"
+)
+
+func TestLineEdits(t *testing.T) {
+	s := NewService(Config{})
+	s.SetTaxEngine(PercentTaxEngine{RatePercent: 20})
+	_, _ = s.Scan("T1", "A")
+	b, _ := s.ScanQty("T1", "B", 3)
+	if b.Total != 850*120/100 {
+		t.Fatalf("total = %d", b.Total)
+	}
+
+	b, err := s.SetLineQty("T1", 2, 1)
+	if err != nil || b.Subtotal != 450 {
+		t.Fatalf("SetLineQty: %v subtotal=%d", err, b.Subtotal)
+	}
+	if _, err := s.OverridePrice("T1", 1, 100, " "); err != ErrReasonRequired {
+		t.Fatalf("err = %v; want ErrReasonRequired", err)
+	}
+	b, _ = s.OverridePrice("T1", 1, 100, "damaged")
+	if l := b.Lines[0]; l.PriceCents != 100 || l.OriginalPriceCents != 250 || b.Subtotal != 300 {
+		t.Fatalf("override not applied: %+v subtotal=%d", l, b.Subtotal)
+	}
+	// rescanning a hand-priced item starts a new line at the catalog price
+	b, _ = s.Scan("T1", "A")
+	if len(b.Lines) != 3 || b.Lines[2].LineNo != 3 || b.Lines[2].PriceCents != 250 {
+		t.Fatalf("rescan merged into overridden line: %+v", b.Lines)
+	}
+	b, _ = s.SetLineNote("T1", 3, "no lid")
+	if b.Lines[2].Note != "no lid" {
+		t.Fatalf("note not set: %+v", b.Lines[2])
+	}
+	b, _ = s.VoidLine("T1", 2)
+	if len(b.Lines) != 2 || b.Subtotal != 350 || b.Tax != 70 {
+		t.Fatalf("void: %+v", b)
+	}
+	if _, err := s.VoidLine("T1", 2); err != ErrLineNotFound {
+		t.Fatalf("err = %v; want ErrLineNotFound", err)
+	}
+}
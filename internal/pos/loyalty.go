@@ -0,0 +1,302 @@
+package pos
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+// MethodPoints pays with the attached customer's loyalty points.
+const MethodPoints = "points"
+
+// Points ledger entry kinds.
+const (
+	PointsEarn    = "earn"
+	PointsRedeem  = "redeem"
+	PointsReverse = "reverse" // earned points taken back by a refund
+	PointsReturn  = "return"  // spent points given back by a refund
+)
+
+var (
+	ErrLoyaltyOff    = errors.New("loyalty points are not enabled")
+	ErrNoCustomer    = errors.New("attach a customer to use loyalty points")
+	ErrPointsBalance = errors.New("not enough loyalty points")
+	ErrPointsAmount  = errors.New("amount is worth less than one point")
+	ErrLoyaltyRules  = errors.New("loyalty rates and multipliers can't be negative, and points need a value to be spent")
+)
+
+// PointsEntry is one movement on a customer's points ledger. Points are
+// signed: earning and returns add, redemptions and reversals take away.
+type PointsEntry struct {
+	ID         int64     `json:"id"`
+	CustomerID int64     `json:"customerId"`
+	Kind       string    `json:"kind"`
+	Points     int64     `json:"points"`
+	ReceiptNo  string    `json:"receiptNo,omitempty"`
+	Terminal   string    `json:"terminal"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// LoyaltyStatus is a customer's standing: points to spend, points earned
+// over their lifetime, and the tier that earns them.
+type LoyaltyStatus struct {
+	Points   int64  `json:"points"`
+	Lifetime int64  `json:"lifetime"`
+	Tier     string `json:"tier,omitempty"`
+}
+
+// LoyaltyLedger keeps points; see SQLiteLoyaltyLedger.
+type LoyaltyLedger interface {
+	// Balance fills in Points and Lifetime; the service works out the tier.
+	Balance(customerID int64) (LoyaltyStatus, error)
+	// Post writes entries all or none. A redemption that would take the
+	// customer below zero fails with ErrPointsBalance; reversals may. An
+	// entry whose receipt already has one of its kind for the customer is
+	// skipped, so a sale can be posted again.
+	Post(entries []PointsEntry) error
+	Entries(customerID int64) ([]PointsEntry, error)
+}
+
+// ValidateLoyaltyRules checks rates and multipliers aren't negative.
+func ValidateLoyaltyRules(r common.LoyaltyRules) error {
+	if r.PointsPerUnit < 0 || r.PointValueCents < 0 {
+		return ErrLoyaltyRules
+	}
+	for _, m := range r.Categories {
+		if m < 0 {
+			return ErrLoyaltyRules
+		}
+	}
+	for _, m := range r.Promotions {
+		if m < 0 {
+			return ErrLoyaltyRules
+		}
+	}
+	for _, t := range r.Tiers {
+		if t.MinPoints < 0 || t.Multiplier < 0 {
+			return ErrLoyaltyRules
+		}
+	}
+	return nil
+}
+
+// SetLoyaltyRules replaces the earn and spend rules. Open baskets pick
+// them up at their next tender.
+func (s *Service) SetLoyaltyRules(r common.LoyaltyRules) error {
+	if err := ValidateLoyaltyRules(r); err != nil {
+		return err
+	}
+	r.Tiers = append([]common.LoyaltyTier(nil), r.Tiers...)
+	sort.Slice(r.Tiers, func(i, j int) bool { return r.Tiers[i].MinPoints < r.Tiers[j].MinPoints })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loyalty = r
+	return nil
+}
+
+// loyaltyRules returns the rules in force, or false when loyalty is off.
+func (s *Service) loyaltyRules() (common.LoyaltyRules, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loyalty, s.loyalty.Enabled && s.cfg.Loyalty != nil
+}
+
+// tierFor returns the highest tier reached with lifetime points; below
+// the first tier points are earned at the base rate.
+func tierFor(r common.LoyaltyRules, lifetime int64) common.LoyaltyTier {
+	tier := common.LoyaltyTier{Multiplier: 1}
+	for _, t := range r.Tiers {
+		if lifetime >= t.MinPoints {
+			tier = t
+		}
+	}
+	return tier
+}
+
+// Loyalty returns the customer's points and tier, or nil when loyalty is off.
+func (s *Service) Loyalty(customerID int64) (*LoyaltyStatus, error) {
+	r, ok := s.loyaltyRules()
+	if !ok {
+		return nil, nil
+	}
+	st, err := s.cfg.Loyalty.Balance(customerID)
+	if err != nil {
+		return nil, err
+	}
+	st.Tier = tierFor(r, st.Lifetime).Name
+	return &st, nil
+}
+
+// LoyaltyStatement returns the customer's points ledger, oldest first.
+func (s *Service) LoyaltyStatement(customerID int64) ([]PointsEntry, error) {
+	if s.cfg.Loyalty == nil {
+		return nil, nil
+	}
+	return s.cfg.Loyalty.Entries(customerID)
+}
+
+// redeemPoints takes the whole points that go into amount off the
+// customer's balance straight away, so two tills can't spend them twice,
+// and returns them with what they pay; the cents a point doesn't cover
+// stay due.
+func (s *Service) redeemPoints(terminal string, b *Basket, amount int64) (int64, int64, error) {
+	r, ok := s.loyaltyRules()
+	if !ok || r.PointValueCents == 0 {
+		return 0, 0, ErrLoyaltyOff
+	}
+	if b.Customer == nil {
+		return 0, 0, ErrNoCustomer
+	}
+	points := amount / r.PointValueCents
+	if points == 0 {
+		return 0, 0, ErrPointsAmount
+	}
+	err := s.cfg.Loyalty.Post([]PointsEntry{{CustomerID: b.Customer.ID, Kind: PointsRedeem, Points: -points,
+		Terminal: terminal, CreatedAt: s.now()}})
+	if err != nil {
+		return 0, 0, err
+	}
+	b.PointsRedeemed += points
+	if b.Loyalty != nil {
+		b.Loyalty.Points -= points
+	}
+	return points, points * r.PointValueCents, nil
+}
+
+// unredeemPoints gives back points taken for a payment that then failed
+// or was voided.
+func (s *Service) unredeemPoints(terminal string, b *Basket, points int64) error {
+	if points == 0 || b.Customer == nil || s.cfg.Loyalty == nil {
+		return nil
+	}
+	err := s.cfg.Loyalty.Post([]PointsEntry{{CustomerID: b.Customer.ID, Kind: PointsReturn, Points: points,
+		Terminal: terminal, CreatedAt: s.now()}})
+	if err != nil {
+		return err
+	}
+	b.PointsRedeemed -= points
+	if b.Loyalty != nil {
+		b.Loyalty.Points += points
+	}
+	return nil
+}
+
+// pointsEarned is what the paid basket earns its customer at their tier.
+func (s *Service) pointsEarned(b *Basket) (int64, error) {
+	r, ok := s.loyaltyRules()
+	if !ok || b.Customer == nil {
+		return 0, nil
+	}
+	st, err := s.cfg.Loyalty.Balance(b.Customer.ID)
+	if err != nil {
+		return 0, err
+	}
+	return earnPoints(r, tierFor(r, st.Lifetime), b.Lines, b.Discounts, b.Total, paidWith(b.Payments, MethodPoints)), nil
+}
+
+// postPoints writes a journalled sale's points to the ledger.
+func (s *Service) postPoints(sale *Sale) error {
+	entries := pointsEntries(sale)
+	if len(entries) == 0 || s.cfg.Loyalty == nil {
+		return nil
+	}
+	return s.cfg.Loyalty.Post(entries)
+}
+
+// earnPoints works out what a sale earns: each line's total at the base
+// rate times its category and promotion multipliers, less the share paid
+// with points, times the customer's tier.
+func earnPoints(r common.LoyaltyRules, tier common.LoyaltyTier, lines []BasketLine, discounts []Discount, total, paidWithPoints int64) int64 {
+	if total <= 0 || r.PointsPerUnit == 0 {
+		return 0
+	}
+	promo := map[int]float64{} // line number to its promotions' multiplier
+	for _, d := range discounts {
+		m, ok := r.Promotions[d.PromoID]
+		if !ok {
+			continue
+		}
+		for _, n := range d.Lines {
+			if _, seen := promo[n]; !seen {
+				promo[n] = 1
+			}
+			promo[n] *= m
+		}
+	}
+	var points float64
+	for _, l := range lines {
+		if l.GiftCard != "" {
+			continue // points are earned when the card is spent
+		}
+		m := 1.0
+		if c, ok := r.Categories[l.Category]; ok {
+			m = c
+		}
+		if p, ok := promo[l.LineNo]; ok {
+			m *= p
+		}
+		points += float64(l.TotalCents) / 100 * float64(r.PointsPerUnit) * m
+	}
+	points *= float64(total-paidWithPoints) / float64(total)
+	return int64(math.Floor(points*tier.Multiplier + 1e-9))
+}
+
+// refundPoints works out what a refund takes back of the points the
+// original sale earned and gives back of those it was paid with, both in
+// proportion; the refund that completes the return settles the remainder.
+func refundPoints(orig *Sale, prior []Sale, refund *Sale) (earned, redeemed int64) {
+	var doneTotal, doneEarned, doneRedeemed, donePoints int64
+	for _, r := range prior {
+		doneTotal -= r.Total
+		doneEarned -= r.PointsEarned
+		doneRedeemed -= r.PointsRedeemed
+		donePoints -= paidWith(r.Payments, MethodPoints)
+	}
+	if orig.PointsEarned != 0 && orig.Total > 0 {
+		back := -refund.Total
+		earned = -orig.PointsEarned * back / orig.Total
+		if doneTotal+back >= orig.Total {
+			earned = -(orig.PointsEarned - doneEarned)
+		}
+	}
+	if taken := paidWith(orig.Payments, MethodPoints); orig.PointsRedeemed != 0 && taken > 0 {
+		back := -paidWith(refund.Payments, MethodPoints)
+		redeemed = -orig.PointsRedeemed * back / taken
+		if back > 0 && donePoints+back >= taken {
+			redeemed = -(orig.PointsRedeemed - doneRedeemed)
+		}
+	}
+	return earned, redeemed
+}
+
+// pointsEntries turns a journalled sale's points into ledger entries.
+func pointsEntries(sale *Sale) []PointsEntry {
+	var out []PointsEntry
+	add := func(kind string, points int64) {
+		if points != 0 {
+			out = append(out, PointsEntry{CustomerID: sale.CustomerID, Kind: kind, Points: points,
+				ReceiptNo: sale.ReceiptNo, Terminal: sale.Terminal, CreatedAt: sale.CreatedAt})
+		}
+	}
+	if sale.Kind == KindRefund {
+		add(PointsReverse, sale.PointsEarned)
+		add(PointsReturn, -sale.PointsRedeemed)
+	} else {
+		add(PointsEarn, sale.PointsEarned)
+	}
+	return out
+}
+
+// paidWith sums the payments made with method.
+func paidWith(payments []Payment, method string) int64 {
+	var n int64
+	for _, p := range payments {
+		if p.Method == method {
+			n += p.AmountCents
+		}
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+func TestLoyaltyPoints(t *testing.T) {
+	items := mapResolver{
+		"TEA":  {SKU: "TEA", Name: "Tea", Qty: 1, PriceCents: 1000},
+		"WINE": {SKU: "WINE", Name: "Wine", Qty: 1, PriceCents: 1000, Category: "wine"},
+	}
+	f := newFixture(t)
+	customers, ledger := f.customers, f.loyalty
+	c, _ := customers.Save(Customer{Name: "Sam", Card: "L1"})
+	s := NewServiceWithResolver(Config{Tax: PercentTaxEngine{RatePercent: 0}, Journal: f.journal, Customers: customers, Loyalty: ledger}, items)
+	err := s.SetLoyaltyRules(common.LoyaltyRules{Enabled: true, PointsPerUnit: 10, PointValueCents: 1,
+		Categories: map[string]float64{"wine": 2},
+		Tiers:      []common.LoyaltyTier{{Name: "Gold", MinPoints: 500, Multiplier: 1.5}, {Name: "Silver", MinPoints: 200, Multiplier: 1.2}}})
+	if err != nil {
+		t.Fatalf("SetLoyaltyRules: %v", err)
+	}
+
+	// 10 points per unit on tea, double on wine: 100 + 200
+	_, _ = s.Scan("T1", "TEA")
+	_, _ = s.Scan("T1", "WINE")
+	if _, err := s.Tender("T1", 0, MethodPoints); !errors.Is(err, ErrNoCustomer) {
+		t.Fatalf("points without customer err = %v", err)
+	}
+	_, _ = s.Scan("T1", "L1")
+	first, err := s.Tender("T1", 0, MethodCard)
+	if err != nil || first.PointsEarned != 300 {
+		t.Fatalf("first sale = %+v, %v", first, err)
+	}
+	// now Silver: 1.2 times, and the part paid with points earns nothing
+	_, _ = s.Scan("T2", "L1")
+	b, _ := s.Scan("T2", "TEA")
+	if b.Loyalty == nil || b.Loyalty.Points != 300 || b.Loyalty.Tier != "Silver" {
+		t.Fatalf("status = %+v", b.Loyalty)
+	}
+	if _, err := s.Tender("T2", 200, MethodPoints); err != nil {
+		t.Fatalf("points tender: %v", err)
+	}
+	second, err := s.Tender("T2", 0, MethodCash)
+	if err != nil || second.PointsRedeemed != 200 || second.PointsEarned != 96 {
+		t.Fatalf("second sale = %+v, %v", second, err)
+	}
+	if st, _ := s.Loyalty(c.ID); st.Points != 196 || st.Lifetime != 396 {
+		t.Fatalf("balance = %+v", st)
+	}
+	_, _ = s.Scan("T3", "L1")
+	_, _ = s.Scan("T3", "TEA")
+	if _, err := s.Tender("T3", 0, MethodPoints); !errors.Is(err, ErrPointsBalance) {
+		t.Fatalf("overspend err = %v", err)
+	}
+
+	// refunding both sales in full puts the ledger back to nothing
+	if _, err := s.Refund("T1", RefundRequest{ReceiptNo: first.ReceiptNo, Lines: []RefundLine{{LineNo: 2, Qty: 1}}}); err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	if _, err := s.Refund("T1", RefundRequest{ReceiptNo: first.ReceiptNo}); err != nil {
+		t.Fatalf("rest of refund: %v", err)
+	}
+	r, err := s.Refund("T2", RefundRequest{ReceiptNo: second.ReceiptNo})
+	if err != nil || r.PointsEarned != -96 || r.PointsRedeemed != -200 {
+		t.Fatalf("refund = %+v, %v", r, err)
+	}
+	if st, _ := s.Loyalty(c.ID); st.Points != 0 || st.Lifetime != 0 || st.Tier != "" {
+		t.Fatalf("after refunds = %+v", st)
+	}
+	entries, _ := s.LoyaltyStatement(c.ID)
+	if len(entries) != 7 || entries[0].Kind != PointsEarn || entries[1].Kind != PointsRedeem {
+		t.Fatalf("ledger = %+v", entries)
+	}
+}
+
+func TestPointsPayInWholePoints(t *testing.T) {
+	items := mapResolver{"TEA": {SKU: "TEA", Name: "Tea", Qty: 1, PriceCents: 1000}}
+	f := newFixture(t)
+	customers, ledger := f.customers, f.loyalty
+	c, _ := customers.Save(Customer{Name: "Sam", Card: "L1"})
+	s := NewServiceWithResolver(Config{Tax: PercentTaxEngine{RatePercent: 0}, Journal: f.journal, Customers: customers, Loyalty: ledger}, items)
+	if err := s.SetLoyaltyRules(common.LoyaltyRules{Enabled: true, PointsPerUnit: 100, PointValueCents: 3}); err != nil {
+		t.Fatalf("SetLoyaltyRules: %v", err)
+	}
+	_, _ = s.Scan("T1", "L1")
+	_, _ = s.Scan("T1", "TEA")
+	if _, err := s.Tender("T1", 0, MethodCard); err != nil {
+		t.Fatalf("earning tender: %v", err)
+	}
+
+	// 1000 cents at 3 a point is 333 points for 999; a cent stays due
+	_, _ = s.Scan("T2", "L1")
+	_, _ = s.Scan("T2", "TEA")
+	if _, err := s.Tender("T2", 2, MethodPoints); !errors.Is(err, ErrPointsAmount) {
+		t.Fatalf("less than a point err = %v", err)
+	}
+	if sale, err := s.Tender("T2", 0, MethodPoints); err != nil || sale != nil {
+		t.Fatalf("points tender = %+v, %v", sale, err)
+	}
+	b := s.Basket("T2")
+	if b.Due != 1 || b.Payments[0].AmountCents != 999 || b.Payments[0].Points != 333 {
+		t.Fatalf("after points due=%d payments=%+v", b.Due, b.Payments)
+	}
+	if st, _ := s.Loyalty(c.ID); st.Points != 667 {
+		t.Fatalf("balance = %+v", st)
+	}
+	sale, err := s.Tender("T2", 0, MethodCash)
+	if err != nil || sale == nil || sale.PointsRedeemed != 333 {
+		t.Fatalf("rest in cash = %+v, %v", sale, err)
+	}
+}
@@ -0,0 +1,175 @@
+package pos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrOptionsNeeded = errors.New("choose the item's options")
+	ErrNoOptions     = errors.New("item has no options")
+	ErrOptionChoice  = errors.New("not one of the item's options")
+	ErrOptionCount   = errors.New("wrong number of choices")
+	ErrOptionGroup   = errors.New("option groups need a name, choices and a minimum no more than the maximum")
+)
+
+// OptionGroup is a set of choices a catalog item is sold with, such as
+// the milk in a coffee. Min choices must be made, 0 making the group
+// optional; Max limits them, 0 for no limit.
+type OptionGroup struct {
+	Name    string   `json:"name"`
+	Min     int      `json:"min,omitempty"`
+	Max     int      `json:"max,omitempty"`
+	Choices []Option `json:"choices"`
+}
+
+// Option is a choice in a group and what it adds to the unit price, which
+// may be nothing ("no onions") or a reduction.
+type Option struct {
+	Name       string `json:"name"`
+	PriceCents int64  `json:"priceCents,omitempty"`
+}
+
+// Modifier is a choice made for a basket line.
+type Modifier struct {
+	Group      string `json:"group"`
+	Name       string `json:"name"`
+	PriceCents int64  `json:"priceCents,omitempty"`
+}
+
+// ValidateOptions checks an item's option groups before they are saved.
+func ValidateOptions(groups []OptionGroup) error {
+	for _, g := range groups {
+		if strings.TrimSpace(g.Name) == "" || len(g.Choices) == 0 || g.Min < 0 || g.Max < 0 ||
+			g.Max > 0 && g.Min > g.Max || g.Min > len(g.Choices) {
+			return ErrOptionGroup
+		}
+		for _, c := range g.Choices {
+			if strings.TrimSpace(c.Name) == "" {
+				return ErrOptionGroup
+			}
+		}
+	}
+	return nil
+}
+
+// ChooseModifiers checks picks against the item's option groups and
+// returns them priced from the groups, in the order the groups list them,
+// so the same choices always come out the same. Picks are matched by group
+// and choice name, ignoring case.
+func ChooseModifiers(groups []OptionGroup, picks []Modifier) ([]Modifier, error) {
+	if len(picks) > 0 && len(groups) == 0 {
+		return nil, ErrNoOptions
+	}
+	picked := map[string]bool{}
+	for _, p := range picks {
+		key := strings.ToLower(strings.TrimSpace(p.Group) + "\x00" + strings.TrimSpace(p.Name))
+		if picked[key] {
+			return nil, fmt.Errorf("%w: %s chosen twice", ErrOptionChoice, p.Name)
+		}
+		picked[key] = true
+	}
+	var out []Modifier
+	for _, g := range groups {
+		n := 0
+		for _, c := range g.Choices {
+			key := strings.ToLower(g.Name + "\x00" + c.Name)
+			if picked[key] {
+				out = append(out, Modifier{Group: g.Name, Name: c.Name, PriceCents: c.PriceCents})
+				delete(picked, key)
+				n++
+			}
+		}
+		if n < g.Min || g.Max > 0 && n > g.Max {
+			return nil, fmt.Errorf("%w for %s", ErrOptionCount, g.Name)
+		}
+	}
+	if len(picked) > 0 {
+		return nil, ErrOptionChoice
+	}
+	return out, nil
+}
+
+// needsOptions reports whether an item can't be sold until choices are made.
+func needsOptions(groups []OptionGroup) bool {
+	for _, g := range groups {
+		if g.Min > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// modifierCents sums what modifiers add to a unit price.
+func modifierCents(mods []Modifier) int64 {
+	var n int64
+	for _, m := range mods {
+		n += m.PriceCents
+	}
+	return n
+}
+
+// HasModifier reports whether the line was made with the named choice.
+func (l BasketLine) HasModifier(group, name string) bool {
+	for _, m := range l.Modifiers {
+		if m.Group == group && m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sameModifiers(a, b []Modifier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanWithModifiers adds qty of the item with code made with the chosen
+// modifiers, which are added to its unit price. Lines only merge with
+// the same choices.
+func (s *Service) ScanWithModifiers(terminal, code string, qty float64, picks []Modifier) (*Basket, error) {
+	if qty <= 0 {
+		qty = 1
+	}
+	code = strings.TrimSpace(code)
+	item, ok, err := s.resolve(code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, code)
+	}
+	if item.OpenPrice {
+		return nil, ErrPriceNeeded
+	}
+	if item.Modifiers, err = ChooseModifiers(item.Options, picks); err != nil {
+		return nil, err
+	}
+	return s.addItem(terminal, item, qty)
+}
+
+// SetLineModifiers changes the choices made for a line, repricing it.
+func (s *Service) SetLineModifiers(terminal string, lineNo int, picks []Modifier) (*Basket, error) {
+	return s.editLine(terminal, lineNo, func(b *Basket, i int) error {
+		l := &b.Lines[i]
+		mods, err := ChooseModifiers(l.Options, picks)
+		if err != nil {
+			return err
+		}
+		delta := modifierCents(mods) - modifierCents(l.Modifiers)
+		l.PriceCents += delta
+		if l.Overridden() {
+			l.OriginalPriceCents += delta
+		}
+		l.Modifiers = mods
+		return nil
+	})
+}
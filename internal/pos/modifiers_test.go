@@ -0,0 +1,52 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestModifiers(t *testing.T) {
+	latte := BasketLine{SKU: "LAT", Name: "Latte", Qty: 1, PriceCents: 300, Options: []OptionGroup{
+		{Name: "Milk", Min: 1, Max: 1, Choices: []Option{{Name: "Whole"}, {Name: "Oat", PriceCents: 30}}},
+		{Name: "Extras", Max: 2, Choices: []Option{{Name: "Extra shot", PriceCents: 50}, {Name: "No foam"}}},
+	}}
+	j := newFixture(t).journal
+	s := NewServiceWithResolver(Config{Journal: j}, mapResolver{"LAT": latte})
+	if err := ValidateOptions([]OptionGroup{{Name: "Milk", Min: 2, Max: 1, Choices: latte.Options[0].Choices}}); !errors.Is(err, ErrOptionGroup) {
+		t.Fatalf("min over max err = %v", err)
+	}
+	if _, err := s.Scan("T1", "LAT"); !errors.Is(err, ErrOptionsNeeded) {
+		t.Fatalf("scan without options err = %v", err)
+	}
+	oat := []Modifier{{Group: "milk", Name: "oat"}}
+	if _, err := s.ScanWithModifiers("T1", "LAT", 1, append(oat, Modifier{Group: "Milk", Name: "Whole"})); !errors.Is(err, ErrOptionCount) {
+		t.Fatalf("two milks err = %v", err)
+	}
+	if _, err := s.ScanWithModifiers("T1", "LAT", 1, append(oat, Modifier{Group: "Extras", Name: "Syrup"})); !errors.Is(err, ErrOptionChoice) {
+		t.Fatalf("unknown choice err = %v", err)
+	}
+
+	// the same choices merge; different ones make their own line
+	_, _ = s.ScanWithModifiers("T1", "LAT", 1, oat)
+	_, _ = s.ScanWithModifiers("T1", "LAT", 1, oat)
+	_, _ = s.ScanWithModifiers("T1", "LAT", 1, []Modifier{{Group: "Milk", Name: "Whole"}})
+	b, err := s.ScanWithModifiers("T1", "LAT", 1, []Modifier{{Group: "Extras", Name: "Extra shot"}, {Group: "Milk", Name: "Oat"}})
+	if err != nil || len(b.Lines) != 3 || b.Lines[0].Qty != 2 || b.Lines[0].PriceCents != 330 || b.Lines[1].PriceCents != 300 {
+		t.Fatalf("basket = %+v, %v", b, err)
+	}
+	if m := b.Lines[2].Modifiers; len(m) != 2 || m[0].Name != "Oat" || m[1].Name != "Extra shot" || b.Lines[2].PriceCents != 380 {
+		t.Fatalf("modifiers = %+v at %d", m, b.Lines[2].PriceCents)
+	}
+	if b, err = s.SetLineModifiers("T1", 2, oat); err != nil || b.Lines[1].PriceCents != 330 || b.Subtotal != 660+330+380 {
+		t.Fatalf("SetLineModifiers = %+v, %v", b, err)
+	}
+
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if err != nil || sale == nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	got, err := j.Get(sale.ReceiptNo)
+	if err != nil || len(got.Lines[2].Modifiers) != 2 || got.Lines[2].Modifiers[1].PriceCents != 50 {
+		t.Fatalf("journalled lines = %+v, %v", got.Lines, err)
+	}
+}
@@ -0,0 +1,36 @@
+package pos
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrPriceNeeded  = errors.New("key in a price for this item")
+	ErrNotOpenPrice = errors.New("only department keys and open-price items take a keyed price")
+)
+
+// KeyPrice sells qty of an open-price item, such as a department key, at
+// priceCents. Each sale is its own line; note records what was sold (e.g.
+// the barcode that wasn't found).
+func (s *Service) KeyPrice(terminal, code string, priceCents int64, qty float64, note string) (*Basket, error) {
+	if priceCents <= 0 {
+		return nil, ErrPriceNeeded
+	}
+	if qty <= 0 {
+		qty = 1
+	}
+	item, ok, err := s.resolve(strings.TrimSpace(code))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	if !item.OpenPrice {
+		return nil, ErrNotOpenPrice
+	}
+	item.PriceCents, item.Note = priceCents, strings.TrimSpace(note)
+	return s.addItem(terminal, item, qty)
+}
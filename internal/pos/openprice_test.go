@@ -0,0 +1,43 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnknownCodesAndDepartmentKeys(t *testing.T) {
+	items := mapResolver{
+		"A":      {SKU: "A", Name: "A", Qty: 1, PriceCents: 1000},
+		"DEPT-1": {SKU: "DEPT-1", Name: "Grocery", Qty: 1, OpenPrice: true},
+	}
+	j := newFixture(t).journal
+	s := NewServiceWithResolver(Config{Journal: j, Tax: PercentTaxEngine{RatePercent: 20}}, items)
+
+	if _, err := s.Scan("T1", "5000000000001"); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("unknown scan err = %v", err)
+	}
+	if _, err := s.Scan("T1", "DEPT-1"); !errors.Is(err, ErrPriceNeeded) {
+		t.Fatalf("department scan err = %v", err)
+	}
+	if _, err := s.KeyPrice("T1", "A", 500, 1, ""); !errors.Is(err, ErrNotOpenPrice) {
+		t.Fatalf("priced item err = %v", err)
+	}
+	if _, err := s.KeyPrice("T1", "DEPT-1", 0, 1, ""); !errors.Is(err, ErrPriceNeeded) {
+		t.Fatalf("zero price err = %v", err)
+	}
+
+	// each keyed price is its own line and keeps the note
+	_, _ = s.KeyPrice("T1", "DEPT-1", 250, 1, "Barcode 5000000000001")
+	b, err := s.KeyPrice("T1", "DEPT-1", 400, 2, "")
+	if err != nil || len(b.Lines) != 2 || b.Lines[1].PriceCents != 400 || b.Lines[1].Qty != 2 || b.Total != 1260 {
+		t.Fatalf("basket = %+v, %v", b, err)
+	}
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if err != nil {
+		t.Fatalf("tender: %v", err)
+	}
+	got, _ := j.Get(sale.ReceiptNo)
+	if !got.Lines[0].OpenPrice || got.Lines[0].Note != "Barcode 5000000000001" || got.Lines[0].PriceCents != 250 {
+		t.Fatalf("journalled = %+v", got.Lines)
+	}
+}
@@ -0,0 +1,112 @@
+package pos
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultParkTTL is how long a parked basket waits when Config.ParkTTL is unset.
+const DefaultParkTTL = 24 * time.Hour
+
+var (
+	ErrParkedNotFound = errors.New("parked basket not found or expired")
+	ErrBasketNotEmpty = errors.New("basket is not empty; park or finish it first")
+	ErrNoParking      = errors.New("parking is not configured")
+)
+
+// ParkedBasket is a basket set aside so the till can serve someone else.
+// Any till can recall it until it expires.
+type ParkedBasket struct {
+	ID        int64     `json:"id"`
+	Label     string    `json:"label,omitempty"`
+	Terminal  string    `json:"terminal"` // where it was parked
+	ParkedAt  time.Time `json:"parkedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Basket    Basket    `json:"basket"`
+}
+
+// ParkStore keeps parked baskets. Recall removes the basket so only one
+// till gets it.
+type ParkStore interface {
+	Park(p ParkedBasket) (ParkedBasket, error)
+	Recall(id int64, at time.Time) (ParkedBasket, error)
+	List(at time.Time) ([]ParkedBasket, error) // unexpired, oldest first
+}
+
+// Park moves the terminal's basket into the park store and leaves the
+// terminal with an empty one. Baskets part way through tendering can't
+// be parked.
+func (s *Service) Park(terminal, label string) (*ParkedBasket, error) {
+	if s.cfg.Parking == nil {
+		return nil, ErrNoParking
+	}
+	var out ParkedBasket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if len(b.Lines) == 0 {
+			return ErrEmptyBasket
+		}
+		if err := b.locked(); err != nil {
+			return err
+		}
+		if b.AgeCheck != nil {
+			return ErrAgePending
+		}
+		ttl := s.cfg.ParkTTL
+		if ttl <= 0 {
+			ttl = DefaultParkTTL
+		}
+		now := s.now()
+		p, err := s.cfg.Parking.Park(ParkedBasket{
+			Label:     strings.TrimSpace(label),
+			Terminal:  terminal,
+			ParkedAt:  now,
+			ExpiresAt: now.Add(ttl),
+			Basket:    b.clone(),
+		})
+		if err != nil {
+			return err
+		}
+		out = p
+		*b = Basket{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Recall takes a parked basket back onto the terminal, which must have an
+// empty basket. Prices stay as parked; promotions are re-applied.
+func (s *Service) Recall(terminal string, id int64) (*Basket, error) {
+	if s.cfg.Parking == nil {
+		return nil, ErrNoParking
+	}
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if !b.empty() {
+			return ErrBasketNotEmpty
+		}
+		p, err := s.cfg.Parking.Recall(id, s.now())
+		if err != nil {
+			return err
+		}
+		*b = p.Basket
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Parked lists the baskets waiting to be recalled.
+func (s *Service) Parked() ([]ParkedBasket, error) {
+	if s.cfg.Parking == nil {
+		return nil, nil
+	}
+	return s.cfg.Parking.List(s.now())
+}
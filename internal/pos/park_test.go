@@ -0,0 +1,52 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParkAndRecall(t *testing.T) {
+	f := newFixture(t)
+	path, store := f.path, f.parking
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	s := NewService(Config{Parking: store, ParkTTL: time.Hour})
+	s.now = func() time.Time { return now }
+
+	_, _ = s.ScanQty("T1", "A", 2)
+	p, err := s.Park("T1", " Mrs Smith ")
+	if err != nil || p.Label != "Mrs Smith" {
+		t.Fatalf("Park = %+v, %v", p, err)
+	}
+	if b := s.Basket("T1"); len(b.Lines) != 0 {
+		t.Fatalf("basket after park = %+v", b.Lines)
+	}
+	_, _ = s.Scan("T1", "B")
+
+	// another till with the same database recalls it after a restart
+	store2, err := NewSQLiteParkStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	s2 := NewService(Config{Parking: store2})
+	s2.now = s.now
+	b, err := s2.Recall("T2", p.ID)
+	if err != nil || len(b.Lines) != 1 || b.Lines[0].Qty != 2 || b.Total != 500 {
+		t.Fatalf("Recall = %+v, %v", b, err)
+	}
+	if _, err := s.Recall("T3", p.ID); !errors.Is(err, ErrParkedNotFound) {
+		t.Fatalf("second recall err = %v", err)
+	}
+
+	p2, _ := s.Park("T1", "")
+	if _, err := s2.Recall("T2", p2.ID); !errors.Is(err, ErrBasketNotEmpty) {
+		t.Fatalf("recall onto busy till err = %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if list, _ := s.Parked(); len(list) != 0 {
+		t.Fatalf("expired baskets listed: %+v", list)
+	}
+	if _, err := s.Recall("T1", p2.ID); !errors.Is(err, ErrParkedNotFound) {
+		t.Fatalf("expired recall err = %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package pos
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Ledgers a journalled sale is posted to after it is recorded.
+const (
+	LedgerGiftCards = "giftcards"
+	LedgerPoints    = "points"
+)
+
+// markPending lists on the sale, before it is journalled, the ledgers it
+// has entries for, so the journal holds them until they are posted.
+func (s *Service) markPending(sale *Sale) {
+	sale.Pending = nil
+	if s.cfg.GiftCards != nil && hasGiftCardEntries(sale) {
+		sale.Pending = append(sale.Pending, LedgerGiftCards)
+	}
+	if s.cfg.Loyalty != nil && len(pointsEntries(sale)) > 0 {
+		sale.Pending = append(sale.Pending, LedgerPoints)
+	}
+}
+
+// postLedgers posts a journalled sale to the ledgers pending on it and
+// clears each in the journal once done. A ledger that fails stays pending
+// for RetryPosts and its error is returned.
+func (s *Service) postLedgers(sale *Sale) error {
+	var errs []error
+	var left []string
+	for _, ledger := range sale.Pending {
+		var err error
+		switch ledger {
+		case LedgerGiftCards:
+			err = s.postGiftCards(sale)
+		case LedgerPoints:
+			err = s.postPoints(sale)
+		}
+		if err == nil && s.cfg.Journal != nil {
+			err = s.cfg.Journal.MarkPosted(sale.ReceiptNo, ledger)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s not posted: %w", ledger, err))
+			left = append(left, ledger)
+		}
+	}
+	sale.Pending = left
+	return errors.Join(errs...)
+}
+
+// RetryPosts posts the journalled sales whose ledger entries didn't go
+// through when they were taken. Ledgers skip entries already written for
+// a receipt, so a sale posted twice over is only counted once.
+func (s *Service) RetryPosts() error {
+	if s.cfg.Journal == nil {
+		return nil
+	}
+	sales, err := s.cfg.Journal.Unposted()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range sales {
+		if err := s.postLedgers(&sales[i]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sales[i].ReceiptNo, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+// flakyGiftCards fails every Post while down is set.
+type flakyGiftCards struct {
+	*SQLiteGiftCardStore
+	down bool
+}
+
+func (f *flakyGiftCards) Post(entries []GiftCardEntry) error {
+	if f.down {
+		return errors.New("ledger offline")
+	}
+	return f.SQLiteGiftCardStore.Post(entries)
+}
+
+func TestGiftCardLoadsArePostedLater(t *testing.T) {
+	f := newFixture(t)
+	j, store := f.journal, f.giftCards
+	cards := &flakyGiftCards{SQLiteGiftCardStore: store, down: true}
+	s := NewServiceWithResolver(Config{Journal: j, GiftCards: cards}, mapResolver{})
+
+	// the customer has paid, so the sale stands and the load waits
+	_, _ = s.SellGiftCard("T1", "GC-9999", 2500)
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if sale == nil || err == nil {
+		t.Fatalf("tender with ledger down = %+v, %v", sale, err)
+	}
+	if _, err := s.GiftCard("GC9999"); !errors.Is(err, ErrGiftCardNotFound) {
+		t.Fatalf("card before retry err = %v", err)
+	}
+	if pending, _ := j.Unposted(); len(pending) != 1 || pending[0].Pending[0] != LedgerGiftCards {
+		t.Fatalf("unposted = %+v", pending)
+	}
+	if err := s.RetryPosts(); err == nil {
+		t.Fatal("retry with ledger down succeeded")
+	}
+
+	cards.down = false
+	if err := s.RetryPosts(); err != nil {
+		t.Fatalf("RetryPosts: %v", err)
+	}
+	if pending, _ := j.Unposted(); len(pending) != 0 {
+		t.Fatalf("still unposted = %+v", pending)
+	}
+	// posting the same sale again doesn't load the card twice
+	if err := s.postGiftCards(sale); err != nil {
+		t.Fatalf("repost: %v", err)
+	}
+	if g, err := s.GiftCard("GC9999"); err != nil || g.BalanceCents != 2500 {
+		t.Fatalf("card after retry = %+v, %v", g, err)
+	}
+}
+
+// flakyLedger fails every Post while down is set.
+type flakyLedger struct {
+	*SQLiteLoyaltyLedger
+	down bool
+}
+
+func (f *flakyLedger) Post(entries []PointsEntry) error {
+	if f.down {
+		return errors.New("ledger offline")
+	}
+	return f.SQLiteLoyaltyLedger.Post(entries)
+}
+
+func TestPointsArePostedLater(t *testing.T) {
+	items := mapResolver{"TEA": {SKU: "TEA", Name: "Tea", Qty: 1, PriceCents: 1000}}
+	f := newFixture(t)
+	j, customers, store := f.journal, f.customers, f.loyalty
+	ledger := &flakyLedger{SQLiteLoyaltyLedger: store}
+	c, _ := customers.Save(Customer{Name: "Sam", Card: "L1"})
+	s := NewServiceWithResolver(Config{Tax: PercentTaxEngine{RatePercent: 0}, Journal: j, Customers: customers, Loyalty: ledger}, items)
+	if err := s.SetLoyaltyRules(common.LoyaltyRules{Enabled: true, PointsPerUnit: 10, PointValueCents: 1}); err != nil {
+		t.Fatalf("SetLoyaltyRules: %v", err)
+	}
+	_, _ = s.Scan("T1", "L1")
+	_, _ = s.Scan("T1", "TEA")
+	ledger.down = true
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if sale == nil || err == nil || sale.PointsEarned != 100 {
+		t.Fatalf("tender with ledger down = %+v, %v", sale, err)
+	}
+	if pending, _ := j.Unposted(); len(pending) != 1 || pending[0].Pending[0] != LedgerPoints {
+		t.Fatalf("unposted = %+v", pending)
+	}
+	ledger.down = false
+	if err := s.RetryPosts(); err != nil {
+		t.Fatalf("RetryPosts: %v", err)
+	}
+	if err := s.postPoints(sale); err != nil {
+		t.Fatalf("repost: %v", err)
+	}
+	if st, _ := s.Loyalty(c.ID); st.Points != 100 {
+		t.Fatalf("balance after retry = %+v", st)
+	}
+	if pending, _ := j.Unposted(); len(pending) != 0 {
+		t.Fatalf("still unposted = %+v", pending)
+	}
+}
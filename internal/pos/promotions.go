@@ -0,0 +1,335 @@
+package pos
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Promotion kinds.
+const (
+	PromoMultiBuy = "multibuy" // Qty matching items for PriceCents ("3 for £5"), mixed freely
+	PromoBOGO     = "bogo"     // buy Qty, get FreeQty of the cheapest at Percent off (default free)
+	PromoMealDeal = "mealdeal" // one item from each group for PriceCents
+	PromoPercent  = "percent"  // Percent off each matching item
+	PromoAmount   = "amount"   // AmountCents off each matching item
+	PromoBasket   = "basket"   // Percent or AmountCents off the basket once it reaches MinSpendCents
+)
+
+var (
+	ErrPromoID   = errors.New("promotion id is required")
+	ErrPromoKind = errors.New("unknown promotion kind")
+	ErrPromoRule = errors.New("promotion is missing its quantity, price or discount")
+)
+
+// PromoMatch selects basket items by SKU or category. An empty match
+// selects every item.
+type PromoMatch struct {
+	SKUs       []string `json:"skus,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+func (m PromoMatch) matches(l BasketLine) bool {
+	if len(m.SKUs) == 0 && len(m.Categories) == 0 {
+		return true
+	}
+	for _, s := range m.SKUs {
+		if s == l.SKU {
+			return true
+		}
+	}
+	for _, c := range m.Categories {
+		if l.Category != "" && strings.EqualFold(c, l.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+// Promotion is a discount rule. Rules run highest Priority first and each
+// item unit takes part in at most one item rule; basket rules run after
+// all item rules on what is left to pay. A rule with MinSpendCents only
+// applies once the basket, less earlier discounts, reaches it. An Exclusive
+// rule only applies to a basket no other rule has discounted, and stops any
+// further rules.
+type Promotion struct {
+	ID            string       `json:"id"`
+	Name          string       `json:"name"`
+	Kind          string       `json:"kind"`
+	Match         PromoMatch   `json:"match"`
+	Groups        []PromoMatch `json:"groups,omitempty"` // meal deal components
+	Qty           int          `json:"qty,omitempty"`
+	FreeQty       int          `json:"freeQty,omitempty"`
+	Percent       int          `json:"percent,omitempty"`
+	PriceCents    int64        `json:"priceCents,omitempty"`
+	AmountCents   int64        `json:"amountCents,omitempty"`
+	MinSpendCents int64        `json:"minSpendCents,omitempty"`
+	Priority      int          `json:"priority"`
+	Exclusive     bool         `json:"exclusive"`
+	From          time.Time    `json:"from"`  // zero means no start
+	Until         time.Time    `json:"until"` // zero means no end
+}
+
+// Validate checks the rule has what its kind needs.
+func (p Promotion) Validate() error {
+	if strings.TrimSpace(p.ID) == "" {
+		return ErrPromoID
+	}
+	ok := true
+	switch p.Kind {
+	case PromoMultiBuy:
+		ok = p.Qty > 1 && p.PriceCents >= 0
+	case PromoBOGO:
+		ok = p.Qty > 0 && p.Percent >= 0 && p.Percent <= 100
+	case PromoMealDeal:
+		ok = len(p.Groups) > 1 && p.PriceCents >= 0
+	case PromoPercent:
+		ok = p.Percent > 0 && p.Percent <= 100
+	case PromoAmount:
+		ok = p.AmountCents > 0
+	case PromoBasket:
+		ok = (p.Percent > 0 && p.Percent <= 100) != (p.AmountCents > 0)
+	default:
+		return ErrPromoKind
+	}
+	if !ok {
+		return ErrPromoRule
+	}
+	return nil
+}
+
+// ActiveAt reports whether t falls in the rule's validity window.
+func (p Promotion) ActiveAt(t time.Time) bool {
+	return (p.From.IsZero() || !t.Before(p.From)) && (p.Until.IsZero() || t.Before(p.Until))
+}
+
+// Promotions supplies the rules in force; see SQLitePromotionStore.
+type Promotions interface {
+	Active(at time.Time) []Promotion
+}
+
+// Discount is one promotion applied to a basket, shown as its own line on
+// receipts. AmountCents is positive and already spread over Lines.
+type Discount struct {
+	PromoID     string `json:"promoId"`
+	Name        string `json:"name"`
+	AmountCents int64  `json:"amountCents"`
+	Lines       []int  `json:"lines,omitempty"` // line numbers it was taken from
+}
+
+// unit is one item of a line still free to take part in a promotion.
+type unit struct {
+	line  int // index into the basket lines
+	price int64
+}
+
+// ApplyPromotions works out the discounts on lines, setting each line's
+// DiscountCents. Lines with an overridden price are left alone.
+func ApplyPromotions(lines []BasketLine, promos []Promotion) []Discount {
+	for i := range lines {
+		lines[i].DiscountCents = 0
+	}
+	if len(promos) == 0 {
+		return nil
+	}
+	promos = append([]Promotion(nil), promos...)
+	sort.SliceStable(promos, func(i, j int) bool {
+		bi, bj := promos[i].Kind == PromoBasket, promos[j].Kind == PromoBasket
+		if bi != bj {
+			return bj
+		}
+		if promos[i].Priority != promos[j].Priority {
+			return promos[i].Priority > promos[j].Priority
+		}
+		return promos[i].ID < promos[j].ID
+	})
+	// units still free per line; a weighed line counts as one
+	avail := make([]int, len(lines))
+	for i, l := range lines {
+		switch {
+		case !l.promotable() || l.Qty <= 0:
+		case l.Unit != "":
+			avail[i] = 1
+		default:
+			avail[i] = int(l.Qty)
+		}
+	}
+	var out []Discount
+	for _, p := range promos {
+		if p.Exclusive && len(out) > 0 {
+			continue
+		}
+		if p.MinSpendCents > 0 && netOf(lines) < p.MinSpendCents {
+			continue
+		}
+		off := make([]int64, len(lines))
+		var total int64
+		if p.Kind == PromoBasket {
+			total = basketDiscount(p, lines, off)
+		} else {
+			total = itemDiscount(p, lines, avail, off)
+		}
+		if total <= 0 {
+			continue
+		}
+		d := Discount{PromoID: p.ID, Name: p.Name, AmountCents: total}
+		if d.Name == "" {
+			d.Name = p.ID
+		}
+		for i, c := range off {
+			if c != 0 {
+				lines[i].DiscountCents += c
+				d.Lines = append(d.Lines, lines[i].LineNo)
+			}
+		}
+		out = append(out, d)
+		if p.Exclusive {
+			break
+		}
+	}
+	return out
+}
+
+// itemDiscount applies an item rule, using up the units it discounts.
+func itemDiscount(p Promotion, lines []BasketLine, avail []int, off []int64) int64 {
+	take := func(m PromoMatch) []unit {
+		var us []unit
+		for i, l := range lines {
+			// weighed lines only take part in percent and basket rules
+			if avail[i] > 0 && l.Unit == "" && m.matches(l) {
+				for k := 0; k < avail[i]; k++ {
+					us = append(us, unit{line: i, price: l.PriceCents})
+				}
+			}
+		}
+		// dearest first so bundles take the customer's best deal
+		sort.SliceStable(us, func(a, b int) bool { return us[a].price > us[b].price })
+		return us
+	}
+	var total int64
+	// bundle discounts amount off a set of units, shared by price
+	bundle := func(us []unit, amount int64) {
+		if amount <= 0 {
+			return
+		}
+		weights := make([]int64, len(us))
+		for k, u := range us {
+			weights[k] = u.price
+		}
+		for k, share := range allocate(amount, weights) {
+			off[us[k].line] += share
+		}
+		for _, u := range us {
+			avail[u.line]--
+		}
+		total += amount
+	}
+
+	switch p.Kind {
+	case PromoMultiBuy:
+		us := take(p.Match)
+		for k := 0; k+p.Qty <= len(us); k += p.Qty {
+			set := us[k : k+p.Qty]
+			bundle(set, unitSum(set)-p.PriceCents)
+		}
+	case PromoBOGO:
+		free, pct := max(p.FreeQty, 1), p.Percent
+		if pct == 0 {
+			pct = 100
+		}
+		us := take(p.Match)
+		n := p.Qty + free
+		for k := 0; k+n <= len(us); k += n {
+			set := us[k : k+n]
+			bundle(set, roundDiv(unitSum(set[p.Qty:])*int64(pct), 100))
+		}
+	case PromoMealDeal:
+		for {
+			var set []unit
+			for _, g := range p.Groups {
+				if us := take(g); len(us) > 0 {
+					set = append(set, us[0])
+					avail[us[0].line]-- // hold it so the next group can't pick it too
+				}
+			}
+			for _, u := range set {
+				avail[u.line]++
+			}
+			if len(set) < len(p.Groups) || unitSum(set) <= p.PriceCents {
+				return total
+			}
+			bundle(set, unitSum(set)-p.PriceCents)
+		}
+	case PromoPercent, PromoAmount:
+		for i, l := range lines {
+			if avail[i] == 0 || !p.Match.matches(l) {
+				continue
+			}
+			n := int64(avail[i])
+			var amount int64
+			switch {
+			case l.Unit != "" && p.Kind == PromoPercent:
+				amount = roundDiv(l.Amount()*int64(p.Percent), 100)
+			case l.Unit != "":
+				continue
+			case p.Kind == PromoPercent:
+				amount = roundDiv(l.PriceCents*n*int64(p.Percent), 100)
+			default:
+				amount = min(p.AmountCents, l.PriceCents) * n
+			}
+			if amount > 0 {
+				off[i] += amount
+				avail[i] = 0
+				total += amount
+			}
+		}
+	}
+	return total
+}
+
+// basketDiscount applies a basket rule over what the lines still cost.
+func basketDiscount(p Promotion, lines []BasketLine, off []int64) int64 {
+	weights := make([]int64, len(lines))
+	var net int64
+	for i, l := range lines {
+		if l.promotable() {
+			weights[i] = l.Net()
+			net += weights[i]
+		}
+	}
+	if net <= 0 {
+		return 0
+	}
+	amount := min(p.AmountCents, net)
+	if p.Percent > 0 {
+		amount = roundDiv(net*int64(p.Percent), 100)
+	}
+	for i, share := range allocate(amount, weights) {
+		off[i] += share
+	}
+	return amount
+}
+
+// netOf is what the lines cost after the discounts applied so far.
+func netOf(lines []BasketLine) int64 {
+	var n int64
+	for _, l := range lines {
+		if l.GiftCard == "" {
+			n += l.Net()
+		}
+	}
+	return n
+}
+
+// promotable reports whether promotions may discount the line; hand-priced
+// lines and gift cards are left alone.
+func (l BasketLine) promotable() bool { return !l.Overridden() && l.GiftCard == "" }
+
+func unitSum(us []unit) int64 {
+	var n int64
+	for _, u := range us {
+		n += u.price
+	}
+	return n
+}
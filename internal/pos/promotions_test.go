@@ -0,0 +1,58 @@
+package pos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPromotions(t *testing.T) {
+	items := mapResolver{
+		"S1": {SKU: "S1", Name: "Sandwich", Qty: 1, PriceCents: 300, Category: "mains"},
+		"S2": {SKU: "S2", Name: "Wrap", Qty: 1, PriceCents: 350, Category: "mains"},
+		"C":  {SKU: "C", Name: "Crisps", Qty: 1, PriceCents: 100, Category: "snacks"},
+		"D":  {SKU: "D", Name: "Drink", Qty: 1, PriceCents: 150, Category: "drinks"},
+	}
+	mealDeal := Promotion{ID: "meal", Name: "Meal deal", Kind: PromoMealDeal, PriceCents: 400, Priority: 10, Groups: []PromoMatch{
+		{Categories: []string{"mains"}}, {Categories: []string{"snacks"}}, {Categories: []string{"drinks"}},
+	}}
+	for _, tc := range []struct {
+		name   string
+		promos promoList
+		scan   map[string]int
+		want   int64 // total discount
+	}{
+		{"multibuy mixes items", promoList{{ID: "3for5", Kind: PromoMultiBuy, Qty: 3, PriceCents: 500, Match: PromoMatch{Categories: []string{"mains"}}}},
+			map[string]int{"S1": 2, "S2": 2}, 350 + 350 + 300 - 500},
+		{"bogo frees the cheapest", promoList{{ID: "bogo", Kind: PromoBOGO, Qty: 1, Match: PromoMatch{Categories: []string{"mains"}}}},
+			map[string]int{"S1": 1, "S2": 1}, 300},
+		{"meal deal", promoList{mealDeal}, map[string]int{"S2": 1, "C": 1, "D": 2}, 350 + 100 + 150 - 400},
+		{"units are not discounted twice", promoList{mealDeal, {ID: "drinks", Kind: PromoPercent, Percent: 10, Match: PromoMatch{Categories: []string{"drinks"}}}},
+			map[string]int{"S2": 1, "C": 1, "D": 2}, 200 + 15},
+		{"basket threshold after item promos", promoList{mealDeal, {ID: "spend", Kind: PromoBasket, AmountCents: 50, MinSpendCents: 500}},
+			map[string]int{"S2": 1, "C": 1, "D": 2}, 200 + 50},
+		{"exclusive stops others", promoList{mealDeal, {ID: "staff", Kind: PromoPercent, Percent: 50, Priority: 1, Exclusive: true}},
+			map[string]int{"S2": 1, "C": 1, "D": 1}, 200},
+		{"out of window", promoList{{ID: "old", Kind: PromoAmount, AmountCents: 50, Until: time.Now().Add(-time.Hour)}},
+			map[string]int{"C": 1}, 0},
+	} {
+		s := NewServiceWithResolver(Config{Promotions: tc.promos, Tax: PercentTaxEngine{RatePercent: 20}}, items)
+		for _, code := range []string{"S1", "S2", "C", "D"} {
+			if n := tc.scan[code]; n > 0 {
+				if _, err := s.ScanQty("T1", code, float64(n)); err != nil {
+					t.Fatalf("%s: ScanQty: %v", tc.name, err)
+				}
+			}
+		}
+		b := s.Basket("T1")
+		if b.Discount != tc.want {
+			t.Fatalf("%s: discount = %d; want %d (%+v)", tc.name, b.Discount, tc.want, b.Discounts)
+		}
+		var sum int64
+		for _, d := range b.Discounts {
+			sum += d.AmountCents
+		}
+		if sum != b.Discount || b.Subtotal-b.Discount+b.Tax != b.Total || b.Tax != roundDiv((b.Subtotal-b.Discount)*20, 100) {
+			t.Fatalf("%s: totals don't reconcile: %+v", tc.name, b)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package pos
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const MethodStoreCredit = "store_credit"
+
+var (
+	ErrNoJournal         = errors.New("refunds need a sales journal")
+	ErrNotRefundable     = errors.New("only sales can be refunded")
+	ErrNothingToRefund   = errors.New("nothing to refund")
+	ErrRefundExceedsSale = errors.New("refund exceeds the quantity sold")
+)
+
+// RefundLine selects a quantity of an original sale line to return.
+type RefundLine struct {
+	LineNo  int     `json:"lineNo"`
+	Qty     float64 `json:"qty"`
+	Restock bool    `json:"restock"`
+}
+
+type RefundRequest struct {
+	ReceiptNo string       `json:"receiptNo"`
+	Lines     []RefundLine `json:"lines"` // empty returns everything still refundable
+	// StoreCredit refunds as store credit instead of the original tenders.
+	StoreCredit bool   `json:"storeCredit"`
+	Reason      string `json:"reason"`
+}
+
+// RefundableLine is an original sale line with what is left to return.
+type RefundableLine struct {
+	BasketLine
+	Remaining float64 `json:"remaining"`
+}
+
+// Refundable looks up a sale by receipt and reports what can still be returned.
+func (s *Service) Refundable(receiptNo string) (*Sale, []RefundableLine, error) {
+	orig, _, done, err := s.refundState(receiptNo)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make([]RefundableLine, 0, len(orig.Lines))
+	for _, l := range orig.Lines {
+		out = append(out, RefundableLine{BasketLine: l, Remaining: RoundQty(l.Qty - done[l.LineNo].Qty)})
+	}
+	return orig, out, nil
+}
+
+// Refund returns lines of an earlier sale, recording a refund against the
+// original receipt. Each line gives back its share of the tax and total
+// actually charged; the last unit of a line takes whatever is left so
+// repeated partial refunds never exceed the sale. Loyalty points the sale
+// earned are taken back, and points it was paid with given back, in
+// proportion.
+func (s *Service) Refund(terminal string, req RefundRequest) (*Sale, error) {
+	// serialise refunds so two tills can't both return the last unit
+	s.refundMu.Lock()
+	defer s.refundMu.Unlock()
+	session, err := s.tillSession(terminal)
+	if err != nil {
+		return nil, err
+	}
+	orig, prior, done, err := s.refundState(strings.TrimSpace(req.ReceiptNo))
+	if err != nil {
+		return nil, err
+	}
+	want := req.Lines
+	if len(want) == 0 {
+		for _, l := range orig.Lines {
+			if rem := RoundQty(l.Qty - done[l.LineNo].Qty); rem > 0 {
+				want = append(want, RefundLine{LineNo: l.LineNo, Qty: rem})
+			}
+		}
+	}
+
+	refund := &Sale{
+		Kind:       KindRefund,
+		RefundOf:   orig.ReceiptNo,
+		Reason:     strings.TrimSpace(req.Reason),
+		Terminal:   terminal,
+		CreatedAt:  s.now(),
+		SessionID:  session,
+		CustomerID: orig.CustomerID,
+	}
+	seen := map[int]bool{}
+	for _, rl := range want {
+		rl.Qty = RoundQty(rl.Qty)
+		if rl.Qty <= 0 {
+			continue
+		}
+		if seen[rl.LineNo] {
+			return nil, ErrRefundExceedsSale
+		}
+		seen[rl.LineNo] = true
+		ol, ok := orig.line(rl.LineNo)
+		if !ok {
+			return nil, ErrLineNotFound
+		}
+		prev := done[rl.LineNo]
+		rem := RoundQty(ol.Qty - prev.Qty)
+		if rl.Qty > rem {
+			return nil, ErrRefundExceedsSale
+		}
+		// round down so partial refunds never run ahead of the last one
+		share := func(v int64) int64 { return int64(math.Floor(float64(v)*rl.Qty/ol.Qty + 1e-9)) }
+		tax, total, disc := share(ol.TaxCents), share(ol.TotalCents), share(ol.DiscountCents)
+		if rl.Qty == rem {
+			tax, total, disc = ol.TaxCents-prev.TaxCents, ol.TotalCents-prev.TotalCents, ol.DiscountCents-prev.DiscountCents
+		}
+		line := ol
+		line.LineNo = len(refund.Lines) + 1
+		line.Qty = -rl.Qty
+		line.TaxCents, line.TotalCents, line.DiscountCents = -tax, -total, -disc
+		line.RefundOfLine = ol.LineNo
+		line.Restock = rl.Restock
+		refund.Lines = append(refund.Lines, line)
+		refund.Subtotal += line.Amount()
+		refund.Discount += line.DiscountCents
+		refund.Tax += line.TaxCents
+		refund.Total += line.TotalCents
+	}
+	if len(refund.Lines) == 0 {
+		return nil, ErrNothingToRefund
+	}
+	refund.TaxBreakdown = Breakdown(refund.Lines)
+	// service charge goes back with the lines; tips stay with the operator
+	refund.ServiceCharge = refundServiceCharge(orig, prior, refund)
+	refund.Payments = refundPayments(orig, prior, -(refund.Total + refund.ServiceCharge), req.StoreCredit)
+	refund.Payments, refund.Rounding = roundCashRefund(refund.Payments, s.cashRounding())
+	refund.PointsEarned, refund.PointsRedeemed = refundPoints(orig, prior, refund)
+	if err := s.checkGiftCardRefund(refund); err != nil {
+		return nil, err
+	}
+	s.markPending(refund)
+	if err := s.cfg.Journal.Record(refund); err != nil {
+		return nil, err
+	}
+	return refund, s.postLedgers(refund)
+}
+
+// refundState loads the original sale, its earlier refunds and what they
+// returned keyed by original line number (quantities and amounts as positives).
+func (s *Service) refundState(receiptNo string) (*Sale, []Sale, map[int]BasketLine, error) {
+	if s.cfg.Journal == nil {
+		return nil, nil, nil, ErrNoJournal
+	}
+	orig, err := s.cfg.Journal.Get(receiptNo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if orig.Kind != KindSale {
+		return nil, nil, nil, ErrNotRefundable
+	}
+	if orig.Total != 0 && lineTotals(orig.Lines) == 0 {
+		// journalled before per-line amounts were kept; share out the header
+		weights := make([]int64, len(orig.Lines))
+		for i, l := range orig.Lines {
+			weights[i] = l.Net()
+		}
+		tax, total := allocate(orig.Tax, weights), allocate(orig.Total, weights)
+		for i := range orig.Lines {
+			orig.Lines[i].TaxCents, orig.Lines[i].TotalCents = tax[i], total[i]
+		}
+	}
+	prior, err := s.cfg.Journal.Refunds(receiptNo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	done := map[int]BasketLine{}
+	for _, r := range prior {
+		for _, l := range r.Lines {
+			d := done[l.RefundOfLine]
+			d.Qty = RoundQty(d.Qty - l.Qty)
+			d.TaxCents -= l.TaxCents
+			d.TotalCents -= l.TotalCents
+			d.DiscountCents -= l.DiscountCents
+			done[l.RefundOfLine] = d
+		}
+	}
+	return orig, prior, done, nil
+}
+
+// refundPayments pays amount back against the original tenders in the
+// order they were taken, less what earlier refunds paid back, or entirely
+// as store credit. Gift card tenders go back onto the same card.
+func refundPayments(orig *Sale, prior []Sale, amount int64, storeCredit bool) []Payment {
+	if storeCredit {
+		return []Payment{{Method: MethodStoreCredit, AmountCents: -amount}}
+	}
+	// cash taken is net of the change handed back and of any cash rounding,
+	// so the refund pays back the exact amount before it is rounded again
+	taken := make([]Payment, len(orig.Payments))
+	copy(taken, orig.Payments)
+	change := orig.Change
+	for i := len(taken) - 1; i >= 0 && change > 0; i-- {
+		if taken[i].Method == MethodCash {
+			d := min(change, taken[i].AmountCents)
+			taken[i].AmountCents -= d
+			change -= d
+		}
+	}
+	for i := len(taken) - 1; i >= 0 && orig.Rounding != 0; i-- {
+		if taken[i].Method == MethodCash {
+			taken[i].AmountCents -= orig.Rounding
+			break
+		}
+	}
+	for _, r := range prior {
+		for _, p := range r.Payments {
+			back := -p.AmountCents
+			for i := range taken {
+				if back == 0 {
+					break
+				}
+				if taken[i].Method == p.Method && taken[i].Ref == p.Ref {
+					d := min(back, taken[i].AmountCents)
+					taken[i].AmountCents -= d
+					back -= d
+				}
+			}
+		}
+	}
+	var out []Payment
+	for _, t := range taken {
+		if amount == 0 {
+			break
+		}
+		if d := min(amount, t.AmountCents); d > 0 {
+			out = append(out, Payment{Method: t.Method, AmountCents: -d, Ref: t.Ref})
+			amount -= d
+		}
+	}
+	if amount > 0 {
+		// nothing left on the original tenders (e.g. after store credit refunds)
+		out = append(out, Payment{Method: MethodStoreCredit, AmountCents: -amount})
+	}
+	return out
+}
+
+func (s *Sale) line(lineNo int) (BasketLine, bool) {
+	for _, l := range s.Lines {
+		if l.LineNo == lineNo {
+			return l, true
+		}
+	}
+	return BasketLine{}, false
+}
+
+func lineTotals(lines []BasketLine) int64 {
+	var n int64
+	for _, l := range lines {
+		n += l.TotalCents
+	}
+	return n
+}
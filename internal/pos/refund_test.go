@@ -0,0 +1,56 @@
+package pos
+
+import (
+	"testing"
+)
+
+func TestRefundHonoursOriginalTaxAndNeverExceedsSale(t *testing.T) {
+	s := NewService(Config{Journal: newFixture(t).journal})
+	s.SetTaxEngine(PercentTaxEngine{RatePercent: 20})
+	_, _ = s.ScanQty("T1", "A", 3) // 750 net
+	_, _ = s.Scan("T1", "B")       // 200 net; total 1140
+	_, _ = s.Tender("T1", 500, MethodCard)
+	sale, err := s.Tender("T1", 1000, MethodCash) // 360 change
+	if err != nil || sale == nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	// tax rate changes after the sale; the refund must still use what was charged
+	s.SetTaxEngine(PercentTaxEngine{RatePercent: 5})
+
+	r1, err := s.Refund("T2", RefundRequest{ReceiptNo: sale.ReceiptNo, Lines: []RefundLine{{LineNo: 1, Qty: 2, Restock: true}}})
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if r1.Kind != KindRefund || r1.RefundOf != sale.ReceiptNo || r1.Total != -600 || r1.Tax != -100 {
+		t.Fatalf("refund = %+v", r1)
+	}
+	// tenders are paid back in the order taken: the card first, then cash
+	want := []Payment{{Method: MethodCard, AmountCents: -500}, {Method: MethodCash, AmountCents: -100}}
+	if len(r1.Payments) != 2 || r1.Payments[0] != want[0] || r1.Payments[1] != want[1] {
+		t.Fatalf("refund payments = %+v; want %+v", r1.Payments, want)
+	}
+	if !r1.Lines[0].Restock || r1.Lines[0].Qty != -2 {
+		t.Fatalf("refund line = %+v", r1.Lines[0])
+	}
+
+	if _, err := s.Refund("T2", RefundRequest{ReceiptNo: sale.ReceiptNo, Lines: []RefundLine{{LineNo: 1, Qty: 2}}}); err != ErrRefundExceedsSale {
+		t.Fatalf("over-refund: err = %v; want ErrRefundExceedsSale", err)
+	}
+	// refunding the rest gives back exactly what is left
+	r2, err := s.Refund("T2", RefundRequest{ReceiptNo: sale.ReceiptNo, StoreCredit: true})
+	if err != nil {
+		t.Fatalf("Refund rest: %v", err)
+	}
+	if r1.Total+r2.Total != -sale.Total || r1.Tax+r2.Tax != -sale.Tax {
+		t.Fatalf("refunds %d/%d don't add up to sale %d/%d", r1.Total+r2.Total, r1.Tax+r2.Tax, sale.Total, sale.Tax)
+	}
+	if r2.Payments[0].Method != MethodStoreCredit {
+		t.Fatalf("payments = %+v; want store credit", r2.Payments)
+	}
+	if _, err := s.Refund("T2", RefundRequest{ReceiptNo: sale.ReceiptNo}); err != ErrNothingToRefund {
+		t.Fatalf("err = %v; want ErrNothingToRefund", err)
+	}
+	if _, err := s.Refund("T2", RefundRequest{ReceiptNo: r1.ReceiptNo}); err != ErrNotRefundable {
+		t.Fatalf("refund of refund: err = %v; want ErrNotRefundable", err)
+	}
+}
@@ -0,0 +1,56 @@
+package pos
+
+import "errors"
+
+var ErrCashRounding = errors.New("cash rounding must be zero or a positive number of cents")
+
+// SetCashRounding sets the step, in minor units, that cash balances are
+// rounded to (e.g. 5 for Swiss francs); 0 or 1 pays cash to the cent.
+// Other tenders always pay the exact amount.
+func (s *Service) SetCashRounding(step int64) error {
+	if step < 0 {
+		return ErrCashRounding
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rounding = step
+	return nil
+}
+
+func (s *Service) cashRounding() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rounding
+}
+
+// RoundCash rounds amount to the nearest multiple of step, halves away
+// from zero.
+func RoundCash(amount, step int64) int64 {
+	if step <= 1 {
+		return amount
+	}
+	if amount < 0 {
+		return -RoundCash(-amount, step)
+	}
+	return (amount + step/2) / step * step
+}
+
+// roundCashRefund rounds the cash paid back by a refund to step, taking
+// the difference off the last cash payment, and returns the payments with
+// the adjustment.
+func roundCashRefund(payments []Payment, step int64) ([]Payment, int64) {
+	last, cash := -1, int64(0)
+	for i, p := range payments {
+		if p.Method == MethodCash {
+			last, cash = i, cash+p.AmountCents
+		}
+	}
+	if last < 0 {
+		return payments, 0
+	}
+	adj := RoundCash(cash, step) - cash
+	if payments[last].AmountCents += adj; payments[last].AmountCents == 0 {
+		payments = append(payments[:last], payments[last+1:]...)
+	}
+	return payments, adj
+}
@@ -0,0 +1,49 @@
+package pos
+
+import (
+	"testing"
+)
+
+func TestCashRounding(t *testing.T) {
+	items := mapResolver{"A": {SKU: "A", Name: "A", Qty: 1, PriceCents: 1002}}
+	s := NewServiceWithResolver(Config{Journal: newFixture(t).journal, Tax: PercentTaxEngine{}}, items)
+	if err := s.SetCashRounding(5); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := s.Scan("T1", "A")
+	if b.Due != 1002 || b.CashDue != 1000 {
+		t.Fatalf("due = %d, cash due = %d", b.Due, b.CashDue)
+	}
+	cash, err := s.Tender("T1", 2000, MethodCash)
+	if err != nil || cash == nil || cash.Total != 1002 || cash.Rounding != -2 || cash.Change != 1000 {
+		t.Fatalf("cash sale = %+v, %v", cash, err)
+	}
+
+	// cards pay to the cent; cash finishing off a card payment is rounded
+	_, _ = s.Scan("T2", "A")
+	if card, _ := s.Tender("T2", 0, MethodCard); card == nil || card.Rounding != 0 {
+		t.Fatalf("card sale = %+v", card)
+	}
+	_, _ = s.Scan("T3", "A")
+	_, _ = s.Tender("T3", 3, MethodCard)
+	mixed, err := s.Tender("T3", 0, MethodCash)
+	if err != nil || mixed == nil || mixed.Rounding != 1 || mixed.Change != 0 || mixed.Payments[1].AmountCents != 1000 {
+		t.Fatalf("mixed sale = %+v, %v", mixed, err)
+	}
+
+	// the refund pays back rounded cash against the exact total
+	r, err := s.Refund("T1", RefundRequest{ReceiptNo: cash.ReceiptNo})
+	if err != nil || r.Total != -1002 || r.Rounding != 2 || len(r.Payments) != 1 || r.Payments[0].AmountCents != -1000 {
+		t.Fatalf("refund = %+v, %v", r, err)
+	}
+
+	rep := BuildSessionReport(ReportX, Session{}, []Sale{*cash, *mixed}, nil)
+	var tenders int64
+	for _, t := range rep.Tenders {
+		tenders += t.Sales
+	}
+	if rep.Rounding != -1 || tenders != rep.Net+rep.Rounding {
+		t.Fatalf("report rounding = %d, net = %d, tenders = %d", rep.Rounding, rep.Net, tenders)
+	}
+}
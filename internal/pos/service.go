@@ -1,20 +1,84 @@
 package pos
 
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+var ErrEmptyBasket = errors.New("basket is empty")
+
 type PriceResolver interface {
 	Resolve(code string) (BasketLine, bool)
 }
 
+// Service runs the till. Every basket operation takes the terminal (or
+// session) ID that owns the basket; receipts are numbered per terminal.
 type Service struct {
 	cfg      Config
-	basket   Basket
+	baskets  *Baskets
 	resolver PriceResolver
-	tax      TaxEngine
+	now      func() time.Time
+
+	mu          sync.RWMutex // guards tax, barcodes, loyalty, hospitality, rounding and currency
+	tax         TaxEngine
+	barcodes    []common.BarcodeRule
+	loyalty     common.LoyaltyRules
+	hospitality common.HospitalityRules
+	rounding    int64  // cash rounding step in minor units
+	currency    string // base currency; see SetBaseCurrency
+
+	refundMu sync.Mutex
 }
 
-type Config struct{ TaxInclusive bool }
+type Config struct {
+	TaxInclusive bool
+	MaxBaskets   int     // open baskets across all terminals; 0 means DefaultMaxBaskets
+	Journal      Journal // completed sales are written here; nil keeps them in memory only
+	// Tax prices the basket; nil charges DefaultTaxRates.
+	Tax TaxEngine
+	// Promotions are applied whenever a basket changes; nil means none.
+	Promotions Promotions
+	// Vouchers are looked up when a scanned code isn't a product.
+	Vouchers Vouchers
+	// Parking keeps parked baskets; nil disables Park and Recall.
+	Parking ParkStore
+	ParkTTL time.Duration // how long a parked basket is kept; 0 means DefaultParkTTL
+	// Sessions keeps till sessions; when set, tendering needs an open till.
+	Sessions Sessions
+	// Audit records cashier decisions such as age checks; nil drops them.
+	Audit AuditLog
+	// Customers are looked up to attach to baskets, also when a scanned
+	// code is a customer card.
+	Customers Customers
+	// Loyalty keeps customers' points; see SetLoyaltyRules for earning
+	// and spending them.
+	Loyalty LoyaltyLedger
+	// GiftCards keeps gift cards; nil disables selling and redeeming them.
+	GiftCards      GiftCards
+	GiftCardMonths int // how long a card stays valid after its last load; 0 never expires
+	// Rates converts foreign cash tenders; nil takes the base currency only.
+	Rates ExchangeRates
+	// Tables keeps the floor plan and the tabs open on it; nil disables
+	// table service.
+	Tables TableStore
+}
 
 func NewServiceWithResolver(cfg Config, r PriceResolver) *Service {
-	return &Service{cfg: cfg, resolver: r, tax: PercentTaxEngine{RatePercent: 20, Inclusive: cfg.TaxInclusive}}
+	tax := cfg.Tax
+	if tax == nil {
+		tax = ClassTaxEngine{Rates: DefaultTaxRates(), Inclusive: cfg.TaxInclusive}
+	}
+	s := &Service{cfg: cfg, baskets: NewBaskets(cfg.MaxBaskets), resolver: r, tax: tax, now: time.Now}
+	if cfg.Tables != nil {
+		s.baskets.back = tabBacking{s}
+	}
+	return s
 }
 
 // Backward compat for tests/demos
@@ -24,68 +88,302 @@ func NewService(cfg Config) *Service {
 		"B": {SKU: "B", Name: "Tea", Qty: 1, PriceCents: 200},
 		"C": {SKU: "C", Name: "Cake", Qty: 1, PriceCents: 350},
 	}
-	return &Service{cfg: cfg, resolver: mapResolver(price)}
+	return &Service{cfg: cfg, baskets: NewBaskets(cfg.MaxBaskets), resolver: mapResolver(price), tax: cfg.Tax, now: time.Now}
 }
 
 type BasketLine struct {
-	SKU        string `json:"sku"`
-	Name       string `json:"name"`
-	Qty        int    `json:"qty"`
+	LineNo  int     `json:"lineNo"` // stable within the basket; used by line edits
+	SKU     string  `json:"sku"`
+	Name    string  `json:"name"`
+	Qty     float64 `json:"qty"`               // whole units, or kg when Unit is set
+	Unit    string  `json:"unit,omitempty"`    // "kg" for weighed lines
+	Barcode string  `json:"barcode,omitempty"` // variable-measure label the line came from
+	// read from GS1 barcodes; lines only merge with the same batch and expiry
+	Batch      string `json:"batch,omitempty"`
+	Expiry     string `json:"expiry,omitempty"` // YYYY-MM-DD
 	PriceCents int64  `json:"priceCents"`
 	ImageURL   string `json:"imageUrl,omitempty"`
+	TaxClass   string `json:"taxClass,omitempty"`  // empty is TaxStandard
+	Category   string `json:"category,omitempty"`  // matched by promotions
+	MinAge     int    `json:"minAge,omitempty"`    // age check needed to sell it
+	GiftCard   string `json:"giftCard,omitempty"`  // card number the line issues or tops up
+	OpenPrice  bool   `json:"openPrice,omitempty"` // priced at the till, e.g. a department key
+	// Options are the item's option groups and Modifiers the choices made
+	// from them, already in PriceCents
+	Options   []OptionGroup `json:"options,omitempty"`
+	Modifiers []Modifier    `json:"modifiers,omitempty"`
+	Note      string        `json:"note,omitempty"`
+	// set when the cashier overrides the resolved price
+	OriginalPriceCents int64  `json:"originalPriceCents,omitempty"`
+	OverrideReason     string `json:"overrideReason,omitempty"`
+	// promotion discounts taken off the line, see Basket.Discounts
+	DiscountCents int64 `json:"discountCents,omitempty"`
+	// the tax charged on the line, kept so receipts and refunds honour it
+	TaxRateBP  int   `json:"taxRateBp"`
+	TaxCents   int64 `json:"taxCents"`
+	TotalCents int64 `json:"totalCents"`
+	// refund lines only
+	RefundOfLine int  `json:"refundOfLine,omitempty"`
+	Restock      bool `json:"restock,omitempty"`
+	// Seat is the diner the line is for, used to split the bill by seat;
+	// Share is how many ways a split shared the line, its cents divided
+	Seat  int `json:"seat,omitempty"`
+	Share int `json:"share,omitempty"`
 }
 
+// Amount is the line's quantity times unit price, before tax.
+func (l BasketLine) Amount() int64 { return int64(math.Round(l.Qty * float64(l.PriceCents))) }
+
+// Net is the line amount after promotion discounts, before tax.
+func (l BasketLine) Net() int64 { return l.Amount() - l.DiscountCents }
+
+// Overridden reports whether the line price was changed by hand.
+func (l BasketLine) Overridden() bool { return l.OverrideReason != "" }
+
 type Basket struct {
 	Lines    []BasketLine `json:"lines"`
-	Subtotal int64        `json:"subtotal"`
-	Tax      int64        `json:"tax"`
-	Total    int64        `json:"total"`
+	Subtotal int64        `json:"subtotal"` // before discounts
+	// Discounts are the promotions applied, each shown as its own line
+	Discounts []Discount `json:"discounts,omitempty"`
+	Discount  int64      `json:"discount"`
+	Vouchers  []Voucher  `json:"vouchers,omitempty"` // redeemed when tendering starts
+	Tax       int64      `json:"tax"`
+	Total     int64      `json:"total"`
+	// ServiceCharge is ServiceChargeBP (basis points) of the lines' total,
+	// outside the scope of tax; Tip is what card payments added as tips.
+	// Neither is part of Total.
+	ServiceChargeBP int    `json:"serviceChargeBP,omitempty"`
+	ServiceCharge   int64  `json:"serviceCharge,omitempty"`
+	Tip             int64  `json:"tip,omitempty"`
+	Operator        string `json:"operator,omitempty"` // who is serving; tips are theirs
+	// Table is the table the basket is a tab for, Covers the guests
+	// seated at it and OpenedAt when they sat down
+	Table    string    `json:"table,omitempty"`
+	Covers   int       `json:"covers,omitempty"`
+	OpenedAt time.Time `json:"openedAt,omitempty"`
+	// Rounding is the cash rounding adjustment taken when cash settled
+	// the basket; the basket is paid at Total plus ServiceCharge, Tip and
+	// Rounding
+	Rounding int64 `json:"rounding,omitempty"`
+	// TaxBreakdown sums the lines by tax rate for receipts
+	TaxBreakdown []TaxBand `json:"taxBreakdown,omitempty"`
+	Payments     []Payment `json:"payments,omitempty"`
+	Paid         int64     `json:"paid"`
+	Due          int64     `json:"due"`               // outstanding balance
+	CashDue      int64     `json:"cashDue,omitempty"` // Due rounded for cash
+	// AgeCheck is an item waiting on the cashier's age decision
+	AgeCheck *AgeCheck `json:"ageCheck,omitempty"`
+	// AgeVerified is the age confirmed for this customer; items needing
+	// no more than it aren't checked again
+	AgeVerified int `json:"ageVerified,omitempty"`
+	// Customer is who the sale is for; their prices and tax status apply
+	Customer *Customer `json:"customer,omitempty"`
+	// Loyalty is the customer's points standing, nil when loyalty is off
+	Loyalty        *LoyaltyStatus `json:"loyalty,omitempty"`
+	PointsRedeemed int64          `json:"pointsRedeemed,omitempty"` // points taken by payments so far
+	// Split is set while the bill is split: the lines stay here for the
+	// record and the parts are tendered one by one
+	Split *Split `json:"split,omitempty"`
+	// Part numbers a split part from 1 and SplitRef names its bill; a
+	// part's prices were fixed when it was split
+	Part     int    `json:"part,omitempty"`
+	SplitRef string `json:"splitRef,omitempty"`
 }
 
-func (s *Service) Scan(code string) (*Basket, error) {
-	return s.ScanQty(code, 1)
+// SetTaxEngine swaps the engine used for subsequent basket changes and
+// reprices open baskets so their totals match what will be charged.
+func (s *Service) SetTaxEngine(e TaxEngine) {
+	s.mu.Lock()
+	s.tax = e
+	s.mu.Unlock()
+	s.Reprice()
 }
 
-func (s *Service) ScanQty(code string, qty int) (*Basket, error) {
+// Reprice recalculates open baskets after tax or promotion changes.
+// Baskets part way through tendering or split keep their price.
+func (s *Service) Reprice() {
+	s.baskets.Each(func(b *Basket) {
+		if b.locked() == nil {
+			s.recalc(b)
+		}
+	})
+}
+
+// Basket returns a snapshot of the terminal's basket.
+func (s *Service) Basket(terminal string) *Basket {
+	b := s.baskets.Get(terminal)
+	return &b
+}
+
+func (s *Service) Scan(terminal, code string) (*Basket, error) {
+	return s.ScanQty(terminal, code, 1)
+}
+
+// ScanQty adds qty of the item with code. Variable-measure labels bring
+// their own weight or price and are always added as a new line.
+// Age-restricted items the customer hasn't been checked for are held in
+// Basket.AgeCheck until ConfirmAge. Codes that are neither an item, a
+// voucher nor a customer card give ErrItemNotFound; open-price items give
+// ErrPriceNeeded and are sold with KeyPrice, and items with required
+// options give ErrOptionsNeeded and are sold with ScanWithModifiers.
+func (s *Service) ScanQty(terminal, code string, qty float64) (*Basket, error) {
 	if qty <= 0 {
 		qty = 1
 	}
-	item, ok := s.resolver.Resolve(code)
+	code = strings.TrimSpace(code)
+	item, ok, err := s.resolve(code)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
-		return &s.basket, nil
-	}
-	// increment if exists
-	found := false
-	for i := range s.basket.Lines {
-		if s.basket.Lines[i].SKU == item.SKU {
-			s.basket.Lines[i].Qty += qty
-			found = true
-			break
+		if s.cfg.Vouchers != nil {
+			v, err := s.cfg.Vouchers.Lookup(NormalizeVoucherCode(code))
+			if err == nil {
+				return s.addVoucher(terminal, v)
+			}
+			if !errors.Is(err, ErrVoucherNotFound) {
+				return nil, err
+			}
 		}
+		c, err := s.lookupCard(code)
+		if err == nil {
+			return s.attachCustomer(terminal, c)
+		}
+		if !errors.Is(err, ErrCustomerNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, code)
 	}
-	if !found {
-		item.Qty = qty
-		s.basket.Lines = append(s.basket.Lines, item)
+	if item.OpenPrice {
+		return nil, ErrPriceNeeded
 	}
-	// totals
-	var sub int64
-	for _, l := range s.basket.Lines {
-		sub += int64(l.Qty) * l.PriceCents
+	if needsOptions(item.Options) {
+		return nil, ErrOptionsNeeded
 	}
-	s.basket.Subtotal = sub
-	tax, total := int64(0), sub
-	if s.tax != nil {
-		tax, total = s.tax.Compute(sub)
+	return s.addItem(terminal, item, qty)
+}
+
+// addItem puts a resolved item in the basket, or holds it for an age check.
+func (s *Service) addItem(terminal string, item BasketLine, qty float64) (*Basket, error) {
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		if b.AgeCheck != nil {
+			return ErrAgePending
+		}
+		item.PriceCents += modifierCents(item.Modifiers)
+		b.Customer.price(&item)
+		if item.MinAge > b.AgeVerified {
+			// held until the cashier confirms the customer's age
+			b.AgeCheck = &AgeCheck{Item: item, Qty: qty, MinAge: item.MinAge}
+		} else {
+			b.add(item, qty)
+			s.recalc(b)
+		}
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// add puts qty of item in the basket, adding to a matching line where
+// there is one (hand-priced and label lines keep their own quantity, and
+// lines only match with the same modifiers).
+func (b *Basket) add(item BasketLine, qty float64) {
+	for i := range b.Lines {
+		if l := b.Lines[i]; item.Barcode == "" && l.SKU == item.SKU && !l.Overridden() && l.Barcode == "" && l.GiftCard == "" && !l.OpenPrice &&
+			l.Batch == item.Batch && l.Expiry == item.Expiry && l.Seat == item.Seat &&
+			sameModifiers(l.Modifiers, item.Modifiers) {
+			b.Lines[i].Qty = RoundQty(b.Lines[i].Qty + qty)
+			return
+		}
+	}
+	if item.Barcode == "" {
+		item.Qty = RoundQty(qty)
+	}
+	item.LineNo = b.nextLineNo()
+	b.Lines = append(b.Lines, item)
+}
+
+// recalc refreshes the basket totals from its lines; split parts only
+// refresh what has been paid.
+func (s *Service) recalc(b *Basket) {
+	if b.Part == 0 {
+		s.price(b)
+	}
+	b.Paid = 0
+	for _, p := range b.Payments {
+		b.Paid += p.AmountCents
+	}
+	b.Due = max(b.payable()-b.Paid, 0)
+	b.CashDue = RoundCash(b.Due, s.cashRounding())
+}
+
+// price prices the lines and totals them.
+func (s *Service) price(b *Basket) {
+	s.mu.RLock()
+	engine := s.tax
+	s.mu.RUnlock()
+	// discounts come off before tax; the price is fixed once tendering starts
+	if len(b.Payments) == 0 {
+		var promos []Promotion
+		if s.cfg.Promotions != nil {
+			promos = s.cfg.Promotions.Active(s.now())
+		}
+		for _, v := range b.Vouchers {
+			promos = append(promos, v.promotion())
+		}
+		b.Discounts = ApplyPromotions(b.Lines, promos)
+	}
+	var taxes []LineTax
+	if engine != nil {
+		taxes = computeTax(engine, b.Lines)
+	}
+	b.Subtotal, b.Discount, b.Tax, b.Total = 0, 0, 0, 0
+	exempt := b.Customer != nil && b.Customer.TaxExempt
+	for i := range b.Lines {
+		l := &b.Lines[i]
+		l.TaxRateBP, l.TaxCents, l.TotalCents = 0, 0, l.Net()
+		if taxes != nil {
+			l.TaxRateBP, l.TaxCents, l.TotalCents = taxes[i].RateBP, taxes[i].TaxCents, taxes[i].TotalCents
+		}
+		if exempt {
+			// exempt customers pay the price without its tax, inclusive or not
+			l.TaxRateBP, l.TaxCents, l.TotalCents = 0, 0, l.TotalCents-l.TaxCents
+		}
+		b.Subtotal += l.Amount()
+		b.Discount += l.DiscountCents
+		b.Tax += l.TaxCents
+		b.Total += l.TotalCents
+	}
+	b.TaxBreakdown = Breakdown(b.Lines)
+	b.ServiceCharge = serviceCharge(b.Lines, b.ServiceChargeBP)
+}
+
+// Sales returns the journalled sales created in [from, to).
+func (s *Service) Sales(from, to time.Time) ([]Sale, error) {
+	if s.cfg.Journal == nil {
+		return nil, nil
 	}
-	s.basket.Tax = tax
-	s.basket.Total = total
-	return &s.basket, nil
+	return s.cfg.Journal.List(from, to)
 }
 
-func (s *Service) Tender(amount int64, method string) (map[string]any, error) {
-	// reset basket for demo
-	s.basket = Basket{}
-	return map[string]any{"status": "ok", "method": method, "amount": amount}, nil
+// TaxReport sums sales and refunds in [from, to) by tax rate.
+func (s *Service) TaxReport(from, to time.Time) ([]TaxBand, error) {
+	sales, err := s.Sales(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var lines []BasketLine
+	for _, sale := range sales {
+		lines = append(lines, sale.Lines...)
+	}
+	return Breakdown(lines), nil
 }
 
 // simple in-memory resolver
@@ -0,0 +1,416 @@
+package pos
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cash movement kinds recorded against a till session.
+const (
+	CashPayIn  = "pay_in"
+	CashPayOut = "pay_out"
+	CashDrop   = "safe_drop"
+	CashNoSale = "no_sale"
+)
+
+// Report kinds: an X report reads the session, a Z report closes it.
+const (
+	ReportX = "X"
+	ReportZ = "Z"
+)
+
+var (
+	ErrTillOpen    = errors.New("till is already open")
+	ErrTillClosed  = errors.New("till is not open; open it with a float first")
+	ErrNoSessions  = errors.New("till sessions are not configured")
+	ErrCashAmount  = errors.New("amount must be more than zero")
+	ErrCashReason  = errors.New("a reason code is required")
+	ErrCashKind    = errors.New("unknown cash movement")
+	ErrSessionGone = errors.New("till session not found")
+)
+
+// DefaultCashReasons are offered when recording pay-ins, pay-outs and drops.
+var DefaultCashReasons = []string{"float_top_up", "petty_cash", "supplier", "wages", "banking", "change", "correction"}
+
+// Session is one opening of a till, from float to Z report.
+type Session struct {
+	ID         int64     `json:"id"`
+	Terminal   string    `json:"terminal"`
+	FloatCents int64     `json:"floatCents"`
+	OpenedAt   time.Time `json:"openedAt"`
+	ClosedAt   time.Time `json:"closedAt,omitempty"` // zero while open
+	// Counted is what was in the drawer at close, by tender method
+	Counted map[string]int64 `json:"counted,omitempty"`
+	// the cash count by note and coin, and what was expected, kept so
+	// managers can follow up on shortages
+	Denominations []DenominationCount `json:"denominations,omitempty"`
+	Expected      map[string]int64    `json:"expected,omitempty"`
+	VarianceCents int64               `json:"varianceCents"`
+}
+
+// DenominationCount is how many of one note or coin were counted.
+type DenominationCount struct {
+	ValueCents int64 `json:"valueCents"`
+	Qty        int64 `json:"qty"`
+}
+
+// Cents is the value of the notes or coins counted.
+func (d DenominationCount) Cents() int64 { return d.ValueCents * d.Qty }
+
+// CashTotal adds up a count by denomination.
+func CashTotal(count []DenominationCount) int64 {
+	var n int64
+	for _, d := range count {
+		n += d.Cents()
+	}
+	return n
+}
+
+func (s Session) Closed() bool { return !s.ClosedAt.IsZero() }
+
+// CashMovement is money put in or taken out of the drawer outside a sale,
+// or a no-sale drawer open (amount zero).
+type CashMovement struct {
+	ID          int64     `json:"id"`
+	SessionID   int64     `json:"sessionId"`
+	Kind        string    `json:"kind"`
+	AmountCents int64     `json:"amountCents"`
+	Reason      string    `json:"reason,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// Sessions keeps till sessions and their cash movements. A terminal has
+// at most one open session.
+type Sessions interface {
+	Open(s Session) (Session, error)
+	Current(terminal string) (Session, error) // ErrTillClosed when none is open
+	Get(id int64) (Session, error)
+	// List returns the sessions opened in [from, to), oldest first.
+	List(from, to time.Time) ([]Session, error)
+	// Close stores the session's counts and variance and marks it closed.
+	Close(s Session) error
+	AddMovement(m CashMovement) (CashMovement, error)
+	Movements(sessionID int64) ([]CashMovement, error)
+}
+
+// TenderTotal is one tender method's line on an X or Z report.
+// Foreign cash has its own line, keyed by TenderKey and totalled in
+// Currency; its variance is left out of the session's.
+type TenderTotal struct {
+	Method   string `json:"method"`
+	Currency string `json:"currency,omitempty"` // foreign cash only
+	Sales    int64  `json:"salesCents"`         // taken, less change given
+	Refunds  int64  `json:"refundsCents"`       // paid back, negative
+	Expected int64  `json:"expectedCents"`
+	Counted  int64  `json:"countedCents"`
+	Variance int64  `json:"varianceCents"` // counted less expected; Z reports only
+	// Uncounted tenders, such as gift cards and points, aren't in the
+	// drawer and are left out of the variance
+	Uncounted bool `json:"uncounted,omitempty"`
+}
+
+// SessionReport summarises a till session. Expected cash is the float plus
+// cash taken and paid in, less cash refunded, paid out and dropped.
+type SessionReport struct {
+	Kind    string    `json:"kind"`
+	Session Session   `json:"session"`
+	At      time.Time `json:"at"`
+	Sales   int       `json:"sales"`
+	Refunds int       `json:"refunds"`
+	Net     int64     `json:"netCents"` // sales less refunds, with tax
+	Tax     int64     `json:"taxCents"`
+	// service charges, tips and cash rounding are taken on top of Net
+	ServiceCharge int64            `json:"serviceChargeCents"`
+	Tips          int64            `json:"tipsCents"`
+	TipsBy        map[string]int64 `json:"tipsByOperator,omitempty"`
+	Rounding      int64            `json:"roundingCents"`
+	PayIns        int64            `json:"payInsCents"`
+	PayOuts       int64            `json:"payOutsCents"`
+	Drops         int64            `json:"dropsCents"`
+	NoSales       int              `json:"noSales"`
+	Movements     []CashMovement   `json:"movements"`
+	Tenders       []TenderTotal    `json:"tenders"`
+	Variance      int64            `json:"varianceCents"`
+}
+
+// tillSession returns the terminal's open session ID, or 0 when sessions
+// aren't configured.
+func (s *Service) tillSession(terminal string) (int64, error) {
+	if s.cfg.Sessions == nil {
+		return 0, nil
+	}
+	sess, err := s.cfg.Sessions.Current(terminal)
+	if err != nil {
+		return 0, err
+	}
+	return sess.ID, nil
+}
+
+// OpenTill starts a session on the terminal with a float in the drawer.
+func (s *Service) OpenTill(terminal string, floatCents int64) (*Session, error) {
+	if s.cfg.Sessions == nil {
+		return nil, ErrNoSessions
+	}
+	if floatCents < 0 {
+		return nil, ErrCashAmount
+	}
+	sess, err := s.cfg.Sessions.Open(Session{Terminal: terminal, FloatCents: floatCents, OpenedAt: s.now()})
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// CurrentSession returns the terminal's open session.
+func (s *Service) CurrentSession(terminal string) (*Session, error) {
+	if s.cfg.Sessions == nil {
+		return nil, ErrNoSessions
+	}
+	sess, err := s.cfg.Sessions.Current(terminal)
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *Service) PayIn(terminal string, amount int64, reason string) (*CashMovement, error) {
+	return s.MoveCash(terminal, CashPayIn, amount, reason)
+}
+
+func (s *Service) PayOut(terminal string, amount int64, reason string) (*CashMovement, error) {
+	return s.MoveCash(terminal, CashPayOut, amount, reason)
+}
+
+func (s *Service) SafeDrop(terminal string, amount int64, reason string) (*CashMovement, error) {
+	return s.MoveCash(terminal, CashDrop, amount, reason)
+}
+
+// NoSale records the drawer being opened without a sale.
+func (s *Service) NoSale(terminal, reason string) (*CashMovement, error) {
+	return s.MoveCash(terminal, CashNoSale, 0, reason)
+}
+
+// MoveCash records a pay-in, pay-out, safe drop or no-sale against the
+// terminal's open session. All but no-sales need an amount and a reason code.
+func (s *Service) MoveCash(terminal, kind string, amount int64, reason string) (*CashMovement, error) {
+	if s.cfg.Sessions == nil {
+		return nil, ErrNoSessions
+	}
+	reason = strings.ToLower(strings.TrimSpace(reason))
+	switch kind {
+	case CashPayIn, CashPayOut, CashDrop:
+		if amount <= 0 {
+			return nil, ErrCashAmount
+		}
+		if reason == "" {
+			return nil, ErrCashReason
+		}
+	case CashNoSale:
+		amount = 0
+	default:
+		return nil, ErrCashKind
+	}
+	sess, err := s.cfg.Sessions.Current(terminal)
+	if err != nil {
+		return nil, err
+	}
+	m, err := s.cfg.Sessions.AddMovement(CashMovement{SessionID: sess.ID, Kind: kind, AmountCents: amount, Reason: reason, At: s.now()})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// XReport reads the terminal's open session without closing it.
+func (s *Service) XReport(terminal string) (*SessionReport, error) {
+	sess, err := s.CurrentSession(terminal)
+	if err != nil {
+		return nil, err
+	}
+	return s.report(ReportX, *sess)
+}
+
+// CloseTill closes the terminal's session and returns its Z report. The
+// cash may be counted by denomination, which then stands for the cash
+// figure in counted; other tenders are counted by method. A basket part
+// way through tendering must be finished first.
+func (s *Service) CloseTill(terminal string, cash []DenominationCount, counted map[string]int64) (*SessionReport, error) {
+	sess, err := s.CurrentSession(terminal)
+	if err != nil {
+		return nil, err
+	}
+	if b := s.baskets.Get(terminal); b.locked() != nil {
+		return nil, b.locked()
+	}
+	sess.Counted = map[string]int64{}
+	for m, n := range counted {
+		if n < 0 {
+			return nil, ErrCashAmount
+		}
+		sess.Counted[m] = n
+	}
+	if cash != nil {
+		for _, d := range cash {
+			if d.ValueCents <= 0 || d.Qty < 0 {
+				return nil, ErrCashAmount
+			}
+		}
+		sess.Denominations = cash
+		sess.Counted[MethodCash] = CashTotal(cash)
+	}
+	sess.ClosedAt = s.now()
+	rep, err := s.report(ReportZ, *sess)
+	if err != nil {
+		return nil, err
+	}
+	sess.Expected = map[string]int64{}
+	for _, t := range rep.Tenders {
+		sess.Expected[t.Method] = t.Expected
+	}
+	sess.VarianceCents = rep.Variance
+	if err := s.cfg.Sessions.Close(*sess); err != nil {
+		return nil, err
+	}
+	rep.Session = *sess
+	return rep, nil
+}
+
+// TillSessions lists the sessions opened in [from, to) with their
+// variances.
+func (s *Service) TillSessions(from, to time.Time) ([]Session, error) {
+	if s.cfg.Sessions == nil {
+		return nil, ErrNoSessions
+	}
+	return s.cfg.Sessions.List(from, to)
+}
+
+// SessionReport rebuilds the report for a session: Z once it is closed.
+func (s *Service) SessionReport(id int64) (*SessionReport, error) {
+	if s.cfg.Sessions == nil {
+		return nil, ErrNoSessions
+	}
+	sess, err := s.cfg.Sessions.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	kind := ReportX
+	if sess.Closed() {
+		kind = ReportZ
+	}
+	return s.report(kind, sess)
+}
+
+func (s *Service) report(kind string, sess Session) (*SessionReport, error) {
+	var sales []Sale
+	if s.cfg.Journal != nil {
+		var err error
+		if sales, err = s.cfg.Journal.BySession(sess.ID); err != nil {
+			return nil, err
+		}
+	}
+	moves, err := s.cfg.Sessions.Movements(sess.ID)
+	if err != nil {
+		return nil, err
+	}
+	at := sess.ClosedAt
+	if at.IsZero() {
+		at = s.now()
+	}
+	r := BuildSessionReport(kind, sess, sales, moves)
+	r.At = at
+	return &r, nil
+}
+
+// BuildSessionReport totals a session's sales and cash movements. Counts
+// are compared with what was expected on Z reports only.
+func BuildSessionReport(kind string, sess Session, sales []Sale, moves []CashMovement) SessionReport {
+	r := SessionReport{Kind: kind, Session: sess, Movements: moves}
+	tenders := map[string]*TenderTotal{MethodCash: {Method: MethodCash}}
+	tender := func(method string) *TenderTotal {
+		t, ok := tenders[method]
+		if !ok {
+			t = &TenderTotal{Method: method}
+			if _, cur, ok := strings.Cut(method, ":"); ok {
+				t.Currency = cur
+			}
+			tenders[method] = t
+		}
+		return t
+	}
+	for _, sale := range sales {
+		if sale.Kind == KindRefund {
+			r.Refunds++
+		} else {
+			r.Sales++
+		}
+		r.Net += sale.Total
+		r.Tax += sale.Tax
+		r.Rounding += sale.Rounding
+		r.ServiceCharge += sale.ServiceCharge
+		if sale.Tip != 0 {
+			if r.TipsBy == nil {
+				r.TipsBy = map[string]int64{}
+			}
+			r.Tips += sale.Tip
+			r.TipsBy[sale.Operator] += sale.Tip
+		}
+		for _, p := range sale.Payments {
+			// foreign cash is totalled in its own currency, as it sits in the drawer
+			amount := p.AmountCents
+			if p.Currency != "" {
+				amount = p.ForeignCents
+			}
+			if amount < 0 {
+				tender(TenderKey(p)).Refunds += amount
+			} else {
+				tender(TenderKey(p)).Sales += amount
+			}
+		}
+		tender(MethodCash).Sales -= sale.Change
+	}
+	for _, m := range moves {
+		switch m.Kind {
+		case CashPayIn:
+			r.PayIns += m.AmountCents
+		case CashPayOut:
+			r.PayOuts += m.AmountCents
+		case CashDrop:
+			r.Drops += m.AmountCents
+		case CashNoSale:
+			r.NoSales++
+		}
+	}
+	for method := range sess.Counted {
+		tender(method)
+	}
+	for _, t := range tenders {
+		t.Expected = t.Sales + t.Refunds
+		if t.Method == MethodCash {
+			t.Expected += sess.FloatCents + r.PayIns - r.PayOuts - r.Drops
+		}
+		_, counted := sess.Counted[t.Method]
+		switch {
+		case kind != ReportZ:
+		case !counted && t.Method != MethodCash:
+			t.Uncounted = true
+		default:
+			t.Counted = sess.Counted[t.Method]
+			t.Variance = t.Counted - t.Expected
+			if t.Currency == "" {
+				r.Variance += t.Variance
+			}
+		}
+		r.Tenders = append(r.Tenders, *t)
+	}
+	// cash first, then by method
+	sort.Slice(r.Tenders, func(i, j int) bool {
+		a, b := r.Tenders[i].Method, r.Tenders[j].Method
+		if (a == MethodCash) != (b == MethodCash) {
+			return a == MethodCash
+		}
+		return a < b
+	})
+	return r
+}
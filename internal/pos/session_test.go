@@ -0,0 +1,70 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTillSession(t *testing.T) {
+	f := newFixture(t)
+	sessions := f.sessions
+	s := NewService(Config{Journal: f.journal, Sessions: sessions})
+
+	_, _ = s.ScanQty("T1", "A", 2)
+	if _, err := s.Tender("T1", 0, MethodCash); !errors.Is(err, ErrTillClosed) {
+		t.Fatalf("tender on a closed till err = %v", err)
+	}
+	if _, err := s.OpenTill("T1", 5000); err != nil {
+		t.Fatalf("OpenTill: %v", err)
+	}
+	if _, err := s.OpenTill("T1", 5000); !errors.Is(err, ErrTillOpen) {
+		t.Fatalf("second open err = %v", err)
+	}
+	cash, err := s.Tender("T1", 1000, MethodCash) // 500 change
+	if err != nil {
+		t.Fatalf("Tender: %v", err)
+	}
+	_, _ = s.Scan("T1", "B")
+	_, _ = s.Tender("T1", 0, MethodCard)
+	if _, err := s.Refund("T1", RefundRequest{ReceiptNo: cash.ReceiptNo}); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if _, err := s.PayOut("T1", 300, ""); !errors.Is(err, ErrCashReason) {
+		t.Fatalf("pay-out without reason err = %v", err)
+	}
+	_, _ = s.PayIn("T1", 1000, "change")
+	_, _ = s.PayOut("T1", 300, "supplier")
+	_, _ = s.SafeDrop("T1", 2000, "banking")
+	_, _ = s.NoSale("T1", "")
+
+	x, err := s.XReport("T1")
+	if err != nil || x.Tenders[0].Method != MethodCash || x.Tenders[0].Expected != 3700 || x.NoSales != 1 {
+		t.Fatalf("XReport = %+v, %v", x, err)
+	}
+	count := []DenominationCount{{2000, 1}, {1000, 1}, {500, 1}, {100, 1}, {50, 1}, {20, 0}}
+	z, err := s.CloseTill("T1", count, map[string]int64{MethodCard: 200})
+	if err != nil {
+		t.Fatalf("CloseTill: %v", err)
+	}
+	if z.Sales != 2 || z.Refunds != 1 || z.Tenders[0].Counted != 3650 || z.Tenders[1].Expected != 200 || z.Variance != -50 {
+		t.Fatalf("ZReport = %+v", z)
+	}
+	// the count and variance stay with the session for follow-up
+	list, err := s.TillSessions(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil || len(list) != 1 || list[0].VarianceCents != -50 || len(list[0].Denominations) != 6 || list[0].Expected[MethodCash] != 3700 {
+		t.Fatalf("TillSessions = %+v, %v", list, err)
+	}
+	_, _ = s.Scan("T1", "C")
+	if _, err := s.Tender("T1", 0, MethodCard); !errors.Is(err, ErrTillClosed) {
+		t.Fatalf("tender after close err = %v", err)
+	}
+
+	// tenders that aren't in the drawer aren't counted short
+	counted := Session{FloatCents: 1000, Counted: map[string]int64{MethodCash: 1500, MethodCard: 0}}
+	paid := []Sale{{Total: 1500, Payments: []Payment{{Method: MethodCash, AmountCents: 500}, {Method: MethodGiftCard, AmountCents: 1000}}}}
+	gz := BuildSessionReport(ReportZ, counted, paid, nil)
+	if gz.Variance != 0 || len(gz.Tenders) != 3 || !gz.Tenders[2].Uncounted || gz.Tenders[2].Variance != 0 {
+		t.Fatalf("Z with gift card = %+v", gz)
+	}
+}
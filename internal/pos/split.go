@@ -0,0 +1,331 @@
+package pos
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var (
+	ErrBillSplit    = errors.New("bill is split; pay its parts or undo the split")
+	ErrNotSplit     = errors.New("bill is not split")
+	ErrSplitParts   = errors.New("a bill splits into 2 to 20 parts")
+	ErrSplitSeats   = errors.New("put lines on two or more seats to split by seat")
+	ErrSplitEmpty   = errors.New("every part of a split needs something on it")
+	ErrPartNotFound = errors.New("split part not found")
+	ErrPartPaid     = errors.New("split part is already paid")
+	ErrSeat         = errors.New("seat must be zero or more")
+)
+
+const maxSplitParts = 20
+
+// Split is a bill split into parts that are tendered on their own. The
+// basket keeps its lines and totals, and the parts' sales carry Ref into
+// the journal so the bill can be put back together for reporting.
+type Split struct {
+	Ref   string      `json:"ref"`
+	Parts []SplitPart `json:"parts"`
+}
+
+// SplitPart is a part of a split bill and, once paid, its receipt.
+type SplitPart struct {
+	Basket    Basket `json:"basket"`
+	Settled   bool   `json:"settled,omitempty"`
+	ReceiptNo string `json:"receiptNo,omitempty"`
+}
+
+// open finds the part to tender: part n, or the first unpaid part for 0.
+func (sp *Split) open(n int) (int, error) {
+	if n == 0 {
+		for i, p := range sp.Parts {
+			if !p.Settled {
+				return i, nil
+			}
+		}
+	}
+	if n < 1 || n > len(sp.Parts) {
+		return 0, ErrPartNotFound
+	}
+	if sp.Parts[n-1].Settled {
+		return 0, ErrPartPaid
+	}
+	return n - 1, nil
+}
+
+func (sp *Split) settle(n int, receiptNo string) {
+	sp.Parts[n-1].Settled, sp.Parts[n-1].ReceiptNo = true, receiptNo
+}
+
+func (sp *Split) done() bool {
+	for _, p := range sp.Parts {
+		if !p.Settled {
+			return false
+		}
+	}
+	return true
+}
+
+// locked reports why the basket can't be changed: tendering has started
+// or the bill is split.
+func (b *Basket) locked() error {
+	if b.Split != nil {
+		return ErrBillSplit
+	}
+	if len(b.Payments) > 0 {
+		return ErrBasketLocked
+	}
+	return nil
+}
+
+// SplitEvenly splits the bill into n parts of equal value: every line is
+// shared between them, and the cents that don't divide go to the parts in
+// turn.
+func (s *Service) SplitEvenly(terminal string, n int) (*Basket, error) {
+	return s.split(terminal, func(*Basket) (int, func(BasketLine) int, error) {
+		return n, func(BasketLine) int { return -1 }, nil
+	})
+}
+
+// SplitBySeat gives each seat on the bill its own part, in seat order.
+// Lines without a seat are shared evenly (see SetLineSeat).
+func (s *Service) SplitBySeat(terminal string) (*Basket, error) {
+	return s.split(terminal, func(b *Basket) (int, func(BasketLine) int, error) {
+		part := map[int]int{}
+		var seats []int
+		for _, l := range b.Lines {
+			if _, ok := part[l.Seat]; !ok && l.Seat > 0 {
+				part[l.Seat] = 0
+				seats = append(seats, l.Seat)
+			}
+		}
+		if len(seats) < 2 {
+			return 0, nil, ErrSplitSeats
+		}
+		sort.Ints(seats)
+		for i, seat := range seats {
+			part[seat] = i
+		}
+		return len(seats), func(l BasketLine) int {
+			if l.Seat == 0 {
+				return -1
+			}
+			return part[l.Seat]
+		}, nil
+	})
+}
+
+// SplitByLines moves lines into parts: parts maps line numbers to the part
+// they go to, numbered from 1, and lines it doesn't name stay in part 1.
+func (s *Service) SplitByLines(terminal string, parts map[int]int) (*Basket, error) {
+	return s.split(terminal, func(b *Basket) (int, func(BasketLine) int, error) {
+		n := 1
+		for lineNo, p := range parts {
+			if b.lineIndex(lineNo) < 0 {
+				return 0, nil, ErrLineNotFound
+			}
+			if p < 1 || p > maxSplitParts {
+				return 0, nil, ErrSplitParts
+			}
+			n = max(n, p)
+		}
+		return n, func(l BasketLine) int { return max(parts[l.LineNo], 1) - 1 }, nil
+	})
+}
+
+// Unsplit puts a split bill back together; none of its parts may have been
+// paid.
+func (s *Service) Unsplit(terminal string) (*Basket, error) {
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if b.Split == nil {
+			return ErrNotSplit
+		}
+		for _, p := range b.Split.Parts {
+			if p.Settled || len(p.Basket.Payments) > 0 {
+				return ErrBasketLocked
+			}
+		}
+		b.Split = nil
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SplitSales returns the sales that paid the parts of a split bill.
+func (s *Service) SplitSales(ref string) ([]Sale, error) {
+	if s.cfg.Journal == nil {
+		return nil, nil
+	}
+	return s.cfg.Journal.BySplit(ref)
+}
+
+// split splits the basket with plan, which gives the number of parts and
+// each line's part, or -1 to share the line between them all.
+func (s *Service) split(terminal string, plan func(b *Basket) (int, func(BasketLine) int, error)) (*Basket, error) {
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if len(b.Lines) == 0 {
+			return ErrEmptyBasket
+		}
+		if b.AgeCheck != nil {
+			return ErrAgePending
+		}
+		if err := b.locked(); err != nil {
+			return err
+		}
+		n, owner, err := plan(b)
+		if err != nil {
+			return err
+		}
+		if n < 2 || n > maxSplitParts {
+			return ErrSplitParts
+		}
+		s.recalc(b)
+		ref := fmt.Sprintf("%s-%s", terminal, s.now().UTC().Format("20060102T150405.000"))
+		parts := splitParts(b, n, owner, ref)
+		for i := range parts {
+			if len(parts[i].Basket.Lines) == 0 {
+				return ErrSplitEmpty
+			}
+			s.recalc(&parts[i].Basket)
+		}
+		b.Split = &Split{Ref: ref, Parts: parts}
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// splitParts deals the priced basket's lines out to n parts. Shared lines
+// are divided evenly; the cents and thousandths of a unit left over go one
+// each to the parts in turn, carrying on from line to line so the same part doesn't always get
+// them. Gift cards aren't divided and go whole to part 1. The service
+// charge follows each part's share of the lines, and each promotion
+// discount each part's share of the lines it was taken from; a voucher
+// goes to the first part its discount reaches, which claims it.
+func splitParts(b *Basket, n int, owner func(BasketLine) int, ref string) []SplitPart {
+	even := make([]int64, n)
+	for i := range even {
+		even[i] = 1
+	}
+	covers := allocate(int64(b.Covers), even)
+	parts := make([]SplitPart, n)
+	for i := range parts {
+		p := &parts[i].Basket
+		p.Part, p.SplitRef = i+1, ref
+		p.Operator, p.Table, p.Covers = b.Operator, b.Table, int(covers[i])
+		p.AgeVerified, p.ServiceChargeBP = b.AgeVerified, b.ServiceChargeBP
+		if b.Customer != nil {
+			c := *b.Customer
+			p.Customer = &c
+		}
+		if b.Loyalty != nil {
+			l := *b.Loyalty
+			p.Loyalty = &l
+		}
+	}
+	// part -> line number -> discount taken off its share of the line
+	discounted := make([]map[int]int64, n)
+	put := func(i int, l BasketLine, amount int64) {
+		if discounted[i] == nil {
+			discounted[i] = map[int]int64{}
+		}
+		discounted[i][l.LineNo] += l.DiscountCents
+		p := &parts[i].Basket
+		p.Lines = append(p.Lines, l)
+		p.Subtotal += amount
+		p.Discount += l.DiscountCents
+		p.Tax += l.TaxCents
+		p.Total += l.TotalCents
+	}
+	next := 0
+	for _, l := range b.Lines {
+		i := owner(l)
+		if i >= 0 || l.GiftCard != "" {
+			put(max(i, 0), l, l.Amount())
+			continue
+		}
+		amount := shareOut(l.Amount(), n, next)
+		discount := shareOut(l.DiscountCents, n, next)
+		tax := shareOut(l.TaxCents, n, next)
+		total := shareOut(l.TotalCents, n, next)
+		// quantities are shared in thousandths so the parts add up
+		qty := shareOut(int64(math.Round(l.Qty*1000)), n, next)
+		for j := range parts {
+			sl := l
+			sl.Qty, sl.Share = float64(qty[j])/1000, n
+			sl.DiscountCents, sl.TaxCents, sl.TotalCents = discount[j], tax[j], total[j]
+			put(j, sl, amount[j])
+		}
+		r := l.TotalCents % int64(n)
+		next = (next + int(max(r, -r))) % n
+	}
+	weights := make([]int64, n)
+	for i := range parts {
+		p := &parts[i].Basket
+		p.TaxBreakdown = Breakdown(p.Lines)
+		weights[i] = max(chargeable(p.Lines), 0)
+	}
+	for i, c := range allocate(b.ServiceCharge, weights) {
+		parts[i].Basket.ServiceCharge = c
+	}
+	for _, d := range b.Discounts {
+		shares := make([]int64, n)
+		for i := range parts {
+			for _, lineNo := range d.Lines {
+				shares[i] += max(discounted[i][lineNo], 0)
+			}
+		}
+		for i, amount := range allocate(d.AmountCents, shares) {
+			if amount == 0 && shares[i] == 0 {
+				continue
+			}
+			pd := d
+			pd.AmountCents, pd.Lines = amount, nil
+			for _, lineNo := range d.Lines {
+				if _, ok := discounted[i][lineNo]; ok {
+					pd.Lines = append(pd.Lines, lineNo)
+				}
+			}
+			parts[i].Basket.Discounts = append(parts[i].Basket.Discounts, pd)
+		}
+	}
+	for _, v := range b.Vouchers {
+		i := 0
+		for j := range parts {
+			if hasDiscount(parts[j].Basket.Discounts, v.promotion().ID) {
+				i = j
+				break
+			}
+		}
+		parts[i].Basket.Vouchers = append(parts[i].Basket.Vouchers, v)
+	}
+	return parts
+}
+
+// shareOut divides amount into n shares no more than a cent apart, the
+// odd cents going to the shares from start on, wrapping round.
+func shareOut(amount int64, n, start int) []int64 {
+	out := make([]int64, n)
+	q, r := amount/int64(n), amount%int64(n)
+	step := int64(1)
+	if r < 0 {
+		step, r = -1, -r
+	}
+	for i := range out {
+		out[i] = q
+	}
+	for k := 0; k < int(r); k++ {
+		out[(start+k)%n] += step
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSplitBill(t *testing.T) {
+	items := mapResolver{
+		"A": {SKU: "A", Name: "A", Qty: 1, PriceCents: 1000},
+		"B": {SKU: "B", Name: "B", Qty: 1, PriceCents: 500},
+		"C": {SKU: "C", Name: "C", Qty: 1, PriceCents: 100},
+	}
+	j := newFixture(t).journal
+	s := NewServiceWithResolver(Config{Journal: j, Tax: PercentTaxEngine{RatePercent: 20}}, items)
+	if got := shareOut(100, 3, 1); got[0] != 33 || got[1] != 34 || got[2] != 33 {
+		t.Fatalf("shareOut = %v", got)
+	}
+
+	// an even split shares every line, the odd cents going round the parts
+	_, _ = s.Scan("T1", "C")
+	b, err := s.SplitEvenly("T1", 3)
+	if err != nil || b.Split == nil || len(b.Split.Parts) != 3 {
+		t.Fatalf("SplitEvenly = %+v, %v", b, err)
+	}
+	var sum int64
+	var qty float64
+	for _, p := range b.Split.Parts {
+		sum += p.Basket.Due
+		qty += p.Basket.Lines[0].Qty
+		if p.Basket.Due < 40 || p.Basket.Due > 41 || p.Basket.Lines[0].Share != 3 {
+			t.Fatalf("even part = %+v", p.Basket)
+		}
+	}
+	if sum != b.Total || RoundQty(qty) != 1 {
+		t.Fatalf("parts sum to %d and %v units; want %d and 1", sum, qty, b.Total)
+	}
+	if _, err := s.Scan("T1", "A"); !errors.Is(err, ErrBillSplit) {
+		t.Fatalf("scan on split bill err = %v", err)
+	}
+	if _, err := s.SplitEvenly("T1", 2); !errors.Is(err, ErrBillSplit) {
+		t.Fatalf("split twice err = %v", err)
+	}
+	if _, err := s.Unsplit("T1"); err != nil {
+		t.Fatalf("Unsplit: %v", err)
+	}
+
+	// by seat: unseated lines are shared
+	_, _ = s.VoidLine("T1", 1)
+	_, _ = s.ScanQty("T1", "A", 2)
+	_, _ = s.Scan("T1", "B")
+	if _, err := s.SplitBySeat("T1"); !errors.Is(err, ErrSplitSeats) {
+		t.Fatalf("no seats err = %v", err)
+	}
+	_, _ = s.SetLineSeat("T1", 1, 1)
+	_, _ = s.SetLineSeat("T1", 2, 2)
+	_, _ = s.Scan("T1", "B") // seat 0, so a line of its own
+	b, err = s.SplitBySeat("T1")
+	if err != nil || len(b.Lines) != 3 || b.Total != 3600 {
+		t.Fatalf("SplitBySeat = %+v, %v", b, err)
+	}
+	if p := b.Split.Parts; p[0].Basket.Due != 2700 || p[1].Basket.Due != 900 {
+		t.Fatalf("seat parts due %d, %d", p[0].Basket.Due, p[1].Basket.Due)
+	}
+	ref := b.Split.Ref
+
+	// each part is its own sale; the bill clears with the last
+	sale, err := s.TenderPart("T1", 2, Payment{Method: MethodCard})
+	if err != nil || sale == nil || sale.SplitRef != ref || sale.SplitPart != 2 || sale.Total != 900 {
+		t.Fatalf("TenderPart = %+v, %v", sale, err)
+	}
+	if _, err := s.TenderPart("T1", 2, Payment{Method: MethodCard}); !errors.Is(err, ErrPartPaid) {
+		t.Fatalf("pay part twice err = %v", err)
+	}
+	if _, err := s.Unsplit("T1"); !errors.Is(err, ErrBasketLocked) {
+		t.Fatalf("unsplit part paid err = %v", err)
+	}
+	if b := s.Basket("T1"); b.Split == nil || !b.Split.Parts[1].Settled || b.Split.Parts[1].ReceiptNo != sale.ReceiptNo {
+		t.Fatalf("basket after part = %+v", b.Split)
+	}
+	if sale, err = s.Tender("T1", 3000, MethodCash); err != nil || sale == nil || sale.SplitPart != 1 || sale.Change != 300 {
+		t.Fatalf("Tender rest = %+v, %v", sale, err)
+	}
+	if b := s.Basket("T1"); len(b.Lines) != 0 || b.Split != nil {
+		t.Fatalf("basket not cleared: %+v", b)
+	}
+	sales, err := s.SplitSales(ref)
+	if err != nil || len(sales) != 2 || sales[0].Total+sales[1].Total != 3600 || sales[0].Lines[0].Seat != 1 || sales[0].Lines[1].Share != 2 {
+		t.Fatalf("SplitSales = %+v, %v", sales, err)
+	}
+
+	// promotion discounts follow the lines they were taken from
+	promos := promoList{{ID: "P10", Name: "10% off A", Kind: PromoPercent, Percent: 10, Match: PromoMatch{SKUs: []string{"A"}}}}
+	s = NewServiceWithResolver(Config{Journal: j, Tax: PercentTaxEngine{RatePercent: 20}, Promotions: promos}, items)
+	_, _ = s.ScanQty("T1", "A", 3)
+	_, _ = s.Scan("T1", "B")
+	if b, err = s.SplitByLines("T1", map[int]int{2: 2}); err != nil {
+		t.Fatalf("SplitByLines: %v", err)
+	}
+	if p := b.Split.Parts; len(p[0].Basket.Discounts) != 1 || p[0].Basket.Discounts[0].AmountCents != 300 ||
+		p[0].Basket.Discounts[0].Lines[0] != 1 || len(p[1].Basket.Discounts) != 0 {
+		t.Fatalf("parts' discounts = %+v, %+v", p[0].Basket.Discounts, p[1].Basket.Discounts)
+	}
+	_, _ = s.Unsplit("T1")
+	if b, err = s.SplitEvenly("T1", 2); err != nil {
+		t.Fatalf("SplitEvenly: %v", err)
+	}
+	for _, p := range b.Split.Parts {
+		if len(p.Basket.Discounts) != 1 || p.Basket.Discounts[0].AmountCents != 150 {
+			t.Fatalf("even part discounts = %+v", p.Basket.Discounts)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package pos
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoTables      = errors.New("table service is not configured")
+	ErrTableNotFound = errors.New("table not found")
+	ErrTableID       = errors.New("table ID must be letters, digits, '-' or '_'")
+	ErrTablePlace    = errors.New("seats and position must be zero or more")
+	ErrTableOccupied = errors.New("table has an open tab")
+	ErrTabNotFound   = errors.New("table has no open tab")
+	ErrTabTender     = errors.New("bring the tab to a till to take payment")
+	ErrCovers        = errors.New("covers must be zero or more")
+)
+
+// Table is a table on the floor plan. X and Y place it on the plan's grid,
+// counting from 1; 0 lets it flow into the next free place.
+type Table struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Seats int    `json:"seats,omitempty"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+}
+
+// TableStore keeps the floor plan and the tab open on each table. A tab
+// is a basket named by its table that any terminal can order on.
+type TableStore interface {
+	Tables() ([]Table, error)
+	SaveTable(t Table) error
+	DeleteTable(id string) error
+	// Tab returns the table's open tab, or an empty basket when there is none.
+	Tab(table string) (Basket, error)
+	SaveTab(table string, b Basket) error
+	DeleteTab(table string) error
+	Tabs() ([]Basket, error)
+}
+
+// TableStatus is a table on the floor plan with its tab, if any.
+type TableStatus struct {
+	Table
+	Occupied bool          `json:"occupied"`
+	Covers   int           `json:"covers,omitempty"`
+	Items    float64       `json:"items,omitempty"`
+	Due      int64         `json:"due,omitempty"`
+	OpenedAt time.Time     `json:"openedAt,omitempty"`
+	Open     time.Duration `json:"open,omitempty"` // how long the tab has been open
+}
+
+// Minutes is how long the tab has been open, in whole minutes.
+func (t TableStatus) Minutes() int { return int(t.Open / time.Minute) }
+
+const tabPrefix = "tab:"
+
+// TabKey is the basket ID of the table's tab; pass it to the basket
+// methods (Scan, VoidLine, AttachCustomer and so on) to order on the tab.
+// Terminal IDs can't contain ':' so the two never collide.
+func TabKey(table string) string { return tabPrefix + table }
+
+// IsTab reports whether the basket ID names a table's tab.
+func IsTab(id string) bool { return strings.HasPrefix(id, tabPrefix) }
+
+// ValidateTable checks a table before it is saved.
+func ValidateTable(t Table) error {
+	if t.ID == "" || len(t.ID) > 16 {
+		return ErrTableID
+	}
+	for _, c := range t.ID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return ErrTableID
+		}
+	}
+	if t.Seats < 0 || t.X < 0 || t.Y < 0 {
+		return ErrTablePlace
+	}
+	return nil
+}
+
+// Tables returns the floor plan.
+func (s *Service) Tables() ([]Table, error) {
+	if s.cfg.Tables == nil {
+		return nil, nil
+	}
+	return s.cfg.Tables.Tables()
+}
+
+// SaveTable adds or replaces a table on the floor plan.
+func (s *Service) SaveTable(t Table) error {
+	if s.cfg.Tables == nil {
+		return ErrNoTables
+	}
+	t.ID, t.Name = strings.TrimSpace(t.ID), strings.TrimSpace(t.Name)
+	if err := ValidateTable(t); err != nil {
+		return err
+	}
+	return s.cfg.Tables.SaveTable(t)
+}
+
+// DeleteTable takes a table off the floor plan; its tab must be settled
+// or moved first.
+func (s *Service) DeleteTable(id string) error {
+	if s.cfg.Tables == nil {
+		return ErrNoTables
+	}
+	tab, err := s.cfg.Tables.Tab(id)
+	if err != nil {
+		return err
+	}
+	if !tab.empty() {
+		return ErrTableOccupied
+	}
+	return s.cfg.Tables.DeleteTable(id)
+}
+
+func (s *Service) table(id string) (Table, error) {
+	if s.cfg.Tables == nil {
+		return Table{}, ErrNoTables
+	}
+	list, err := s.cfg.Tables.Tables()
+	if err != nil {
+		return Table{}, err
+	}
+	for _, t := range list {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return Table{}, ErrTableNotFound
+}
+
+// FloorPlan lists the tables with how many are seated at each, what is
+// on the tab and how long it has been open.
+func (s *Service) FloorPlan() ([]TableStatus, error) {
+	tables, err := s.Tables()
+	if err != nil || tables == nil {
+		return nil, err
+	}
+	tabs, err := s.cfg.Tables.Tabs()
+	if err != nil {
+		return nil, err
+	}
+	byTable := map[string]Basket{}
+	for _, b := range tabs {
+		byTable[b.Table] = b
+	}
+	now := s.now()
+	out := make([]TableStatus, 0, len(tables))
+	for _, t := range tables {
+		st := TableStatus{Table: t}
+		if b, ok := byTable[t.ID]; ok {
+			st.Occupied, st.Covers, st.Due, st.OpenedAt = true, b.Covers, b.Due, b.OpenedAt
+			st.Open = now.Sub(b.OpenedAt)
+			for _, l := range b.Lines {
+				st.Items += l.Qty
+			}
+		}
+		out = append(out, st)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Y != out[j].Y {
+			return out[i].Y < out[j].Y
+		}
+		return out[i].X < out[j].X
+	})
+	return out, nil
+}
+
+// OpenTab seats covers at the table, opening its tab if there isn't one;
+// covers of zero leave the count as it is. Orders go on the tab through
+// the basket methods with TabKey.
+func (s *Service) OpenTab(table string, covers int) (*Basket, error) {
+	if covers < 0 {
+		return nil, ErrCovers
+	}
+	if _, err := s.table(table); err != nil {
+		return nil, err
+	}
+	var out Basket
+	err := s.baskets.With(TabKey(table), func(b *Basket) error {
+		if covers > 0 {
+			b.Covers = covers
+		}
+		b.Table = table
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MoveTab moves the tab from one table to another, which must be free.
+func (s *Service) MoveTab(from, to string) (*Basket, error) {
+	if _, err := s.table(to); err != nil {
+		return nil, err
+	}
+	var out Basket
+	err := s.baskets.WithPair(TabKey(from), TabKey(to), func(src, dst *Basket) error {
+		if src.empty() {
+			return ErrTabNotFound
+		}
+		if !dst.empty() {
+			return ErrTableOccupied
+		}
+		*dst, *src = *src, Basket{}
+		dst.Table = to
+		out = dst.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MergeTabs moves everything on the from table's tab onto the into
+// table's, adding up the covers; the into tab keeps its customer, operator
+// and service charge if it has them.
+func (s *Service) MergeTabs(from, into string) (*Basket, error) {
+	if s.cfg.Tables == nil {
+		return nil, ErrNoTables
+	}
+	var out Basket
+	err := s.baskets.WithPair(TabKey(from), TabKey(into), func(src, dst *Basket) error {
+		if src.empty() || dst.empty() {
+			return ErrTabNotFound
+		}
+		if src.AgeCheck != nil || dst.AgeCheck != nil {
+			return ErrAgePending
+		}
+		if src.Split != nil || dst.Split != nil {
+			return ErrBillSplit
+		}
+		for _, l := range src.Lines {
+			l.LineNo = dst.nextLineNo()
+			dst.Lines = append(dst.Lines, l)
+		}
+		dst.Vouchers = append(dst.Vouchers, src.Vouchers...)
+		dst.Covers += src.Covers
+		if dst.Customer == nil {
+			dst.Customer = src.Customer
+		}
+		if dst.Operator == "" {
+			dst.Operator = src.Operator
+		}
+		if dst.ServiceChargeBP == 0 {
+			dst.ServiceChargeBP = src.ServiceChargeBP
+		}
+		if !src.OpenedAt.IsZero() && src.OpenedAt.Before(dst.OpenedAt) {
+			dst.OpenedAt = src.OpenedAt
+		}
+		*src = Basket{}
+		s.recalc(dst)
+		out = dst.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SettleTab brings the table's tab to the terminal to be paid, freeing
+// the table. The terminal's basket must be empty; the sale keeps the
+// table and covers.
+func (s *Service) SettleTab(terminal, table string) (*Basket, error) {
+	if s.cfg.Tables == nil {
+		return nil, ErrNoTables
+	}
+	if IsTab(terminal) {
+		return nil, ErrTabTender
+	}
+	var out Basket
+	err := s.baskets.WithPair(terminal, TabKey(table), func(till, tab *Basket) error {
+		if !till.empty() {
+			return ErrBasketNotEmpty
+		}
+		if tab.empty() {
+			return ErrTabNotFound
+		}
+		*till, *tab = *tab, Basket{}
+		s.recalc(till)
+		out = till.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendToTable puts the terminal's basket on the table's tab, which must be
+// free, so it can be ordered on and settled later. Baskets with payments
+// can't be sent.
+func (s *Service) SendToTable(terminal, table string) (*Basket, error) {
+	if _, err := s.table(table); err != nil {
+		return nil, err
+	}
+	var out Basket
+	err := s.baskets.WithPair(terminal, TabKey(table), func(till, tab *Basket) error {
+		if till.empty() {
+			return ErrEmptyBasket
+		}
+		if err := till.locked(); err != nil {
+			return err
+		}
+		if !tab.empty() {
+			return ErrTableOccupied
+		}
+		*tab, *till = *till, Basket{}
+		tab.Table = table
+		out = tab.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// tabBacking keeps table tabs in the table store.
+type tabBacking struct{ s *Service }
+
+func (t tabBacking) owns(id string) bool { return IsTab(id) }
+
+func (t tabBacking) load(id string) (Basket, error) {
+	return t.s.cfg.Tables.Tab(strings.TrimPrefix(id, tabPrefix))
+}
+
+func (t tabBacking) save(id string, b *Basket) error {
+	table := strings.TrimPrefix(id, tabPrefix)
+	if b.empty() {
+		return t.s.cfg.Tables.DeleteTab(table)
+	}
+	if _, err := t.s.table(table); err != nil {
+		return err
+	}
+	b.Table = table
+	if b.OpenedAt.IsZero() {
+		b.OpenedAt = t.s.now().UTC().Truncate(time.Second)
+	}
+	return t.s.cfg.Tables.SaveTab(table, b.clone())
+}
@@ -0,0 +1,80 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTableTabs(t *testing.T) {
+	items := mapResolver{"A": {SKU: "A", Name: "A", Qty: 1, PriceCents: 1000}}
+	f := newFixture(t)
+	j, tables := f.journal, f.tables
+	s := NewServiceWithResolver(Config{Journal: j, Tables: tables, Tax: PercentTaxEngine{RatePercent: 20}}, items)
+	now := time.Date(2026, 10, 17, 19, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	for _, tb := range []Table{{ID: "1", Seats: 2}, {ID: "2", Seats: 4, X: 1}, {ID: "3", Seats: 4, X: 2}} {
+		if err := s.SaveTable(tb); err != nil {
+			t.Fatalf("SaveTable: %v", err)
+		}
+	}
+	if err := s.SaveTable(Table{ID: "tab:1"}); !errors.Is(err, ErrTableID) {
+		t.Fatalf("bad ID err = %v", err)
+	}
+	if _, err := s.OpenTab("9", 2); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("unknown table err = %v", err)
+	}
+
+	// orders from two terminals build up on the one tab, kept in the store
+	if _, err := s.OpenTab("1", 2); err != nil {
+		t.Fatalf("OpenTab: %v", err)
+	}
+	_, _ = s.Scan(TabKey("1"), "A")
+	now = now.Add(40 * time.Minute)
+	other := NewServiceWithResolver(Config{Journal: j, Tables: tables, Tax: PercentTaxEngine{RatePercent: 20}}, items)
+	b, err := other.Scan(TabKey("1"), "A")
+	if err != nil || b.Lines[0].Qty != 2 || b.Covers != 2 || b.Total != 2400 {
+		t.Fatalf("tab = %+v, %v", b, err)
+	}
+	if _, err := s.Tender(TabKey("1"), 0, MethodCard); !errors.Is(err, ErrTabTender) {
+		t.Fatalf("tender on tab err = %v", err)
+	}
+	plan, _ := s.FloorPlan()
+	if len(plan) != 3 || !plan[0].Occupied || plan[0].Minutes() != 40 || plan[0].Due != 2400 || plan[1].Occupied {
+		t.Fatalf("floor plan = %+v", plan)
+	}
+
+	// move, then merge another table into it
+	if _, err := s.MoveTab("1", "2"); err != nil {
+		t.Fatalf("MoveTab: %v", err)
+	}
+	_, _ = s.OpenTab("3", 3)
+	_, _ = s.Scan(TabKey("3"), "A")
+	if _, err := s.MoveTab("3", "2"); !errors.Is(err, ErrTableOccupied) {
+		t.Fatalf("move onto tab err = %v", err)
+	}
+	b, err = s.MergeTabs("3", "2")
+	if err != nil || len(b.Lines) != 2 || b.Covers != 5 || b.Total != 3600 || b.Lines[1].LineNo != 2 {
+		t.Fatalf("merged = %+v, %v", b, err)
+	}
+	plan, _ = s.FloorPlan()
+	if plan[0].Occupied || !plan[1].Occupied || plan[1].Minutes() != 40 || plan[2].Occupied {
+		t.Fatalf("floor plan = %+v", plan)
+	}
+
+	// settling brings it to the till and frees the table
+	if _, err := s.SettleTab("T1", "2"); err != nil {
+		t.Fatalf("SettleTab: %v", err)
+	}
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if err != nil || sale == nil {
+		t.Fatalf("tender: %+v, %v", sale, err)
+	}
+	got, _ := j.Get(sale.ReceiptNo)
+	if got.Table != "2" || got.Covers != 5 || got.Total != 3600 {
+		t.Fatalf("journalled = %+v", got)
+	}
+	if tabs, _ := tables.Tabs(); len(tabs) != 0 {
+		t.Fatalf("tabs left = %+v", tabs)
+	}
+}
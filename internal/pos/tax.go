@@ -1,27 +1,176 @@
 package pos
 
+import "sort"
+
+// Tax classes carried by catalog items. Lines without a class are standard rated.
+const (
+	TaxStandard = "standard"
+	TaxReduced  = "reduced"
+	TaxZero     = "zero"
+	// TaxOutside is for lines outside the scope of tax, such as gift card
+	// sales; they're never taxed and don't appear in tax breakdowns.
+	TaxOutside = "outside"
+)
+
+// DefaultTaxRates returns UK VAT rates in basis points.
+func DefaultTaxRates() map[string]int {
+	return map[string]int{TaxStandard: 2000, TaxReduced: 500, TaxZero: 0}
+}
+
+// LineTax is the tax worked out for one basket line.
+type LineTax struct {
+	RateBP     int   // basis points: 2000 = 20%
+	TaxCents   int64 // tax contained in or added to the line
+	TotalCents int64 // what the customer pays for the line
+}
+
 type TaxEngine interface {
-	Compute(subtotalCents int64) (taxCents int64, totalCents int64)
+	// Compute returns the tax for each line, in line order.
+	Compute(lines []BasketLine) []LineTax
+}
+
+// TaxBand sums the lines charged at one rate, as printed on receipts and
+// tax reports.
+type TaxBand struct {
+	Class  string `json:"class"`
+	RateBP int    `json:"rateBp"`
+	Net    int64  `json:"net"`
+	Tax    int64  `json:"tax"`
+	Gross  int64  `json:"gross"`
+}
+
+// RatePercent formats the band rate for display, e.g. 20 or 17.5.
+func (b TaxBand) RatePercent() float64 { return float64(b.RateBP) / 100 }
+
+// ClassTaxEngine charges each line at the rate for its tax class. Tax is
+// worked out once per rate group and shared back across the group's lines,
+// so a basket never drifts by a penny per line.
+type ClassTaxEngine struct {
+	Rates     map[string]int // class -> basis points; unknown classes use TaxStandard
+	Inclusive bool           // if true, prices already include tax
+}
+
+func (e ClassTaxEngine) Compute(lines []BasketLine) []LineTax {
+	return computeGrouped(lines, e.Inclusive, func(l BasketLine) int {
+		if r, ok := e.Rates[l.TaxClass]; ok {
+			return r
+		}
+		return e.Rates[TaxStandard]
+	})
+}
+
+// computeTax runs the engine over the lines within the scope of tax;
+// lines outside it come back untaxed.
+func computeTax(e TaxEngine, lines []BasketLine) []LineTax {
+	var in []BasketLine
+	var idx []int
+	out := make([]LineTax, len(lines))
+	for i, l := range lines {
+		if l.TaxClass == TaxOutside {
+			out[i].TotalCents = l.Net()
+			continue
+		}
+		in = append(in, l)
+		idx = append(idx, i)
+	}
+	for k, t := range e.Compute(in) {
+		out[idx[k]] = t
+	}
+	return out
 }
 
+// PercentTaxEngine charges one rate on every line regardless of class.
 type PercentTaxEngine struct {
 	RatePercent int  // e.g. 20 for 20%
 	Inclusive   bool // if true, subtotal already includes tax
 }
 
-func (e PercentTaxEngine) Compute(subtotal int64) (int64, int64) {
-	if e.RatePercent <= 0 {
-		return 0, subtotal
+func (e PercentTaxEngine) Compute(lines []BasketLine) []LineTax {
+	rate := max(e.RatePercent, 0) * 100
+	return computeGrouped(lines, e.Inclusive, func(BasketLine) int { return rate })
+}
+
+// computeGrouped taxes lines per rate group and apportions each group's tax
+// over its lines by net amount.
+func computeGrouped(lines []BasketLine, inclusive bool, rateOf func(BasketLine) int) []LineTax {
+	out := make([]LineTax, len(lines))
+	groups := map[int][]int{}
+	for i, l := range lines {
+		r := rateOf(l)
+		out[i].RateBP = r
+		groups[r] = append(groups[r], i)
+	}
+	for rate, idx := range groups {
+		weights := make([]int64, len(idx))
+		var base int64
+		for k, i := range idx {
+			weights[k] = lines[i].Net()
+			base += weights[k]
+		}
+		shares := allocate(bandTax(base, rate, inclusive), weights)
+		for k, i := range idx {
+			out[i].TaxCents = shares[k]
+			out[i].TotalCents = weights[k]
+			if !inclusive {
+				out[i].TotalCents += shares[k]
+			}
+		}
+	}
+	return out
+}
+
+// bandTax is the tax on base at rate basis points, rounded half up.
+func bandTax(base int64, rateBP int, inclusive bool) int64 {
+	if rateBP <= 0 || base == 0 {
+		return 0
+	}
+	if inclusive {
+		// tax = base - base/(1+rate)
+		return base - roundDiv(base*10000, int64(10000+rateBP))
+	}
+	return roundDiv(base*int64(rateBP), 10000)
+}
+
+// roundDiv divides rounding half away from zero.
+func roundDiv(n, d int64) int64 {
+	if n < 0 {
+		return -roundDiv(-n, d)
+	}
+	return (n + d/2) / d
+}
+
+// Breakdown groups lines by tax class and rate. Lines must already carry
+// their tax (see Service.recalc or a journalled sale).
+func Breakdown(lines []BasketLine) []TaxBand {
+	type key struct {
+		class string
+		rate  int
 	}
-	if e.Inclusive {
-		// tax = subtotal - subtotal/(1+rate)
-		// do integer math: tax = subtotal - floor(subtotal*100/(100+rate)) with rate as percent
-		den := int64(100 + e.RatePercent)
-		net := (subtotal * 100) / den
-		tax := subtotal - net
-		return tax, subtotal
+	idx := map[key]int{}
+	var out []TaxBand
+	for _, l := range lines {
+		if l.TaxClass == TaxOutside {
+			continue
+		}
+		k := key{l.TaxClass, l.TaxRateBP}
+		if k.class == "" {
+			k.class = TaxStandard
+		}
+		i, ok := idx[k]
+		if !ok {
+			i = len(out)
+			idx[k] = i
+			out = append(out, TaxBand{Class: k.class, RateBP: k.rate})
+		}
+		out[i].Tax += l.TaxCents
+		out[i].Gross += l.TotalCents
+		out[i].Net += l.TotalCents - l.TaxCents
 	}
-	// exclusive
-	tax := subtotal * int64(e.RatePercent) / 100
-	return tax, subtotal + tax
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RateBP != out[j].RateBP {
+			return out[i].RateBP > out[j].RateBP
+		}
+		return out[i].Class < out[j].Class
+	})
+	return out
 }
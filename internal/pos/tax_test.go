@@ -0,0 +1,44 @@
+package pos
+
+import (
+	"testing"
+)
+
+func TestMixedRateBasket(t *testing.T) {
+	items := mapResolver{
+		"W": {SKU: "W", Name: "Wine", Qty: 1, PriceCents: 1200},
+		"F": {SKU: "F", Name: "Child seat", Qty: 1, PriceCents: 1050, TaxClass: TaxReduced},
+		"B": {SKU: "B", Name: "Bread", Qty: 1, PriceCents: 150, TaxClass: TaxZero},
+	}
+	for _, tc := range []struct {
+		inclusive       bool
+		tax, total      int64
+		standard, lower int64
+	}{
+		{inclusive: true, tax: 250, total: 2400, standard: 200, lower: 50},
+		{inclusive: false, tax: 293, total: 2693, standard: 240, lower: 53},
+	} {
+		s := NewServiceWithResolver(Config{TaxInclusive: tc.inclusive}, items)
+		for _, code := range []string{"W", "F", "B"} {
+			if _, err := s.Scan("T1", code); err != nil {
+				t.Fatalf("Scan %s: %v", code, err)
+			}
+		}
+		b := s.Basket("T1")
+		if b.Tax != tc.tax || b.Total != tc.total {
+			t.Fatalf("inclusive=%v: tax=%d total=%d; want %d, %d", tc.inclusive, b.Tax, b.Total, tc.tax, tc.total)
+		}
+		if len(b.TaxBreakdown) != 3 {
+			t.Fatalf("breakdown = %+v; want 3 bands", b.TaxBreakdown)
+		}
+		std, red, zero := b.TaxBreakdown[0], b.TaxBreakdown[1], b.TaxBreakdown[2]
+		if std.RateBP != 2000 || std.Tax != tc.standard || red.RateBP != 500 || red.Tax != tc.lower || zero.Tax != 0 {
+			t.Fatalf("inclusive=%v: unexpected breakdown %+v", tc.inclusive, b.TaxBreakdown)
+		}
+		for _, band := range b.TaxBreakdown {
+			if band.Net+band.Tax != band.Gross {
+				t.Fatalf("band %+v does not add up", band)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package pos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// TaxRule is one row of a tax table: the rate a jurisdiction charges on a
+// tax class over a date range. Region is a slash separated path below the
+// country ("CA/Los Angeles"); empty means country-wide. Class is empty for
+// a rule covering every class the jurisdiction doesn't list separately.
+type TaxRule struct {
+	Country string `json:"country"`
+	Region  string `json:"region,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Class   string `json:"class,omitempty"`
+	RateBP  int    `json:"rateBp"`
+	From    string `json:"from,omitempty"`  // first day in effect, YYYY-MM-DD
+	Until   string `json:"until,omitempty"` // first day no longer in effect
+}
+
+// TaxTable holds the rules for every jurisdiction a till may be set up for.
+type TaxTable []TaxRule
+
+// LoadTaxTable reads a JSON array of TaxRule.
+func LoadTaxTable(path string) (TaxTable, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t TaxTable
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, r := range t {
+		for _, d := range []string{r.From, r.Until} {
+			if _, err := time.Parse(dateLayout, d); d != "" && err != nil {
+				return nil, fmt.Errorf("%s: rule %d: bad date %q", path, i, d)
+			}
+		}
+		if r.Country == "" || r.RateBP < 0 {
+			return nil, fmt.Errorf("%s: rule %d: country and a non-negative rate are required", path, i)
+		}
+	}
+	return t, nil
+}
+
+// Rates returns the rate per tax class in effect on day at for a till in
+// country/region. Every jurisdiction the region sits in charges its own rate
+// and the rates add up, so a till in "CA/Los Angeles" pays state and county
+// tax. The result always has a TaxStandard entry unless nothing matched.
+func (t TaxTable) Rates(country, region string, at time.Time) map[string]int {
+	day := at.Format(dateLayout)
+	path := regionPath(region)
+	// jurisdiction -> class -> rule in effect
+	layers := map[string]map[string]TaxRule{}
+	classes := map[string]bool{TaxStandard: true}
+	for _, r := range t {
+		if !strings.EqualFold(r.Country, country) || !r.activeOn(day) || !within(regionPath(r.Region), path) {
+			continue
+		}
+		j := strings.ToLower(strings.Join(regionPath(r.Region), "/"))
+		if layers[j] == nil {
+			layers[j] = map[string]TaxRule{}
+		}
+		// overlapping ranges: the most recent start wins
+		if cur, ok := layers[j][r.Class]; !ok || r.From > cur.From {
+			layers[j][r.Class] = r
+		}
+		if r.Class != "" {
+			classes[r.Class] = true
+		}
+	}
+	if len(layers) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(classes))
+	for c := range classes {
+		for _, rules := range layers {
+			if r, ok := rules[c]; ok {
+				out[c] += r.RateBP
+			} else if r, ok := rules[""]; ok {
+				out[c] += r.RateBP
+			}
+		}
+	}
+	return out
+}
+
+func (r TaxRule) activeOn(day string) bool {
+	return (r.From == "" || r.From <= day) && (r.Until == "" || day < r.Until)
+}
+
+func regionPath(region string) []string {
+	var out []string
+	for _, p := range strings.Split(region, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// within reports whether jurisdiction path j contains the till's region path.
+func within(j, region []string) bool {
+	if len(j) > len(region) {
+		return false
+	}
+	for i := range j {
+		if !strings.EqualFold(j[i], region[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// FlatTaxRates charges rateBP on everything except zero-rated items.
+func FlatTaxRates(rateBP int) map[string]int {
+	return map[string]int{TaxStandard: max(rateBP, 0), TaxZero: 0}
+}
+
+// TableTaxEngine looks its rates up in a tax table on every calculation so
+// a rate change takes effect on its start date without a restart. Fallback
+// is used when the table has nothing for the country, and StandardBP, when
+// set, replaces the standard rate either gives; zero is a rate like any other.
+type TableTaxEngine struct {
+	Table      TaxTable
+	Country    string
+	Region     string
+	Fallback   map[string]int
+	StandardBP *int
+	Inclusive  bool
+	Now        func() time.Time // defaults to time.Now
+}
+
+func (e TableTaxEngine) Compute(lines []BasketLine) []LineTax {
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+	rates := e.Table.Rates(e.Country, e.Region, now())
+	if rates == nil {
+		rates = e.Fallback
+	}
+	if e.StandardBP != nil {
+		own := make(map[string]int, len(rates)+1)
+		for c, bp := range rates {
+			own[c] = bp
+		}
+		own[TaxStandard] = max(*e.StandardBP, 0)
+		rates = own
+	}
+	return ClassTaxEngine{Rates: rates, Inclusive: e.Inclusive}.Compute(lines)
+}
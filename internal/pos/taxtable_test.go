@@ -0,0 +1,64 @@
+package pos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaxTableStacksJurisdictionsByDate(t *testing.T) {
+	table := TaxTable{
+		{Country: "GB", Class: TaxStandard, RateBP: 1750, Until: "2011-01-04"},
+		{Country: "GB", Class: TaxStandard, RateBP: 2000, From: "2011-01-04"},
+		{Country: "GB", Class: TaxReduced, RateBP: 500},
+		{Country: "US", Region: "CA", RateBP: 725},
+		{Country: "US", Region: "CA", Class: TaxZero, RateBP: 0},
+		{Country: "US", Region: "CA/Los Angeles", RateBP: 225},
+		{Country: "US", Region: "NY", RateBP: 400},
+	}
+	day := func(s string) time.Time { d, _ := time.Parse("2006-01-02", s); return d }
+
+	if r := table.Rates("gb", "", day("2011-01-03")); r[TaxStandard] != 1750 || r[TaxReduced] != 500 {
+		t.Fatalf("GB before change = %v", r)
+	}
+	if r := table.Rates("GB", "", day("2011-01-04")); r[TaxStandard] != 2000 {
+		t.Fatalf("GB after change = %v", r)
+	}
+	if r := table.Rates("US", "ca/los angeles", day("2024-06-01")); r[TaxStandard] != 950 || r[TaxZero] != 225 {
+		t.Fatalf("Los Angeles = %v", r)
+	}
+	if r := table.Rates("US", "CA", day("2024-06-01")); r[TaxStandard] != 725 {
+		t.Fatalf("California = %v", r)
+	}
+	if r := table.Rates("FR", "", day("2024-06-01")); r != nil {
+		t.Fatalf("unknown country = %v; want nil", r)
+	}
+
+	// a settings change reprices open baskets through the fallback
+	s := NewService(Config{Tax: TableTaxEngine{Table: table, Country: "GB"}})
+	_, _ = s.Scan("T1", "A")
+	if b := s.Basket("T1"); b.Tax != 50 || b.Total != 300 {
+		t.Fatalf("GB basket tax=%d total=%d; want 50, 300", b.Tax, b.Total)
+	}
+	s.SetTaxEngine(TableTaxEngine{Table: table, Country: "FR", Fallback: FlatTaxRates(1000)})
+	if b := s.Basket("T1"); b.Tax != 25 || b.Total != 275 {
+		t.Fatalf("fallback basket tax=%d total=%d; want 25, 275", b.Tax, b.Total)
+	}
+
+	// a configured rate replaces the table's standard rate, not the others
+	override := 1500
+	s.SetTaxEngine(TableTaxEngine{Table: table, Country: "GB", StandardBP: &override})
+	if b := s.Basket("T1"); b.Tax != 38 || b.Total != 288 {
+		t.Fatalf("override basket tax=%d total=%d; want 38, 288", b.Tax, b.Total)
+	}
+	e := TableTaxEngine{Table: table, Country: "GB", StandardBP: &override}
+	if lt := e.Compute([]BasketLine{{Qty: 1, PriceCents: 1000, TaxClass: TaxReduced}}); lt[0].RateBP != 500 {
+		t.Fatalf("reduced rate under override = %+v", lt)
+	}
+	// a fractional rate, and 0% as a rate rather than "use the table"
+	for bp, want := range map[int]int64{1750: 175, 0: 0} {
+		e.StandardBP = &bp
+		if lt := e.Compute([]BasketLine{{Qty: 1, PriceCents: 1000}}); lt[0].RateBP != bp || lt[0].TaxCents != want {
+			t.Fatalf("override %dbp = %+v", bp, lt)
+		}
+	}
+}
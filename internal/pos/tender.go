@@ -0,0 +1,322 @@
+package pos
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+const (
+	MethodCash    = "cash"
+	MethodCard    = "card"
+	MethodVoucher = "voucher"
+)
+
+var (
+	ErrNoMethod     = errors.New("tender method is required")
+	ErrOverpayment  = errors.New("amount exceeds the balance due; only cash can be overpaid")
+	ErrBasketLocked = errors.New("basket has payments; finish or cancel tendering first")
+	ErrNoPayment    = errors.New("payment not found")
+)
+
+// givesChange reports whether overpaying with method returns change.
+func givesChange(method string) bool { return method == MethodCash }
+
+// Tender takes a payment against the terminal's basket. An amount of zero
+// or less pays the balance due. Payments build up until the balance reaches
+// zero, at which point the sale is written to the journal and the basket
+// cleared; until then the returned sale is nil. Cash may exceed the balance
+// and the difference is returned as change; other methods may not.
+// The basket is kept if the journal write fails so the sale can be retried.
+// When till sessions are configured the terminal's till must be open and
+// the sale is tied to its session.
+// Cash that settles the basket pays the balance rounded to the cash
+// rounding step (see SetCashRounding), and the difference is kept on the
+// basket and sale as Rounding.
+// Foreign cash names its Currency and ForeignCents (zero pays the balance
+// due) and is converted at the rate table's effective rate; change is given
+// in the base currency.
+// Points payments come off the attached customer's balance as they are
+// taken; the points a sale earns are posted once it is journalled, and if
+// that post fails the sale is returned along with the error.
+func (s *Service) Tender(terminal string, amount int64, method string) (*Sale, error) {
+	return s.TenderPayment(terminal, Payment{Method: method, AmountCents: amount})
+}
+
+// TenderPayment is Tender for payments that carry a reference: gift card
+// payments name the card in Ref and come off it as they are taken. With
+// no amount a gift card pays the balance due or what is left on the card,
+// whichever is less. Gift cards sold in the basket are loaded once the
+// sale is journalled. Card payments may add TipCents on top of the amount;
+// the tip goes on the basket for its operator. A split bill is paid part
+// by part, starting with the first part still open (see TenderPart).
+func (s *Service) TenderPayment(terminal string, p Payment) (*Sale, error) {
+	return s.TenderPart(terminal, 0, p)
+}
+
+// TenderPart is TenderPayment for a part of a split bill, numbered from 1;
+// part 0 is the first part still open. Each part settles as its own sale,
+// and the basket clears once every part is paid.
+func (s *Service) TenderPart(terminal string, part int, p Payment) (*Sale, error) {
+	method := strings.ToLower(strings.TrimSpace(p.Method))
+	if method == "" {
+		return nil, ErrNoMethod
+	}
+	if IsTab(terminal) {
+		return nil, ErrTabTender
+	}
+	if p.TipCents < 0 {
+		return nil, ErrTipAmount
+	}
+	if p.TipCents > 0 && method != MethodCard {
+		return nil, ErrTipMethod
+	}
+	ref := p.Ref
+	if method == MethodGiftCard {
+		if ref = NormalizeGiftCardNumber(ref); ref == "" {
+			return nil, ErrGiftCardNotFound
+		}
+	}
+	var fx ExchangeRate
+	if cur := NormalizeCurrency(p.Currency); cur != "" && cur != s.baseCurrency() {
+		if method != MethodCash {
+			return nil, ErrForeignTender
+		}
+		var err error
+		if fx, err = s.ExchangeRate(cur); err != nil {
+			return nil, err
+		}
+	}
+	session, err := s.tillSession(terminal)
+	if err != nil {
+		return nil, err
+	}
+	p.Method, p.Ref = method, ref
+	var sale *Sale
+	var postErr error
+	err = s.baskets.With(terminal, func(b *Basket) error {
+		pb := b
+		if b.Split != nil {
+			i, err := b.Split.open(part)
+			if err != nil {
+				return err
+			}
+			pb = &b.Split.Parts[i].Basket
+		} else if part > 0 {
+			return ErrPartNotFound
+		}
+		var err error
+		if sale, err = s.pay(terminal, session, pb, p, fx); err != nil || sale == nil {
+			return err
+		}
+		postErr = s.postLedgers(sale)
+		if b.Split != nil {
+			b.Split.settle(pb.Part, sale.ReceiptNo)
+			if !b.Split.done() {
+				return nil
+			}
+		}
+		*b = Basket{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sale, postErr
+}
+
+// pay takes p against b, returning the journalled sale once b is paid in
+// full and nil until then.
+func (s *Service) pay(terminal string, session int64, b *Basket, p Payment, fx ExchangeRate) (*Sale, error) {
+	method, amount, ref := p.Method, p.AmountCents, p.Ref
+	if len(b.Lines) == 0 {
+		return nil, ErrEmptyBasket
+	}
+	if b.AgeCheck != nil {
+		return nil, ErrAgePending
+	}
+	exact := amount > 0
+	due := b.Due
+	if method == MethodCash {
+		due = RoundCash(b.Due, s.cashRounding())
+	}
+	foreign := p.ForeignCents
+	if fx.Currency != "" {
+		if foreign <= 0 {
+			foreign = foreignFor(due, fx.Effective())
+		}
+		amount = toBase(foreign, fx.Effective())
+	}
+	if amount <= 0 {
+		amount = due
+	}
+	if amount > b.Due && !givesChange(method) {
+		return nil, ErrOverpayment
+	}
+	var points, card int64
+	if amount > 0 && method == MethodPoints {
+		var err error
+		if points, amount, err = s.redeemPoints(terminal, b, amount); err != nil {
+			return nil, err
+		}
+	}
+	if amount > 0 && method == MethodGiftCard {
+		var err error
+		if card, err = s.redeemGiftCard(terminal, ref, amount, exact); err != nil {
+			return nil, err
+		}
+		amount = card
+	}
+	if codes := appliedVouchers(b); amount > 0 && len(b.Payments) == 0 && len(codes) > 0 && s.cfg.Vouchers != nil {
+		// the first payment fixes the price, so claim the vouchers now
+		if err := s.cfg.Vouchers.Redeem(codes, terminal, s.now()); err != nil {
+			_ = s.unredeemPoints(terminal, b, points)
+			_ = s.unredeemGiftCard(terminal, ref, card)
+			return nil, err
+		}
+	}
+	if method == MethodCash && amount >= due && due != b.Due {
+		b.Rounding += due - b.Due
+		s.recalc(b)
+	}
+	if amount > 0 {
+		pay := Payment{Method: method, AmountCents: amount}
+		if method == MethodGiftCard {
+			pay.Ref = ref
+		}
+		pay.Points = points
+		if fx.Currency != "" {
+			pay.Currency, pay.ForeignCents, pay.Rate = fx.Currency, foreign, fx.Effective()
+		}
+		if p.TipCents > 0 {
+			pay.AmountCents += p.TipCents
+			pay.TipCents = p.TipCents
+			b.Tip += p.TipCents
+		}
+		b.Payments = append(b.Payments, pay)
+		s.recalc(b)
+	}
+	if b.Due > 0 {
+		return nil, nil
+	}
+	sale := &Sale{
+		Terminal:        terminal,
+		CreatedAt:       s.now(),
+		Lines:           append([]BasketLine(nil), b.Lines...),
+		Payments:        append([]Payment(nil), b.Payments...),
+		Subtotal:        b.Subtotal,
+		Discounts:       append([]Discount(nil), b.Discounts...),
+		Discount:        b.Discount,
+		Vouchers:        appliedVouchers(b),
+		Tax:             b.Tax,
+		Total:           b.Total,
+		Change:          b.Paid - b.payable(),
+		Rounding:        b.Rounding,
+		ServiceChargeBP: b.ServiceChargeBP,
+		ServiceCharge:   b.ServiceCharge,
+		Tip:             b.Tip,
+		Operator:        b.Operator,
+		Table:           b.Table,
+		Covers:          b.Covers,
+		SplitRef:        b.SplitRef,
+		SplitPart:       b.Part,
+		SessionID:       session,
+		CustomerID:      b.customerID(),
+		PointsRedeemed:  b.PointsRedeemed,
+		TaxBreakdown:    Breakdown(b.Lines),
+	}
+	var err error
+	if sale.PointsEarned, err = s.pointsEarned(b); err != nil {
+		return nil, err
+	}
+	s.markPending(sale)
+	if s.cfg.Journal != nil {
+		if err := s.cfg.Journal.Record(sale); err != nil {
+			return nil, err
+		}
+	}
+	return sale, nil
+}
+
+// VoidPayment takes back payment n, counting from 1, from the terminal's
+// basket, or on a split bill from the first unpaid part that has payments.
+// Points and gift card redemptions go back to the customer and the card,
+// and once the last payment is voided the vouchers it claimed are released
+// and the basket can be changed again.
+func (s *Service) VoidPayment(terminal string, n int) (*Basket, error) {
+	if n < 1 {
+		return nil, ErrNoPayment
+	}
+	return s.voidPayments(terminal, n)
+}
+
+// CancelTender voids every payment taken on the terminal's basket, or on
+// every unpaid part of a split bill (see VoidPayment).
+func (s *Service) CancelTender(terminal string) (*Basket, error) {
+	return s.voidPayments(terminal, 0)
+}
+
+// voidPayments voids payment n, or all of them for 0.
+func (s *Service) voidPayments(terminal string, n int) (*Basket, error) {
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		targets := []*Basket{b}
+		if b.Split != nil {
+			targets = nil
+			for i := range b.Split.Parts {
+				if p := &b.Split.Parts[i]; !p.Settled && len(p.Basket.Payments) > 0 {
+					targets = append(targets, &p.Basket)
+				}
+			}
+		}
+		if n > 0 {
+			if len(targets) == 0 || n > len(targets[0].Payments) {
+				return ErrNoPayment
+			}
+			targets = targets[:1]
+		}
+		for _, t := range targets {
+			from, to := 0, len(t.Payments)
+			if n > 0 {
+				from, to = n-1, n
+			}
+			for i := to - 1; i >= from; i-- {
+				if err := s.voidPayment(terminal, t, i); err != nil {
+					return err
+				}
+			}
+			s.recalc(t)
+		}
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// voidPayment reverses payment i on b and takes it off.
+func (s *Service) voidPayment(terminal string, b *Basket, i int) error {
+	p := b.Payments[i]
+	if codes := appliedVouchers(b); len(b.Payments) == 1 && len(codes) > 0 && s.cfg.Vouchers != nil {
+		// the first payment claimed the vouchers
+		if err := s.cfg.Vouchers.Release(codes, terminal); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch p.Method {
+	case MethodPoints:
+		err = s.unredeemPoints(terminal, b, p.Points)
+	case MethodGiftCard:
+		err = s.unredeemGiftCard(terminal, p.Ref, p.AmountCents)
+	}
+	if err != nil {
+		return err
+	}
+	b.Payments = slices.Delete(slices.Clone(b.Payments), i, i+1)
+	b.Tip -= p.TipCents
+	b.Rounding = 0 // taken when cash settled the basket, which it no longer is
+	return nil
+}
@@ -0,0 +1,169 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/universaltill/universal-till/internal/common"
+)
+
+type failingJournal struct{ Journal }
+
+func (failingJournal) Record(*Sale) error { return errors.New("disk full") }
+
+func TestTenderWritesJournalWithSequentialReceipts(t *testing.T) {
+	j := newFixture(t).journal
+	s := NewService(Config{Journal: j})
+
+	for i, want := range []string{"T1-000001", "T1-000002"} {
+		_, _ = s.ScanQty("T1", "A", 2)
+		_, _ = s.Scan("T1", "B")
+		sale, err := s.Tender("T1", 0, "cash")
+		if err != nil {
+			t.Fatalf("Tender %d: %v", i, err)
+		}
+		if sale.ReceiptNo != want {
+			t.Fatalf("receipt = %q; want %q", sale.ReceiptNo, want)
+		}
+	}
+
+	got, err := j.Get("T1-000002")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got.Lines) != 2 || got.Lines[0].Qty != 2 || got.Total != 700 {
+		t.Fatalf("unexpected journalled sale: %+v", got)
+	}
+	if len(got.Payments) != 1 || got.Payments[0].Method != "cash" || got.Payments[0].AmountCents != 700 {
+		t.Fatalf("unexpected payments: %+v", got.Payments)
+	}
+
+	sales, err := s.Sales(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil || len(sales) != 2 {
+		t.Fatalf("Sales = %d, %v; want 2 sales", len(sales), err)
+	}
+}
+
+func TestTenderKeepsBasketWhenJournalFails(t *testing.T) {
+	s := NewService(Config{Journal: failingJournal{}})
+	_, _ = s.Scan("T1", "A")
+	if _, err := s.Tender("T1", 0, "card"); err == nil {
+		t.Fatalf("expected journal error")
+	}
+	if b := s.Basket("T1"); len(b.Lines) != 1 {
+		t.Fatalf("basket cleared after failed journal write: %+v", b)
+	}
+}
+
+func TestTenderRejectsEmptyBasket(t *testing.T) {
+	s := NewService(Config{})
+	if _, err := s.Tender("T1", 0, "cash"); err != ErrEmptyBasket {
+		t.Fatalf("err = %v; want ErrEmptyBasket", err)
+	}
+}
+
+func TestSplitTenderAndChange(t *testing.T) {
+	s := NewService(Config{Journal: newFixture(t).journal})
+	_, _ = s.ScanQty("T1", "A", 4) // 1000
+
+	sale, err := s.Tender("T1", 400, MethodCard)
+	if err != nil || sale != nil {
+		t.Fatalf("partial tender: sale=%v err=%v", sale, err)
+	}
+	if b := s.Basket("T1"); b.Paid != 400 || b.Due != 600 {
+		t.Fatalf("paid/due = %d/%d; want 400/600", b.Paid, b.Due)
+	}
+	if _, err := s.Scan("T1", "B"); err != ErrBasketLocked {
+		t.Fatalf("scan during tender: err = %v; want ErrBasketLocked", err)
+	}
+	if _, err := s.Tender("T1", 700, MethodCard); err != ErrOverpayment {
+		t.Fatalf("card overpay: err = %v; want ErrOverpayment", err)
+	}
+	sale, err = s.Tender("T1", 1000, MethodCash)
+	if err != nil || sale == nil {
+		t.Fatalf("final tender: sale=%v err=%v", sale, err)
+	}
+	if sale.Change != 400 || len(sale.Payments) != 2 {
+		t.Fatalf("change = %d, payments = %+v", sale.Change, sale.Payments)
+	}
+	if b := s.Basket("T1"); len(b.Lines) != 0 {
+		t.Fatalf("basket not cleared: %+v", b)
+	}
+}
+
+func TestVoidPaymentsAndCancelTender(t *testing.T) {
+	items := mapResolver{"TEA": {SKU: "TEA", Name: "Tea", Qty: 1, PriceCents: 1000}}
+	f := newFixture(t)
+	j, customers, ledger, cards, vouchers := f.journal, f.customers, f.loyalty, f.giftCards, f.vouchers
+	if err := vouchers.Save(Voucher{Code: "ONCE", MaxUses: 1, Discount: Promotion{Kind: PromoBasket, AmountCents: 100}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	c, _ := customers.Save(Customer{Name: "Sam", Card: "L1"})
+	s := NewServiceWithResolver(Config{Tax: PercentTaxEngine{RatePercent: 0}, Journal: j, Customers: customers,
+		Loyalty: ledger, GiftCards: cards, Vouchers: vouchers}, items)
+	if err := s.SetLoyaltyRules(common.LoyaltyRules{Enabled: true, PointsPerUnit: 10, PointValueCents: 1}); err != nil {
+		t.Fatalf("SetLoyaltyRules: %v", err)
+	}
+	if _, err := s.SellGiftCard("T1", "GC1234", 500); err != nil {
+		t.Fatalf("SellGiftCard: %v", err)
+	}
+	_, _ = s.Scan("T1", "L1")
+	_, _ = s.ScanQty("T1", "TEA", 5)
+	if _, err := s.Tender("T1", 0, MethodCard); err != nil {
+		t.Fatalf("earning tender: %v", err)
+	}
+	if st, _ := s.Loyalty(c.ID); st.Points != 500 {
+		t.Fatalf("points = %+v", st)
+	}
+
+	// a partly paid basket is locked until the payment is voided
+	_, _ = s.Scan("T2", "L1")
+	_, _ = s.ScanQty("T2", "TEA", 2)
+	_, _ = s.Scan("T2", "ONCE")
+	if _, err := s.Tender("T2", 300, MethodCard); err != nil {
+		t.Fatalf("card tender: %v", err)
+	}
+	if _, err := s.VoidLine("T2", 1); !errors.Is(err, ErrBasketLocked) {
+		t.Fatalf("void line while tendering err = %v", err)
+	}
+	if _, err := s.VoidPayment("T2", 2); !errors.Is(err, ErrNoPayment) {
+		t.Fatalf("void missing payment err = %v", err)
+	}
+	b, err := s.VoidPayment("T2", 1)
+	if err != nil || len(b.Payments) != 0 || b.Due != 1900 {
+		t.Fatalf("VoidPayment = %+v, %v", b, err)
+	}
+	if b, err = s.VoidLine("T2", 1); err != nil || len(b.Lines) != 0 {
+		t.Fatalf("void line after voiding payment = %+v, %v", b, err)
+	}
+	// the voucher was released, so another till can take it
+	_, _ = s.ScanQty("T3", "TEA", 2)
+	_, _ = s.Scan("T3", "ONCE")
+	if _, err := s.Tender("T3", 0, MethodCard); err != nil {
+		t.Fatalf("voucher after release: %v", err)
+	}
+
+	// cancelling gives back the points and what the gift card paid
+	_, _ = s.RemoveVoucher("T2", "ONCE")
+	_, _ = s.ScanQty("T2", "TEA", 2)
+	if _, err := s.Tender("T2", 200, MethodPoints); err != nil {
+		t.Fatalf("points tender: %v", err)
+	}
+	if _, err := s.TenderPayment("T2", Payment{Method: MethodGiftCard, AmountCents: 300, Ref: "GC1234"}); err != nil {
+		t.Fatalf("gift card tender: %v", err)
+	}
+	b, err = s.CancelTender("T2")
+	if err != nil || len(b.Payments) != 0 || b.Due != 2000 || b.Loyalty.Points != 500 {
+		t.Fatalf("CancelTender = %+v, %v", b, err)
+	}
+	if st, _ := s.Loyalty(c.ID); st.Points != 500 {
+		t.Fatalf("points after cancel = %+v", st)
+	}
+	if g, _ := s.GiftCard("GC1234"); g.BalanceCents != 500 {
+		t.Fatalf("card after cancel = %d", g.BalanceCents)
+	}
+	if b, err = s.CancelTender("T2"); err != nil || b.Due != 2000 {
+		t.Fatalf("cancel with nothing paid = %+v, %v", b, err)
+	}
+}
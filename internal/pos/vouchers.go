@@ -0,0 +1,141 @@
+package pos
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrVoucherNotFound = errors.New("voucher not found")
+	ErrVoucherExpired  = errors.New("voucher has expired")
+	ErrVoucherUsed     = errors.New("voucher has already been used")
+	ErrVoucherApplied  = errors.New("voucher is already in the basket")
+)
+
+// Voucher is a coupon or voucher code that discounts a basket. Discount
+// says what it takes off using the promotion rule kinds; its ID is ignored.
+type Voucher struct {
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Discount      Promotion `json:"discount"`
+	MaxUses       int       `json:"maxUses"` // 0 is unlimited, 1 single use
+	Uses          int       `json:"uses"`
+	MinSpendCents int64     `json:"minSpendCents,omitempty"`
+	Expires       time.Time `json:"expires"` // zero never expires
+}
+
+// Usable reports why v can't be redeemed at t, or nil.
+func (v Voucher) Usable(t time.Time) error {
+	if !v.Expires.IsZero() && !t.Before(v.Expires) {
+		return ErrVoucherExpired
+	}
+	if v.MaxUses > 0 && v.Uses >= v.MaxUses {
+		return ErrVoucherUsed
+	}
+	return nil
+}
+
+// promotion is the voucher's discount as a rule for ApplyPromotions.
+func (v Voucher) promotion() Promotion {
+	p := v.Discount
+	p.ID = "voucher:" + v.Code
+	p.Name = v.Name
+	if p.Name == "" {
+		p.Name = "Voucher " + v.Code
+	}
+	p.MinSpendCents = max(p.MinSpendCents, v.MinSpendCents)
+	p.From, p.Until = time.Time{}, time.Time{}
+	return p
+}
+
+// Vouchers looks up codes and records their use; see SQLiteVoucherStore.
+type Vouchers interface {
+	Lookup(code string) (Voucher, error)
+	// Redeem uses each code once for a sale on terminal, all or none,
+	// failing with ErrVoucherUsed if any has no uses left.
+	Redeem(codes []string, terminal string, at time.Time) error
+	// Release gives back the uses Redeem took on terminal when its tender
+	// is cancelled.
+	Release(codes []string, terminal string) error
+}
+
+// NormalizeVoucherCode trims and upper-cases a typed or scanned code.
+func NormalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// addVoucher puts a voucher code in the terminal's basket.
+func (s *Service) addVoucher(terminal string, v Voucher) (*Basket, error) {
+	if err := v.Usable(s.now()); err != nil {
+		return nil, err
+	}
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		if len(b.Lines) == 0 {
+			return ErrEmptyBasket
+		}
+		for _, c := range b.Vouchers {
+			if c.Code == v.Code {
+				return ErrVoucherApplied
+			}
+		}
+		b.Vouchers = append(b.Vouchers, v)
+		s.recalc(b)
+		out = b.clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveVoucher takes a voucher back out of the basket.
+func (s *Service) RemoveVoucher(terminal, code string) (*Basket, error) {
+	code = NormalizeVoucherCode(code)
+	var out Basket
+	err := s.baskets.With(terminal, func(b *Basket) error {
+		if err := b.locked(); err != nil {
+			return err
+		}
+		for i, v := range b.Vouchers {
+			if v.Code == code {
+				b.Vouchers = append(b.Vouchers[:i], b.Vouchers[i+1:]...)
+				s.recalc(b)
+				out = b.clone()
+				return nil
+			}
+		}
+		return ErrVoucherNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// appliedVouchers returns the codes of the basket's vouchers that take
+// something off it. Only these are claimed when tendering starts, so a
+// voucher below its minimum spend isn't used up for nothing.
+func appliedVouchers(b *Basket) []string {
+	var out []string
+	for _, v := range b.Vouchers {
+		if hasDiscount(b.Discounts, v.promotion().ID) {
+			out = append(out, v.Code)
+		}
+	}
+	return out
+}
+
+func hasDiscount(ds []Discount, promoID string) bool {
+	for _, d := range ds {
+		if d.PromoID == promoID && d.AmountCents != 0 {
+			return true
+		}
+	}
+	return false
+}
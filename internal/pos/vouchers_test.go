@@ -0,0 +1,65 @@
+package pos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVoucherSingleUseAcrossTills(t *testing.T) {
+	f := newFixture(t)
+	store := f.vouchers
+	once := Voucher{Code: "save1", Name: "£1 off", MaxUses: 1, MinSpendCents: 400, Discount: Promotion{Kind: PromoBasket, AmountCents: 100}}
+	if err := store.Save(once); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Save(Voucher{Code: "OLD", Expires: time.Now().Add(-time.Hour), Discount: Promotion{Kind: PromoPercent, Percent: 10}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	s := NewService(Config{Journal: f.journal, Vouchers: store})
+
+	if _, err := s.Scan("T1", "OLD"); err == nil {
+		t.Fatal("expired voucher accepted")
+	}
+	for _, till := range []string{"T1", "T2"} {
+		_, _ = s.Scan(till, "A")
+		b, err := s.Scan(till, " Save1 ")
+		if err != nil {
+			t.Fatalf("%s: scan voucher: %v", till, err)
+		}
+		if b.Discount != 0 || len(b.Vouchers) != 1 {
+			t.Fatalf("%s: voucher applied below min spend: %+v", till, b)
+		}
+		if b, _ = s.Scan(till, "B"); b.Discount != 100 || b.Total != 350 {
+			t.Fatalf("%s: discount=%d total=%d; want 100, 350", till, b.Discount, b.Total)
+		}
+	}
+	sale, err := s.Tender("T1", 0, MethodCard)
+	if err != nil || len(sale.Vouchers) != 1 || sale.Vouchers[0] != "SAVE1" {
+		t.Fatalf("T1 tender: %+v, %v", sale, err)
+	}
+	if _, err := s.Tender("T2", 0, MethodCard); !errors.Is(err, ErrVoucherUsed) {
+		t.Fatalf("T2 tender err = %v; want ErrVoucherUsed", err)
+	}
+	b, err := s.RemoveVoucher("T2", "SAVE1")
+	if err != nil || b.Total != 450 {
+		t.Fatalf("RemoveVoucher: %+v, %v", b, err)
+	}
+	if _, err := s.Tender("T2", 0, MethodCard); err != nil {
+		t.Fatalf("T2 tender without voucher: %v", err)
+	}
+
+	// a voucher short of its minimum spend rides along but isn't used up
+	if err := store.Save(Voucher{Code: "SAVE2", MaxUses: 1, MinSpendCents: 400, Discount: Promotion{Kind: PromoBasket, AmountCents: 100}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	_, _ = s.Scan("T3", "A")
+	_, _ = s.Scan("T3", "SAVE2")
+	sale, err = s.Tender("T3", 0, MethodCard)
+	if err != nil || sale.Discount != 0 || len(sale.Vouchers) != 0 {
+		t.Fatalf("below min spend tender = %+v, %v", sale, err)
+	}
+	if v, err := store.Lookup("SAVE2"); err != nil || v.Uses != 0 {
+		t.Fatalf("voucher after unqualified sale = %+v, %v", v, err)
+	}
+}
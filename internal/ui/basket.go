@@ -1,9 +1,15 @@
 package ui
 
 import (
+	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
 )
 
 type BasketView struct {
@@ -14,6 +20,8 @@ func NewBasketView(funcs template.FuncMap) (*BasketView, error) {
 	t := template.Must(template.New("base.html").Funcs(funcs).ParseFiles(
 		filepath.Join("web", "ui", "layouts", "base.html"),
 		filepath.Join("web", "ui", "partials", "basket.html"),
+		filepath.Join("web", "ui", "partials", "buttons.html"),
+		filepath.Join("web", "ui", "partials", "parked.html"),
 		filepath.Join("web", "ui", "partials", "nav.html"),
 	))
 	return &BasketView{Tpl: t}, nil
@@ -23,3 +31,431 @@ func (v *BasketView) Render(w http.ResponseWriter, basket any) error {
 	// Render only the "basket" template (fragment); we don’t need the full layout here.
 	return v.Tpl.ExecuteTemplate(w, "basket", basket)
 }
+
+// BasketVM is the view-model for the basket partial.
+type BasketVM struct {
+	*pos.Basket
+	Sale   *pos.Sale         // sale completed by this request, for the change-due banner
+	Parked *pos.ParkedBasket // basket parked by this request
+	Error  string
+	// NotFound is a code the scan didn't find; it can be sold through one
+	// of Departments or, with CatalogAdd, added to the catalog
+	NotFound    string
+	Departments []ButtonVM
+	CatalogAdd  bool
+	PriceFor    string // open-price code waiting for a keyed price
+	// OptionsFor is an item waiting on its options to be chosen
+	OptionsFor *ButtonVM
+}
+
+var (
+	// ErrCatalogAdd is returned when the till isn't allowed to add items.
+	ErrCatalogAdd = errors.New("adding items at the till is turned off in settings")
+	// ErrInCatalog stops the till replacing an item that already exists.
+	ErrInCatalog = errors.New("that code is already in the catalog")
+)
+
+/* ----------------- Basket actions (htmx-friendly) ----------------- */
+
+// BasketHTTP acts on the calling terminal's basket and re-renders it.
+// Rejected actions re-render the basket with the error so htmx still swaps.
+type BasketHTTP struct {
+	POS      *pos.Service
+	View     *BasketView
+	Terminal string
+	// Catalog takes items added at the till; nil when that isn't allowed
+	Catalog ButtonStore
+}
+
+func (h *BasketHTTP) Void(w http.ResponseWriter, r *http.Request) {
+	h.edit(w, r, func(line int) (*pos.Basket, error) {
+		return h.POS.VoidLine(h.Terminal, line)
+	})
+}
+
+func (h *BasketHTTP) SetQty(w http.ResponseWriter, r *http.Request) {
+	h.edit(w, r, func(line int) (*pos.Basket, error) {
+		qty, err := strconv.ParseFloat(r.Form.Get("qty"), 64)
+		if err != nil {
+			return nil, pos.ErrInvalidQty
+		}
+		return h.POS.SetLineQty(h.Terminal, line, qty)
+	})
+}
+
+func (h *BasketHTTP) OverridePrice(w http.ResponseWriter, r *http.Request) {
+	h.edit(w, r, func(line int) (*pos.Basket, error) {
+		price, err := strconv.ParseInt(r.Form.Get("priceCents"), 10, 64)
+		if err != nil {
+			return nil, pos.ErrInvalidPrice
+		}
+		return h.POS.OverridePrice(h.Terminal, line, price, r.Form.Get("reason"))
+	})
+}
+
+func (h *BasketHTTP) SetNote(w http.ResponseWriter, r *http.Request) {
+	h.edit(w, r, func(line int) (*pos.Basket, error) {
+		return h.POS.SetLineNote(h.Terminal, line, r.Form.Get("note"))
+	})
+}
+
+// SetSeat puts the line on form field "seat"; 0 shares it.
+func (h *BasketHTTP) SetSeat(w http.ResponseWriter, r *http.Request) {
+	h.edit(w, r, func(line int) (*pos.Basket, error) {
+		seat, err := strconv.Atoi(strings.TrimSpace(r.Form.Get("seat")))
+		if err != nil {
+			return nil, pos.ErrSeat
+		}
+		return h.POS.SetLineSeat(h.Terminal, line, seat)
+	})
+}
+
+// Split splits the bill by form field "by": "even" into "parts" parts,
+// "seat", or "line" with each line's part in field "line-<lineNo>".
+func (h *BasketHTTP) Split(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	var b *pos.Basket
+	var err error
+	switch r.Form.Get("by") {
+	case "seat":
+		b, err = h.POS.SplitBySeat(h.Terminal)
+	case "line":
+		parts := map[int]int{}
+		for k, v := range r.Form {
+			if no, ok := strings.CutPrefix(k, "line-"); ok && len(v) > 0 {
+				line, _ := strconv.Atoi(no)
+				parts[line], _ = strconv.Atoi(strings.TrimSpace(v[0]))
+			}
+		}
+		b, err = h.POS.SplitByLines(h.Terminal, parts)
+	default:
+		n, _ := strconv.Atoi(strings.TrimSpace(r.Form.Get("parts")))
+		b, err = h.POS.SplitEvenly(h.Terminal, n)
+	}
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// Unsplit puts a split bill back together.
+func (h *BasketHTTP) Unsplit(w http.ResponseWriter, r *http.Request) {
+	b, err := h.POS.Unsplit(h.Terminal)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// AddWithModifiers adds the item in form field "code" made with the
+// choices from its options form (see modifierPicks), and "qty".
+func (h *BasketHTTP) AddWithModifiers(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	qty, _ := strconv.ParseFloat(strings.TrimSpace(r.Form.Get("qty")), 64)
+	b, err := h.POS.ScanWithModifiers(h.Terminal, r.Form.Get("code"), qty, modifierPicks(r.Form))
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// SetModifiers changes the choices made for the line.
+func (h *BasketHTTP) SetModifiers(w http.ResponseWriter, r *http.Request) {
+	h.edit(w, r, func(line int) (*pos.Basket, error) {
+		return h.POS.SetLineModifiers(h.Terminal, line, modifierPicks(r.Form))
+	})
+}
+
+// RemoveVoucher takes the voucher in form field "code" out of the basket.
+func (h *BasketHTTP) RemoveVoucher(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	b, err := h.POS.RemoveVoucher(h.Terminal, r.Form.Get("code"))
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// ConfirmAge answers the waiting age check from form fields "looksOver",
+// "dob" (YYYY-MM-DD) or "refused".
+func (h *BasketHTTP) ConfirmAge(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	d := pos.AgeDecision{DOB: strings.TrimSpace(r.Form.Get("dob")), Refused: r.Form.Get("refused") == "true"}
+	d.LooksOver, _ = strconv.Atoi(r.Form.Get("looksOver"))
+	b, err := h.POS.ConfirmAge(h.Terminal, d)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// AttachCustomer puts the customer in form field "id" on the basket.
+func (h *BasketHTTP) AttachCustomer(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	id, err := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	if err != nil {
+		h.renderError(w, pos.ErrCustomerNotFound)
+		return
+	}
+	b, err := h.POS.AttachCustomer(h.Terminal, id)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+func (h *BasketHTTP) DetachCustomer(w http.ResponseWriter, r *http.Request) {
+	b, err := h.POS.DetachCustomer(h.Terminal)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// ServiceCharge sets the basket's service charge to form field "percent";
+// blank uses the default and 0 removes it.
+func (h *BasketHTTP) ServiceCharge(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	percent := -1.0
+	if v := strings.TrimSpace(r.Form.Get("percent")); v != "" {
+		var err error
+		if percent, err = strconv.ParseFloat(v, 64); err != nil || percent < 0 {
+			h.renderError(w, pos.ErrServiceCharge)
+			return
+		}
+	}
+	b, err := h.POS.SetServiceCharge(h.Terminal, percent)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// Operator sets who is serving the basket from form field "operator".
+func (h *BasketHTTP) Operator(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	b, err := h.POS.SetOperator(h.Terminal, r.Form.Get("operator"))
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// SellGiftCard adds a gift card to the basket; form fields "number" and
+// "amount" (cents).
+func (h *BasketHTTP) SellGiftCard(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	amount, _ := strconv.ParseInt(strings.TrimSpace(r.Form.Get("amount")), 10, 64)
+	b, err := h.POS.SellGiftCard(h.Terminal, r.Form.Get("number"), amount)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// KeyPrice sells the department key or open-price item in form field
+// "code" at "priceCents"; "qty" defaults to 1 and "note" is kept on the
+// line.
+func (h *BasketHTTP) KeyPrice(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	price, err := strconv.ParseInt(strings.TrimSpace(r.Form.Get("priceCents")), 10, 64)
+	if err != nil {
+		h.renderError(w, pos.ErrPriceNeeded)
+		return
+	}
+	qty, _ := strconv.ParseFloat(strings.TrimSpace(r.Form.Get("qty")), 64)
+	b, err := h.POS.KeyPrice(h.Terminal, r.Form.Get("code"), price, qty, r.Form.Get("note"))
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// AddToCatalog adds the item in form fields "code", "label",
+// "priceCents", "taxClass" and "category" to the catalog and scans it.
+// Items already in the catalog are changed in the designer, not here.
+func (h *BasketHTTP) AddToCatalog(w http.ResponseWriter, r *http.Request) {
+	if h.Catalog == nil {
+		h.renderError(w, ErrCatalogAdd)
+		return
+	}
+	_ = r.ParseForm()
+	price, err := strconv.ParseInt(strings.TrimSpace(r.Form.Get("priceCents")), 10, 64)
+	if err != nil || price < 0 {
+		h.renderError(w, pos.ErrInvalidPrice)
+		return
+	}
+	code := strings.TrimSpace(r.Form.Get("code"))
+	list, err := h.Catalog.Load()
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	for _, b := range list {
+		if strings.EqualFold(b.Code, code) {
+			h.renderError(w, ErrInCatalog)
+			return
+		}
+	}
+	err = h.Catalog.Add(Button{
+		Label:      r.Form.Get("label"),
+		Code:       code,
+		PriceCents: price,
+		TaxClass:   strings.TrimSpace(r.Form.Get("taxClass")),
+		Category:   strings.TrimSpace(r.Form.Get("category")),
+	})
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	b, err := h.POS.Scan(h.Terminal, code)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// Park sets the basket aside under form field "label" and tells the
+// parked list to refresh.
+func (h *BasketHTTP) Park(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	p, err := h.POS.Park(h.Terminal, r.Form.Get("label"))
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "parked")
+	_ = h.View.Render(w, BasketVM{Basket: h.POS.Basket(h.Terminal), Parked: p})
+}
+
+// Recall brings back the parked basket in form field "id".
+func (h *BasketHTTP) Recall(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	id, err := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	if err != nil {
+		h.renderError(w, pos.ErrParkedNotFound)
+		return
+	}
+	b, err := h.POS.Recall(h.Terminal, id)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "parked")
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// Parked renders the list of parked baskets.
+func (h *BasketHTTP) Parked(w http.ResponseWriter, r *http.Request) {
+	list, err := h.POS.Parked()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = h.View.Tpl.ExecuteTemplate(w, "parked", list)
+}
+
+func (h *BasketHTTP) edit(w http.ResponseWriter, r *http.Request, fn func(line int) (*pos.Basket, error)) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	line, err := strconv.Atoi(r.Form.Get("line"))
+	if err != nil {
+		http.Error(w, "line is required", http.StatusBadRequest)
+		return
+	}
+	b, err := fn(line)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// Tender takes a payment; JSON or form fields "amount" (cents, blank pays
+// the balance), "method", "ref" (the gift card number), "currency" for
+// foreign cash, when the amount is in that currency, and "tip" (cents) or
+// "tipPercent" for card tips. On a split bill "part" picks the part to
+// pay; without it the next unpaid part is paid.
+func (h *BasketHTTP) Tender(w http.ResponseWriter, r *http.Request) {
+	type In struct {
+		Amount     int64   `json:"amount"`
+		Method     string  `json:"method"`
+		Ref        string  `json:"ref"`
+		Currency   string  `json:"currency"`
+		Tip        int64   `json:"tip"`
+		TipPercent float64 `json:"tipPercent"`
+		Part       int     `json:"part"`
+	}
+	var in In
+	if r.Header.Get("Content-Type") == "application/json" {
+		_ = json.NewDecoder(r.Body).Decode(&in)
+	} else {
+		_ = r.ParseForm()
+		in.Method = r.Form.Get("method")
+		in.Ref = r.Form.Get("ref")
+		in.Currency = r.Form.Get("currency")
+		in.Tip, _ = strconv.ParseInt(strings.TrimSpace(r.Form.Get("tip")), 10, 64)
+		in.TipPercent, _ = strconv.ParseFloat(strings.TrimSpace(r.Form.Get("tipPercent")), 64)
+		in.Amount, _ = strconv.ParseInt(strings.TrimSpace(r.Form.Get("amount")), 10, 64)
+		in.Part, _ = strconv.Atoi(strings.TrimSpace(r.Form.Get("part")))
+	}
+	if in.Tip == 0 && in.TipPercent > 0 {
+		in.Tip = h.POS.TipFor(h.Terminal, in.TipPercent)
+	}
+	p := pos.Payment{Method: in.Method, AmountCents: in.Amount, Ref: in.Ref, TipCents: in.Tip}
+	if in.Currency != "" {
+		p.Currency, p.ForeignCents, p.AmountCents = in.Currency, in.Amount, 0
+	}
+	sale, err := h.POS.TenderPart(h.Terminal, in.Part, p)
+	if err != nil && sale == nil {
+		h.renderError(w, err)
+		return
+	}
+	vm := BasketVM{Basket: h.POS.Basket(h.Terminal), Sale: sale}
+	if err != nil {
+		// the sale went through but its points or gift cards weren't
+		// posted yet; the journal keeps them and they are retried
+		vm.Error = err.Error()
+	}
+	_ = h.View.Render(w, vm)
+}
+
+// VoidPayment takes back the payment numbered in form field "n", from 1.
+func (h *BasketHTTP) VoidPayment(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	n, _ := strconv.Atoi(strings.TrimSpace(r.Form.Get("n")))
+	b, err := h.POS.VoidPayment(h.Terminal, n)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+// CancelTender takes back every payment so the basket can be changed.
+func (h *BasketHTTP) CancelTender(w http.ResponseWriter, r *http.Request) {
+	b, err := h.POS.CancelTender(h.Terminal)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+	_ = h.View.Render(w, BasketVM{Basket: b})
+}
+
+func (h *BasketHTTP) renderError(w http.ResponseWriter, err error) {
+	_ = h.View.Render(w, BasketVM{Basket: h.POS.Basket(h.Terminal), Error: err.Error()})
+}
@@ -19,31 +19,72 @@ type Button struct {
 	Code       string `json:"code"`
 	PriceCents int64  `json:"priceCents"`
 	ImageURL   string `json:"imageUrl,omitempty"`
+	TaxClass   string `json:"taxClass,omitempty"` // empty is standard rated
+	Category   string `json:"category,omitempty"`
+	MinAge     int    `json:"minAge,omitempty"` // age check at the till; 0 for none
+	// Department keys are sold at a price keyed in at the till; PriceCents
+	// is ignored
+	Department bool `json:"department,omitempty"`
+	// Options are the choices the item is made with, see ParseOptions
+	Options []pos.OptionGroup `json:"options,omitempty"`
 }
 
 // ButtonVM is the view-model passed to the template
 type ButtonVM struct {
-	Label      string `json:"label"`
-	Code       string `json:"code"`
-	PriceCents int64  `json:"priceCents"`
-	Price      string `json:"price"` // Pre-formatted string (e.g. "2.50")
-	ImageURL   string `json:"imageUrl,omitempty"`
+	Label       string            `json:"label"`
+	Code        string            `json:"code"`
+	PriceCents  int64             `json:"priceCents"`
+	Price       string            `json:"price"` // Pre-formatted string (e.g. "2.50")
+	ImageURL    string            `json:"imageUrl,omitempty"`
+	TaxClass    string            `json:"taxClass,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	MinAge      int               `json:"minAge,omitempty"`
+	Department  bool              `json:"department,omitempty"`
+	Options     []pos.OptionGroup `json:"options,omitempty"`
+	OptionsText string            `json:"-"` // Options as the designer edits them
 }
 
 func ToVM(b []Button) []ButtonVM {
 	out := make([]ButtonVM, 0, len(b))
 	for _, x := range b {
 		out = append(out, ButtonVM{
-			Label:      x.Label,
-			Code:       x.Code,
-			PriceCents: x.PriceCents,
-			Price:      fmt.Sprintf("%.2f", float64(x.PriceCents)/100.0),
-			ImageURL:   x.ImageURL,
+			Label:       x.Label,
+			Code:        x.Code,
+			PriceCents:  x.PriceCents,
+			Price:       fmt.Sprintf("%.2f", float64(x.PriceCents)/100.0),
+			ImageURL:    x.ImageURL,
+			TaxClass:    x.TaxClass,
+			Category:    x.Category,
+			MinAge:      x.MinAge,
+			Department:  x.Department,
+			Options:     x.Options,
+			OptionsText: FormatOptions(x.Options),
 		})
 	}
 	return out
 }
 
+// Departments returns the department keys in b.
+func Departments(b []Button) []ButtonVM {
+	var out []Button
+	for _, x := range b {
+		if x.Department {
+			out = append(out, x)
+		}
+	}
+	return ToVM(out)
+}
+
+// FindButton returns the button for code, ignoring case.
+func FindButton(b []Button, code string) (ButtonVM, bool) {
+	for _, x := range b {
+		if strings.EqualFold(x.Code, strings.TrimSpace(code)) {
+			return ToVM([]Button{x})[0], true
+		}
+	}
+	return ButtonVM{}, false
+}
+
 // ButtonStore defines persistence for quick buttons.
 type ButtonStore interface {
 	Load() ([]Button, error)
@@ -186,16 +227,28 @@ func (h *ButtonsHTTP) Add(w http.ResponseWriter, r *http.Request) {
 	}
 	price := int64(0)
 	fmt.Sscan(r.Form.Get("priceCents"), &price)
+	minAge := 0
+	fmt.Sscan(r.Form.Get("minAge"), &minAge)
 	img := strings.TrimSpace(r.Form.Get("imageUrl"))
 	if img != "" && !strings.HasPrefix(img, "http://") && !strings.HasPrefix(img, "https://") && !strings.HasPrefix(img, "/public/") {
 		// Treat as filename in local images folder
 		img = "/public/images/" + img
 	}
-	err := h.Store.Add(Button{
+	options, err := ParseOptions(r.Form.Get("options"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.Store.Add(Button{
 		Label:      r.Form.Get("label"),
 		Code:       r.Form.Get("code"),
 		PriceCents: price,
 		ImageURL:   img,
+		TaxClass:   strings.TrimSpace(r.Form.Get("taxClass")),
+		Category:   strings.TrimSpace(r.Form.Get("category")),
+		MinAge:     max(minAge, 0),
+		Department: r.Form.Get("department") == "on",
+		Options:    options,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -232,7 +285,7 @@ func (a PriceResolverAdapter) Resolve(code string) (pos.BasketLine, bool) {
 	}
 	for _, b := range list {
 		if strings.EqualFold(b.Code, code) {
-			return pos.BasketLine{SKU: b.Code, Name: b.Label, Qty: 1, PriceCents: b.PriceCents, ImageURL: b.ImageURL}, true
+			return pos.BasketLine{SKU: b.Code, Name: b.Label, Qty: 1, PriceCents: b.PriceCents, ImageURL: b.ImageURL, TaxClass: b.TaxClass, Category: b.Category, MinAge: b.MinAge, OpenPrice: b.Department, Options: b.Options}, true
 		}
 	}
 	return pos.BasketLine{}, false
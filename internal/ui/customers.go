@@ -0,0 +1,165 @@
+package ui
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
+)
+
+/* ----------------- Customers (htmx-friendly) ----------------- */
+
+// customerSearchLimit caps search results; more specific terms narrow them.
+const customerSearchLimit = 50
+
+var ErrCustomerPrices = errors.New("customer prices are one SKU=cents per line")
+
+// CustomersHTTP searches, creates and edits customer records and shows
+// their purchase history. It renders the "customers" partial, and
+// "customer_pick" for the till's attach picker.
+type CustomersHTTP struct {
+	Store *pos.SQLiteCustomerStore
+	POS   *pos.Service
+	View  TplRenderer
+}
+
+// List searches by query parameter "q" and opens the record in "id", if
+// any, for editing.
+func (h *CustomersHTTP) List(w http.ResponseWriter, r *http.Request) {
+	var edit *pos.Customer
+	if id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64); err == nil {
+		c, err := h.Store.Lookup(id)
+		if err != nil {
+			h.render(w, r, nil, err)
+			return
+		}
+		edit = &c
+	}
+	h.render(w, r, edit, nil)
+}
+
+// Save adds or updates a customer from form fields "id" (blank for new),
+// "name", "email", "phone", "card", "taxExempt", "exemptRef", "notes" and
+// "prices" (one SKU=cents per line).
+func (h *CustomersHTTP) Save(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	c := pos.Customer{
+		Name:      r.Form.Get("name"),
+		Email:     strings.TrimSpace(r.Form.Get("email")),
+		Phone:     strings.TrimSpace(r.Form.Get("phone")),
+		Card:      r.Form.Get("card"),
+		TaxExempt: r.Form.Get("taxExempt") != "",
+		ExemptRef: strings.TrimSpace(r.Form.Get("exemptRef")),
+		Notes:     strings.TrimSpace(r.Form.Get("notes")),
+	}
+	c.ID, _ = strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	prices, err := parseCustomerPrices(r.Form.Get("prices"))
+	if err != nil {
+		h.render(w, r, &c, err)
+		return
+	}
+	c.Prices = prices
+	saved, err := h.Store.Save(c)
+	if err != nil {
+		h.render(w, r, &c, err)
+		return
+	}
+	h.render(w, r, &saved, nil)
+}
+
+// History renders the sales and refunds of the customer in "id", with
+// their loyalty points and ledger.
+func (h *CustomersHTTP) History(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	c, err := h.Store.Lookup(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sales, err := h.POS.CustomerHistory(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var spent int64
+	for _, s := range sales {
+		spent += s.Total
+	}
+	loyalty, err := h.POS.Loyalty(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	points, err := h.POS.LoyaltyStatement(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = h.View.Render(w, "customer_history", map[string]any{"Customer": c, "Sales": sales, "Spent": spent,
+		"Loyalty": loyalty, "Points": points})
+}
+
+// Pick renders search results for "q" with buttons that attach the
+// customer to the basket.
+func (h *CustomersHTTP) Pick(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	var list []pos.Customer
+	if q != "" {
+		var err error
+		if list, err = h.Store.Search(q, 10); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	_ = h.View.Render(w, "customer_pick", map[string]any{"Query": q, "Customers": list})
+}
+
+func (h *CustomersHTTP) render(w http.ResponseWriter, r *http.Request, edit *pos.Customer, err error) {
+	q := r.URL.Query().Get("q")
+	list, lerr := h.Store.Search(q, customerSearchLimit)
+	if err == nil {
+		err = lerr
+	}
+	data := map[string]any{"Query": q, "Customers": list, "Edit": edit, "Prices": ""}
+	if edit != nil {
+		data["Prices"] = formatCustomerPrices(edit.Prices)
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	_ = h.View.Render(w, "customers", data)
+}
+
+// parseCustomerPrices reads "SKU=cents" lines; blank lines are skipped.
+func parseCustomerPrices(s string) (map[string]int64, error) {
+	out := map[string]int64{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sku, cents, ok := strings.Cut(line, "=")
+		n, err := strconv.ParseInt(strings.TrimSpace(cents), 10, 64)
+		if !ok || strings.TrimSpace(sku) == "" || err != nil {
+			return nil, ErrCustomerPrices
+		}
+		out[strings.TrimSpace(sku)] = n
+	}
+	return out, nil
+}
+
+func formatCustomerPrices(prices map[string]int64) string {
+	skus := make([]string, 0, len(prices))
+	for sku := range prices {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+	var b strings.Builder
+	for _, sku := range skus {
+		b.WriteString(sku + "=" + strconv.FormatInt(prices[sku], 10) + "\n")
+	}
+	return b.String()
+}
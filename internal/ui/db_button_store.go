@@ -2,9 +2,12 @@ package ui
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"strings"
 
+	"github.com/universaltill/universal-till/internal/common"
+	"github.com/universaltill/universal-till/internal/pos"
 	_ "modernc.org/sqlite"
 )
 
@@ -24,11 +27,23 @@ func NewSQLiteButtonStore(path string) (*SQLiteButtonStore, error) {
 	);`); err != nil {
 		return nil, err
 	}
+	if err := common.AddColumns(db, buttonColumns); err != nil {
+		return nil, err
+	}
 	return &SQLiteButtonStore{db: db}, nil
 }
 
+// buttonColumns were added after the table first shipped.
+var buttonColumns = []common.Column{
+	{Table: "buttons", Name: "tax_class", Def: "TEXT"},
+	{Table: "buttons", Name: "category", Def: "TEXT"},
+	{Table: "buttons", Name: "min_age", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "buttons", Name: "department", Def: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "buttons", Name: "options", Def: "TEXT"},
+}
+
 func (s *SQLiteButtonStore) Load() ([]Button, error) {
-	rows, err := s.db.Query(`SELECT label, code, price_cents, image_url FROM buttons ORDER BY label`)
+	rows, err := s.db.Query(`SELECT label, code, price_cents, image_url, tax_class, category, min_age, department, options FROM buttons ORDER BY label`)
 	if err != nil {
 		return nil, err
 	}
@@ -36,13 +51,19 @@ func (s *SQLiteButtonStore) Load() ([]Button, error) {
 	var out []Button
 	for rows.Next() {
 		var b Button
-		var img sql.NullString
-		if err := rows.Scan(&b.Label, &b.Code, &b.PriceCents, &img); err != nil {
+		var img, class, category, options sql.NullString
+		if err := rows.Scan(&b.Label, &b.Code, &b.PriceCents, &img, &class, &category, &b.MinAge, &b.Department, &options); err != nil {
 			return nil, err
 		}
+		if options.String != "" {
+			if err := json.Unmarshal([]byte(options.String), &b.Options); err != nil {
+				return nil, err
+			}
+		}
 		if img.Valid {
 			b.ImageURL = img.String
 		}
+		b.TaxClass, b.Category = class.String, category.String
 		out = append(out, b)
 	}
 	return out, rows.Err()
@@ -58,14 +79,14 @@ func (s *SQLiteButtonStore) Save(list []Button) error {
 		tx.Rollback()
 		return err
 	}
-	stmt, err := tx.Prepare(`INSERT INTO buttons(code,label,price_cents,image_url) VALUES(?,?,?,?)`)
+	stmt, err := tx.Prepare(`INSERT INTO buttons(code,label,price_cents,image_url,tax_class,category,min_age,department,options) VALUES(?,?,?,?,?,?,?,?,?)`)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 	for _, b := range list {
-		if _, err := stmt.Exec(b.Code, b.Label, b.PriceCents, nullIfEmpty(b.ImageURL)); err != nil {
+		if _, err := stmt.Exec(b.Code, b.Label, b.PriceCents, nullIfEmpty(b.ImageURL), nullIfEmpty(b.TaxClass), nullIfEmpty(b.Category), b.MinAge, b.Department, optionsJSON(b.Options)); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -79,9 +100,11 @@ func (s *SQLiteButtonStore) Add(btn Button) error {
 	if btn.Label == "" || btn.Code == "" {
 		return errors.New("label and code are required")
 	}
-	_, err := s.db.Exec(`INSERT INTO buttons(code,label,price_cents,image_url) VALUES(?,?,?,?)
-	ON CONFLICT(code) DO UPDATE SET label=excluded.label, price_cents=excluded.price_cents, image_url=excluded.image_url`,
-		btn.Code, btn.Label, btn.PriceCents, nullIfEmpty(btn.ImageURL))
+	_, err := s.db.Exec(`INSERT INTO buttons(code,label,price_cents,image_url,tax_class,category,min_age,department,options) VALUES(?,?,?,?,?,?,?,?,?)
+	ON CONFLICT(code) DO UPDATE SET label=excluded.label, price_cents=excluded.price_cents, image_url=excluded.image_url,
+	  tax_class=excluded.tax_class, category=excluded.category, min_age=excluded.min_age, department=excluded.department,
+	  options=excluded.options`,
+		btn.Code, btn.Label, btn.PriceCents, nullIfEmpty(btn.ImageURL), nullIfEmpty(btn.TaxClass), nullIfEmpty(btn.Category), btn.MinAge, btn.Department, optionsJSON(btn.Options))
 	return err
 }
 
@@ -90,6 +113,14 @@ func (s *SQLiteButtonStore) Remove(code string) error {
 	return err
 }
 
+func optionsJSON(groups []pos.OptionGroup) any {
+	if len(groups) == 0 {
+		return nil
+	}
+	raw, _ := json.Marshal(groups)
+	return string(raw)
+}
+
 func nullIfEmpty(s string) any {
 	if strings.TrimSpace(s) == "" {
 		return nil
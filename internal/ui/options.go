@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
+)
+
+// ParseOptions reads option groups as the designer writes them, one group
+// a line: "Milk [1-1]: Whole, Oat +30, Soy +30". The brackets give the
+// least and most choices ("[1]" for exactly one, none for any number, all
+// optional) and a signed number after a choice is its price in cents.
+func ParseOptions(text string) ([]pos.OptionGroup, error) {
+	var out []pos.OptionGroup
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		head, list, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q has no choices", pos.ErrOptionGroup, line)
+		}
+		g := pos.OptionGroup{Name: strings.TrimSpace(head)}
+		if name, rng, ok := strings.Cut(g.Name, "["); ok {
+			rng = strings.TrimSuffix(strings.TrimSpace(rng), "]")
+			lo, hi, isRange := strings.Cut(rng, "-")
+			var err1, err2 error
+			g.Min, err1 = strconv.Atoi(strings.TrimSpace(lo))
+			g.Max = g.Min
+			if isRange {
+				g.Max, err2 = strconv.Atoi(strings.TrimSpace(hi))
+			}
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("%w: %q", pos.ErrOptionGroup, line)
+			}
+			g.Name = strings.TrimSpace(name)
+		}
+		for _, c := range strings.Split(list, ",") {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+			opt := pos.Option{Name: c}
+			if i := strings.LastIndexAny(c, "+-"); i > 0 && c[i-1] == ' ' {
+				if cents, err := strconv.ParseInt(c[i:], 10, 64); err == nil {
+					opt = pos.Option{Name: strings.TrimSpace(c[:i]), PriceCents: cents}
+				}
+			}
+			g.Choices = append(g.Choices, opt)
+		}
+		out = append(out, g)
+	}
+	return out, pos.ValidateOptions(out)
+}
+
+// FormatOptions writes option groups the way ParseOptions reads them.
+func FormatOptions(groups []pos.OptionGroup) string {
+	lines := make([]string, 0, len(groups))
+	for _, g := range groups {
+		var b strings.Builder
+		b.WriteString(g.Name)
+		switch {
+		case g.Min == 0 && g.Max == 0:
+		case g.Min == g.Max:
+			fmt.Fprintf(&b, " [%d]", g.Min)
+		default:
+			fmt.Fprintf(&b, " [%d-%d]", g.Min, g.Max)
+		}
+		b.WriteString(":")
+		for i, c := range g.Choices {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(" " + c.Name)
+			if c.PriceCents != 0 {
+				fmt.Fprintf(&b, " %+d", c.PriceCents)
+			}
+		}
+		lines = append(lines, b.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// modifierPicks reads the choices from an options form: field "group-N"
+// names each group and "opt-N" carries the choices made in it.
+func modifierPicks(form url.Values) []pos.Modifier {
+	var out []pos.Modifier
+	for i := 0; form.Has("group-" + strconv.Itoa(i)); i++ {
+		group := form.Get("group-" + strconv.Itoa(i))
+		for _, name := range form["opt-"+strconv.Itoa(i)] {
+			out = append(out, pos.Modifier{Group: group, Name: name})
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
+)
+
+/* ----------------- Promotions (JSON) ----------------- */
+
+type PromotionsHTTP struct {
+	Store *pos.SQLitePromotionStore
+	POS   *pos.Service
+}
+
+func (h *PromotionsHTTP) List(w http.ResponseWriter, r *http.Request) {
+	list := h.Store.List()
+	if list == nil {
+		list = []pos.Promotion{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Save adds or replaces a rule from a JSON pos.Promotion body.
+func (h *PromotionsHTTP) Save(w http.ResponseWriter, r *http.Request) {
+	var p pos.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := h.Store.Save(p); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	h.POS.Reprice()
+	writeJSON(w, http.StatusOK, p)
+}
+
+// Delete removes the rule named by ?id=.
+func (h *PromotionsHTTP) Delete(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": pos.ErrPromoID.Error()})
+		return
+	}
+	if err := h.Store.Delete(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	h.POS.Reprice()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/* ----------------- Vouchers (JSON) ----------------- */
+
+type VouchersHTTP struct {
+	Store *pos.SQLiteVoucherStore
+}
+
+func (h *VouchersHTTP) List(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = []pos.Voucher{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Save adds or updates a voucher from a JSON pos.Voucher body.
+func (h *VouchersHTTP) Save(w http.ResponseWriter, r *http.Request) {
+	var v pos.Voucher
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := h.Store.Save(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	saved, err := h.Store.Lookup(v.Code)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
+)
+
+/* ----------------- Exchange rates (JSON) ----------------- */
+
+type RatesHTTP struct {
+	Store *pos.SQLiteRateStore
+}
+
+func (h *RatesHTTP) List(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = []pos.ExchangeRate{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Save adds or replaces a rate from a JSON pos.ExchangeRate body; a
+// non-zero "override" pins the rate tenders use until it is saved as 0.
+func (h *RatesHTTP) Save(w http.ResponseWriter, r *http.Request) {
+	var x pos.ExchangeRate
+	if err := json.NewDecoder(r.Body).Decode(&x); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := h.Store.Save(x); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	x, err := h.Store.Get(pos.NormalizeCurrency(x.Currency))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, x)
+}
+
+// Delete removes the rate named by ?currency=.
+func (h *RatesHTTP) Delete(w http.ResponseWriter, r *http.Request) {
+	cur := strings.TrimSpace(r.URL.Query().Get("currency"))
+	if cur == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": pos.ErrRateCurrency.Error()})
+		return
+	}
+	if err := h.Store.Delete(cur); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
+)
+
+/* ----------------- Refunds (htmx-friendly) ----------------- */
+
+type RefundHTTP struct {
+	POS      *pos.Service
+	View     TplRenderer
+	Terminal string
+}
+
+// Lookup renders the returnable lines of ?receipt=.
+func (h *RefundHTTP) Lookup(w http.ResponseWriter, r *http.Request) {
+	receipt := strings.TrimSpace(r.URL.Query().Get("receipt"))
+	sale, lines, err := h.POS.Refundable(receipt)
+	data := map[string]any{"Receipt": receipt, "Sale": sale, "Lines": lines}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	_ = h.View.Render(w, "refund_lookup", data)
+}
+
+// Refund issues a refund. JSON bodies get a JSON reply; forms carry
+// "receipt", "qty_<line>", "restock_<line>", "storeCredit" and "reason".
+func (h *RefundHTTP) Refund(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") == "application/json" {
+		var req pos.RefundRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		sale, err := h.POS.Refund(h.Terminal, req)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil && sale == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(sale)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := pos.RefundRequest{
+		ReceiptNo:   r.Form.Get("receipt"),
+		StoreCredit: r.Form.Get("storeCredit") == "on",
+		Reason:      r.Form.Get("reason"),
+	}
+	for k, v := range r.Form {
+		if !strings.HasPrefix(k, "qty_") {
+			continue
+		}
+		line, err := strconv.Atoi(strings.TrimPrefix(k, "qty_"))
+		if err != nil {
+			continue
+		}
+		qty, _ := strconv.ParseFloat(v[0], 64)
+		if qty > 0 {
+			req.Lines = append(req.Lines, pos.RefundLine{LineNo: line, Qty: qty, Restock: r.Form.Get("restock_"+strconv.Itoa(line)) == "on"})
+		}
+	}
+	sort.Slice(req.Lines, func(i, j int) bool { return req.Lines[i].LineNo < req.Lines[j].LineNo })
+	if len(req.Lines) == 0 {
+		// an all-zero form must not fall through to a full refund
+		_ = h.View.Render(w, "refund_result", map[string]any{"Error": pos.ErrNothingToRefund.Error()})
+		return
+	}
+	sale, err := h.POS.Refund(h.Terminal, req)
+	data := map[string]any{"Refund": sale}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	_ = h.View.Render(w, "refund_result", data)
+}
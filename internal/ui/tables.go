@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
+)
+
+/* ----------------- Table service (htmx-friendly) ----------------- */
+
+// TablesHTTP shows the floor plan and moves tabs around it. Actions
+// re-render the "floor" partial, or send the browser to the tab they
+// leave the terminal working on. Actions taken from the till screen
+// rather than the floor plan get their errors back as "table_error".
+type TablesHTTP struct {
+	POS      *pos.Service
+	View     TplRenderer
+	Terminal string
+}
+
+// Show renders the floor plan.
+func (h *TablesHTTP) Show(w http.ResponseWriter, r *http.Request) {
+	h.render(w, nil)
+}
+
+// Open seats form field "covers" at "table" and goes to its tab.
+func (h *TablesHTTP) Open(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	table := strings.TrimSpace(r.Form.Get("table"))
+	covers, _ := strconv.Atoi(strings.TrimSpace(r.Form.Get("covers")))
+	if _, err := h.POS.OpenTab(table, covers); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/?table="+table)
+}
+
+// Move moves the tab on form field "from" to the free table "to".
+func (h *TablesHTTP) Move(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	_, err := h.POS.MoveTab(r.Form.Get("from"), r.Form.Get("to"))
+	h.render(w, err)
+}
+
+// Merge moves the tab on form field "from" onto the tab on "into".
+func (h *TablesHTTP) Merge(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	_, err := h.POS.MergeTabs(r.Form.Get("from"), r.Form.Get("into"))
+	h.render(w, err)
+}
+
+// Settle brings the tab on form field "table" to this terminal to be
+// paid.
+func (h *TablesHTTP) Settle(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	if _, err := h.POS.SettleTab(h.Terminal, r.Form.Get("table")); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/")
+}
+
+// Send puts this terminal's basket on the tab for form field "table".
+func (h *TablesHTTP) Send(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	table := strings.TrimSpace(r.Form.Get("table"))
+	if _, err := h.POS.SendToTable(h.Terminal, table); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/?table="+table)
+}
+
+// List returns the floor plan's tables as JSON.
+func (h *TablesHTTP) List(w http.ResponseWriter, r *http.Request) {
+	list, err := h.POS.Tables()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = []pos.Table{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Save adds or replaces a table from a JSON pos.Table body, or form
+// fields "id", "name", "seats", "x" and "y" from the designer, which get
+// the "tables_admin" partial back.
+func (h *TablesHTTP) Save(w http.ResponseWriter, r *http.Request) {
+	var t pos.Table
+	if r.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+		if err := h.POS.SaveTable(t); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+		return
+	}
+	_ = r.ParseForm()
+	t.ID, t.Name = r.Form.Get("id"), r.Form.Get("name")
+	t.Seats, _ = strconv.Atoi(strings.TrimSpace(r.Form.Get("seats")))
+	t.X, _ = strconv.Atoi(strings.TrimSpace(r.Form.Get("x")))
+	t.Y, _ = strconv.Atoi(strings.TrimSpace(r.Form.Get("y")))
+	h.renderAdmin(w, h.POS.SaveTable(t))
+}
+
+// Delete removes the table named by ?id= (or form field "id").
+func (h *TablesHTTP) Delete(w http.ResponseWriter, r *http.Request) {
+	err := h.POS.DeleteTable(strings.TrimSpace(r.FormValue("id")))
+	if r.Method == http.MethodDelete {
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.renderAdmin(w, err)
+}
+
+func (h *TablesHTTP) render(w http.ResponseWriter, err error) {
+	plan, perr := h.POS.FloorPlan()
+	data := map[string]any{"Tables": plan}
+	if err = cmp.Or(err, perr); err != nil {
+		data["Error"] = err.Error()
+	}
+	_ = h.View.Render(w, "floor", data)
+}
+
+// fail reports err where the request came from.
+func (h *TablesHTTP) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Header.Get("HX-Target") == "floor" {
+		h.render(w, err)
+		return
+	}
+	_ = h.View.Render(w, "table_error", err.Error())
+}
+
+func (h *TablesHTTP) renderAdmin(w http.ResponseWriter, err error) {
+	list, lerr := h.POS.Tables()
+	data := map[string]any{"Tables": list}
+	if err = cmp.Or(err, lerr); err != nil {
+		data["Error"] = err.Error()
+	}
+	_ = h.View.Render(w, "tables_admin", data)
+}
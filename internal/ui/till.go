@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/universaltill/universal-till/internal/pos"
+)
+
+/* ----------------- Till sessions (htmx-friendly) ----------------- */
+
+// TillHTTP opens and closes the calling terminal's till session and
+// records cash in and out of the drawer. Every action re-renders the
+// "till" partial.
+type TillHTTP struct {
+	POS      *pos.Service
+	View     TplRenderer
+	Terminal string
+	// Denominations, when set, are counted one by one at close
+	Denominations []int64
+	// Blind hides the expected takings until the count is submitted
+	Blind bool
+	// Currencies are the foreign cash counted at close, in their own cents
+	Currencies []string
+}
+
+// countMethods are the tenders counted at close.
+var countMethods = []string{pos.MethodCash, pos.MethodCard, pos.MethodVoucher}
+
+func (h *TillHTTP) Show(w http.ResponseWriter, r *http.Request) {
+	h.render(w, nil, nil, nil)
+}
+
+// Open starts a session with form field "float" (cents).
+func (h *TillHTTP) Open(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	floatCents, err := strconv.ParseInt(strings.TrimSpace(r.Form.Get("float")), 10, 64)
+	if err != nil {
+		h.render(w, nil, nil, pos.ErrCashAmount)
+		return
+	}
+	_, err = h.POS.OpenTill(h.Terminal, floatCents)
+	h.render(w, nil, nil, err)
+}
+
+// Cash records form fields "kind", "amount" (cents) and "reason".
+func (h *TillHTTP) Cash(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	kind := r.Form.Get("kind")
+	var amount int64
+	if kind != pos.CashNoSale {
+		var err error
+		if amount, err = strconv.ParseInt(strings.TrimSpace(r.Form.Get("amount")), 10, 64); err != nil {
+			h.render(w, nil, nil, pos.ErrCashAmount)
+			return
+		}
+	}
+	m, err := h.POS.MoveCash(h.Terminal, kind, amount, r.Form.Get("reason"))
+	h.render(w, nil, m, err)
+}
+
+// X renders a mid-shift read of the open session.
+func (h *TillHTTP) X(w http.ResponseWriter, r *http.Request) {
+	rep, err := h.POS.XReport(h.Terminal)
+	h.render(w, rep, nil, err)
+}
+
+// Close closes the session and renders the Z report. Cash comes from
+// "denom_<cents>" quantities when denominations are configured, otherwise
+// from "counted_cash"; other tenders from "counted_<method>" (cents), and
+// foreign cash from "counted_cash:<currency>".
+func (h *TillHTTP) Close(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	counted := map[string]int64{}
+	for _, m := range countMethods {
+		if m == pos.MethodCash && h.Denominations != nil {
+			continue
+		}
+		n, ok := formCents(r, "counted_"+m)
+		if !ok {
+			h.render(w, nil, nil, pos.ErrCashAmount)
+			return
+		}
+		counted[m] = n
+	}
+	for _, c := range h.Currencies {
+		key := pos.TenderKey(pos.Payment{Method: pos.MethodCash, Currency: c})
+		n, ok := formCents(r, "counted_"+key)
+		if !ok {
+			h.render(w, nil, nil, pos.ErrCashAmount)
+			return
+		}
+		counted[key] = n
+	}
+	var cash []pos.DenominationCount
+	for _, d := range h.Denominations {
+		n, ok := formCents(r, "denom_"+strconv.FormatInt(d, 10))
+		if !ok {
+			h.render(w, nil, nil, pos.ErrCashAmount)
+			return
+		}
+		cash = append(cash, pos.DenominationCount{ValueCents: d, Qty: n})
+	}
+	rep, err := h.POS.CloseTill(h.Terminal, cash, counted)
+	h.render(w, rep, nil, err)
+}
+
+// formCents reads a whole, non-negative number; blank is zero.
+func formCents(r *http.Request, field string) (int64, bool) {
+	v := strings.TrimSpace(r.Form.Get(field))
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	return n, err == nil && n >= 0
+}
+
+func (h *TillHTTP) render(w http.ResponseWriter, rep *pos.SessionReport, m *pos.CashMovement, err error) {
+	data := map[string]any{
+		"Report":        rep,
+		"Movement":      m,
+		"Reasons":       pos.DefaultCashReasons,
+		"Methods":       countMethods,
+		"Denominations": h.Denominations,
+		"Blind":         h.Blind,
+		"Currencies":    h.Currencies,
+	}
+	if sess, err := h.POS.CurrentSession(h.Terminal); err == nil {
+		data["Session"] = sess
+		if !h.Blind {
+			if x, err := h.POS.XReport(h.Terminal); err == nil {
+				data["Expected"] = x.Tenders
+			}
+		}
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	_ = h.View.Render(w, "till", data)
+}
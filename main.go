@@ -2,15 +2,20 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"maps"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/universaltill/universal-till/internal/common"
 	"github.com/universaltill/universal-till/internal/httpx"
@@ -27,6 +32,10 @@ func buildMenu(menuPlugins map[string]common.MenuPlugin, recs map[string]common.
 	items := []menuItem{
 		{Href: "/", Label: "Home"},
 		{Href: "/designer", Label: "Designer"},
+		{Href: "/tables", Label: "Tables"},
+		{Href: "/refunds", Label: "Refunds"},
+		{Href: "/till", Label: "Till"},
+		{Href: "/customers", Label: "Customers"},
 		{Href: "/settings", Label: "Settings"},
 		{Href: "/plugins", Label: "Plugins"},
 	}
@@ -43,6 +52,14 @@ func buildMenu(menuPlugins map[string]common.MenuPlugin, recs map[string]common.
 	return items
 }
 
+// loyaltyMultipliers is the part of the loyalty rules edited as JSON on
+// the settings page.
+type loyaltyMultipliers struct {
+	Categories map[string]float64   `json:"categories"`
+	Promotions map[string]float64   `json:"promotions"`
+	Tiers      []common.LoyaltyTier `json:"tiers"`
+}
+
 // plugin helpers
 func pluginDir(id string) string { return filepath.Join("data", "plugins", id) }
 
@@ -51,6 +68,67 @@ func pluginDownloaded(id string) bool {
 	return err == nil && !st.IsDir()
 }
 
+// dayRange reads ?date=YYYY-MM-DD as a local calendar day, defaulting to today.
+func dayRange(r *http.Request) (time.Time, time.Time, error) {
+	day := time.Now()
+	if v := r.URL.Query().Get("date"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("date must be YYYY-MM-DD")
+		}
+		day = d
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	return from, from.AddDate(0, 0, 1), nil
+}
+
+// tableParam reads ?table= for the till screen, when it is a usable table ID.
+func tableParam(r *http.Request) string {
+	t := strings.TrimSpace(r.URL.Query().Get("table"))
+	if pos.ValidateTable(pos.Table{ID: t}) != nil {
+		return ""
+	}
+	return t
+}
+
+// basketID is the basket a till request works on: the tab of the table
+// in the X-Table header, sent while the till screen is on a table, or the
+// terminal's own basket.
+func basketID(w http.ResponseWriter, r *http.Request) string {
+	if t := strings.TrimSpace(r.Header.Get("X-Table")); t != "" {
+		return pos.TabKey(t)
+	}
+	return httpx.KnownTerminal(w, r)
+}
+
+// joinPercents lists percentages for a comma separated form field.
+func joinPercents(ps []float64) string {
+	out := make([]string, len(ps))
+	for i, p := range ps {
+		out[i] = strconv.FormatFloat(p, 'f', -1, 64)
+	}
+	return strings.Join(out, ", ")
+}
+
+// taxEngine prices baskets for the configured country and region. A
+// configured tax rate, 0% included, replaces the table's standard rate;
+// without one a country missing from the table charges no tax.
+func taxEngine(table pos.TaxTable, s common.Settings) pos.TaxEngine {
+	var std *int
+	if s.TaxRatePct != nil {
+		bp := int(math.Round(*s.TaxRatePct * 100))
+		std = &bp
+	}
+	return pos.TableTaxEngine{
+		Table:      table,
+		Country:    s.Country,
+		Region:     s.Region,
+		Fallback:   pos.FlatTaxRates(0),
+		StandardBP: std,
+		Inclusive:  s.TaxInclusive,
+	}
+}
+
 var version = "0.1.0"
 
 func main() {
@@ -68,6 +146,7 @@ func main() {
 
 	// // Settings store
 	// preferSQLite := utStore == "sqlite"
+	common.InitSettingsDefaults(cfg)
 	settings := common.NewSettingsStore(dataDir, database)
 
 	// If SQLite is enabled and a legacy buttons.json exists, migrate once
@@ -93,9 +172,105 @@ func main() {
 	httpx.InitI18n(i18n, cfg.DefaultLocale)
 	httpx.InitCurrency(cfg.Currency)
 
+	// Sales journal shares the edge database
+	journal, err := pos.NewSQLiteJournal(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open sales journal: %v", err)
+	}
+
+	promos, err := pos.NewSQLitePromotionStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open promotions: %v", err)
+	}
+
+	vouchers, err := pos.NewSQLiteVoucherStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open vouchers: %v", err)
+	}
+
+	parked, err := pos.NewSQLiteParkStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open parked baskets: %v", err)
+	}
+
+	sessions, err := pos.NewSQLiteSessionStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open till sessions: %v", err)
+	}
+
+	audit, err := pos.NewSQLiteAuditLog(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open audit log: %v", err)
+	}
+
+	customers, err := pos.NewSQLiteCustomerStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open customers: %v", err)
+	}
+
+	loyalty, err := pos.NewSQLiteLoyaltyLedger(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open loyalty ledger: %v", err)
+	}
+
+	giftcards, err := pos.NewSQLiteGiftCardStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open gift cards: %v", err)
+	}
+
+	rates, err := pos.NewSQLiteRateStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open exchange rates: %v", err)
+	}
+	tables, err := pos.NewSQLiteTableStore(filepath.Join(dataDir, database))
+	if err != nil {
+		logger.Fatalf("failed to open tables: %v", err)
+	}
+
+	// foreignCurrencies lists the currencies foreign cash can be taken in
+	foreignCurrencies := func() []string {
+		list, _ := rates.List()
+		var codes []string
+		for _, x := range list {
+			codes = append(codes, x.Currency)
+		}
+		return codes
+	}
+
+	taxTable, err := pos.LoadTaxTable(cfg.TaxTable)
+	if err != nil {
+		logger.Fatalf("failed to load tax table: %v", err)
+	}
+
 	// POS engine uses buttons store for prices
 	resolver := ui.PriceResolverAdapter{Store: btnStore}
-	engine := pos.NewServiceWithResolver(pos.Config{TaxInclusive: cfg.TaxInclusive}, resolver)
+	engine := pos.NewServiceWithResolver(pos.Config{MaxBaskets: cfg.MaxBaskets, Journal: journal, Promotions: promos, Vouchers: vouchers, Parking: parked, ParkTTL: cfg.ParkTTL, Sessions: sessions, Audit: audit, Customers: customers, Loyalty: loyalty, GiftCards: giftcards, GiftCardMonths: cfg.GiftCardMonths, Rates: rates, Tables: tables, Tax: taxEngine(taxTable, settings.GetAll())}, resolver)
+	if err := engine.SetBarcodeRules(settings.GetAll().BarcodeRules); err != nil {
+		logger.Printf("ignoring saved barcode rules: %v", err)
+	}
+	if err := engine.SetLoyaltyRules(settings.GetAll().Loyalty); err != nil {
+		logger.Printf("ignoring saved loyalty rules: %v", err)
+	}
+	if err := engine.SetCashRounding(settings.GetAll().CashRoundingStep()); err != nil {
+		logger.Printf("ignoring saved cash rounding: %v", err)
+	}
+	engine.SetBaseCurrency(settings.GetAll().Currency)
+	if err := engine.SetHospitalityRules(settings.GetAll().Hospitality); err != nil {
+		logger.Printf("ignoring saved hospitality rules: %v", err)
+	}
+	// gift card and points entries that didn't post with their sale are
+	// kept in the journal; post them now and keep trying
+	go func() {
+		for ; ; time.Sleep(time.Minute) {
+			if err := engine.RetryPosts(); err != nil {
+				logger.Printf("posting ledgers: %v", err)
+			}
+		}
+	}()
+	tableList := func() []pos.Table {
+		list, _ := engine.Tables()
+		return list
+	}
 
 	mux := httpx.NewMux()
 
@@ -109,10 +284,13 @@ func main() {
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		cur := settings.GetAll()
 		data := map[string]any{
-			"title":     "Universal Till",
-			"samples":   cfg.SamplesDir != "",
-			"theme":     settings.GetTheme(),
-			"menuItems": buildMenu(cur.MenuPlugins, cur.PluginRecords),
+			"title":       "Universal Till",
+			"samples":     cfg.SamplesDir != "",
+			"currencies":  foreignCurrencies(),
+			"tipPercents": cur.Hospitality.TipPercents,
+			"table":       tableParam(r),
+			"theme":       settings.GetTheme(),
+			"menuItems":   buildMenu(cur.MenuPlugins, cur.PluginRecords),
 		}
 		httpx.Render("ui/pages/index.html", data)(w, r)
 	})
@@ -127,19 +305,68 @@ func main() {
 			"theme":     settings.GetTheme(),
 			"menuItems": buildMenu(cur.MenuPlugins, cur.PluginRecords),
 			"Buttons":   ui.ToVM(btns),
+			"Tables":    tableList(),
 		}
 		httpx.Render("ui/pages/designer.html", data)(w, r)
 	})
-	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/tables", func(w http.ResponseWriter, r *http.Request) {
 		cur := settings.GetAll()
 		data := map[string]any{
-			"title":     "Settings",
+			"title":     "Tables",
 			"theme":     settings.GetTheme(),
-			"settings":  cur,
 			"menuItems": buildMenu(cur.MenuPlugins, cur.PluginRecords),
 		}
+		httpx.Render("ui/pages/tables.html", data)(w, r)
+	})
+	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
+		cur := settings.GetAll()
+		rules, _ := json.MarshalIndent(cur.BarcodeRules, "", "  ")
+		denoms, _ := json.Marshal(cur.Denominations)
+		rounding, _ := json.Marshal(cur.CashRounding)
+		lm := loyaltyMultipliers{Categories: map[string]float64{}, Promotions: map[string]float64{}, Tiers: cur.Loyalty.Tiers}
+		maps.Copy(lm.Categories, cur.Loyalty.Categories)
+		maps.Copy(lm.Promotions, cur.Loyalty.Promotions)
+		loyalty, _ := json.MarshalIndent(lm, "", "  ")
+		data := map[string]any{
+			"title":         "Settings",
+			"theme":         settings.GetTheme(),
+			"settings":      cur,
+			"barcodeRules":  string(rules),
+			"denominations": string(denoms),
+			"cashRounding":  string(rounding),
+			"tipPercents":   joinPercents(cur.Hospitality.TipPercents),
+			"loyaltyRules":  string(loyalty),
+			"menuItems":     buildMenu(cur.MenuPlugins, cur.PluginRecords),
+		}
 		httpx.Render("ui/pages/settings.html", data)(w, r)
 	})
+	mux.HandleFunc("/refunds", func(w http.ResponseWriter, r *http.Request) {
+		cur := settings.GetAll()
+		data := map[string]any{
+			"title":     "Refunds",
+			"theme":     settings.GetTheme(),
+			"menuItems": buildMenu(cur.MenuPlugins, cur.PluginRecords),
+		}
+		httpx.Render("ui/pages/refunds.html", data)(w, r)
+	})
+	mux.HandleFunc("/till", func(w http.ResponseWriter, r *http.Request) {
+		cur := settings.GetAll()
+		data := map[string]any{
+			"title":     "Till",
+			"theme":     settings.GetTheme(),
+			"menuItems": buildMenu(cur.MenuPlugins, cur.PluginRecords),
+		}
+		httpx.Render("ui/pages/till.html", data)(w, r)
+	})
+	mux.HandleFunc("/customers", func(w http.ResponseWriter, r *http.Request) {
+		cur := settings.GetAll()
+		data := map[string]any{
+			"title":     "Customers",
+			"theme":     settings.GetTheme(),
+			"menuItems": buildMenu(cur.MenuPlugins, cur.PluginRecords),
+		}
+		httpx.Render("ui/pages/customers.html", data)(w, r)
+	})
 	mux.HandleFunc("/plugins", func(w http.ResponseWriter, r *http.Request) {
 		cur := settings.GetAll()
 		// Build installed and downloaded id lists
@@ -210,8 +437,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		b, _ := engine.Scan("")
-		_ = basketView.Render(w, b)
+		_ = basketView.Render(w, ui.BasketVM{Basket: engine.Basket(basketID(w, r))})
 	})
 
 	// Buttons admin (POST)
@@ -249,11 +475,11 @@ func main() {
 	// POS actions
 	mux.HandleFunc("/api/pos/scan", func(w http.ResponseWriter, r *http.Request) {
 		code := ""
-		qty := 1
+		qty := 1.0
 		if r.Header.Get("Content-Type") == "application/json" {
 			type In struct {
-				Code string `json:"code"`
-				Qty  int    `json:"qty"`
+				Code string  `json:"code"`
+				Qty  float64 `json:"qty"`
 			}
 			var in In
 			_ = json.NewDecoder(r.Body).Decode(&in)
@@ -265,29 +491,597 @@ func main() {
 			_ = r.ParseForm()
 			code = r.Form.Get("code")
 			if q := r.Form.Get("qty"); q != "" {
-				if v, err := strconv.Atoi(q); err == nil && v > 0 {
+				if v, err := strconv.ParseFloat(q, 64); err == nil && v > 0 {
 					qty = v
 				}
 			}
 		}
-		b, _ := engine.ScanQty(code, qty)
+		terminal := basketID(w, r)
+		vm := ui.BasketVM{}
+		if b, err := engine.ScanQty(terminal, code, qty); err != nil {
+			vm.Basket, vm.Error = engine.Basket(terminal), err.Error()
+			switch {
+			case errors.Is(err, pos.ErrItemNotFound):
+				// offer the department keys and, if allowed, the catalog
+				btns, _ := btnStore.Load()
+				vm.NotFound, vm.Departments, vm.CatalogAdd = strings.TrimSpace(code), ui.Departments(btns), settings.GetAll().TillCatalogAdd
+				if r.Header.Get("HX-Request") == "" {
+					w.WriteHeader(http.StatusNotFound)
+				}
+			case errors.Is(err, pos.ErrPriceNeeded):
+				vm.PriceFor = strings.TrimSpace(code)
+			case errors.Is(err, pos.ErrOptionsNeeded):
+				btns, _ := btnStore.Load()
+				if b, ok := ui.FindButton(btns, code); ok {
+					vm.OptionsFor = &b
+				}
+			}
+		} else {
+			vm.Basket = b
+		}
 		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
 		basketView, _ := ui.NewBasketView(funcs)
-		_ = basketView.Render(w, b)
+		_ = basketView.Render(w, vm)
+	})
+
+	// Department keys and open-price items, sold at a keyed price
+	mux.HandleFunc("/api/pos/keyprice", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.KeyPrice(w, r)
+	})
+
+	// Items made with options: the choices from the item's options form
+	mux.HandleFunc("/api/pos/modifiers", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.AddWithModifiers(w, r)
+	})
+
+	// Unknown barcodes added to the catalog at the till, when settings allow
+	mux.HandleFunc("/api/pos/catalog/add", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		if settings.GetAll().TillCatalogAdd {
+			h.Catalog = btnStore
+		}
+		h.AddToCatalog(w, r)
+	})
+
+	// Line edits: /api/pos/lines/{void,qty,price,note,seat,modifiers} with form field "line"
+	mux.HandleFunc("/api/pos/lines/", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		switch strings.TrimPrefix(r.URL.Path, "/api/pos/lines/") {
+		case "void":
+			h.Void(w, r)
+		case "qty":
+			h.SetQty(w, r)
+		case "price":
+			h.OverridePrice(w, r)
+		case "note":
+			h.SetNote(w, r)
+		case "seat":
+			h.SetSeat(w, r)
+		case "modifiers":
+			h.SetModifiers(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// Split bill: by item, by seat or evenly; the parts are tendered one by one
+	mux.HandleFunc("/api/pos/split", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.Split(w, r)
+	})
+	mux.HandleFunc("/api/pos/unsplit", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.Unsplit(w, r)
+	})
+
+	// Vouchers are added by scanning their code; this takes one back out
+	mux.HandleFunc("/api/pos/vouchers/remove", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.RemoveVoucher(w, r)
+	})
+
+	// Age checks: answer the check held by the last scan
+	mux.HandleFunc("/api/pos/age", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.ConfirmAge(w, r)
+	})
+
+	// Customers: attach one to the basket (cards also attach by scanning), or take it off
+	mux.HandleFunc("/api/pos/customer", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.AttachCustomer(w, r)
+	})
+	mux.HandleFunc("/api/pos/customer/detach", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.DetachCustomer(w, r)
+	})
+
+	// Hospitality: service charge on the basket and who is serving it
+	mux.HandleFunc("/api/pos/service-charge", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.ServiceCharge(w, r)
+	})
+	mux.HandleFunc("/api/pos/operator", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.Operator(w, r)
+	})
+	// Tip suggestions for the terminal's basket, as percentages and amounts
+	mux.HandleFunc("/api/pos/tip-suggestions", func(w http.ResponseWriter, r *http.Request) {
+		list := engine.TipSuggestions(basketID(w, r))
+		if list == nil {
+			list = []pos.TipSuggestion{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	})
+
+	// Gift cards: sell or top up a card in the basket; it loads once the sale is paid
+	mux.HandleFunc("/api/pos/giftcard", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: basketID(w, r)}
+		h.SellGiftCard(w, r)
+	})
+	// Balance enquiry: ?number=, with the card's ledger
+	mux.HandleFunc("/api/giftcards/balance", func(w http.ResponseWriter, r *http.Request) {
+		number := r.URL.Query().Get("number")
+		card, err := engine.GiftCard(number)
+		if errors.Is(err, pos.ErrGiftCardNotFound) || errors.Is(err, pos.ErrNoGiftCards) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries, err := engine.GiftCardStatement(number)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			pos.GiftCard
+			Expired bool                `json:"expired"`
+			Entries []pos.GiftCardEntry `json:"entries"`
+		}{card, card.Expired(time.Now()), entries})
+	})
+
+	// Parking: park the basket with a label, list parked baskets, recall one by id
+	mux.HandleFunc("/api/pos/park", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: httpx.KnownTerminal(w, r)}
+		h.Park(w, r)
+	})
+	mux.HandleFunc("/api/pos/recall", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: httpx.KnownTerminal(w, r)}
+		h.Recall(w, r)
+	})
+	mux.HandleFunc("/ui/parked", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: httpx.KnownTerminal(w, r)}
+		h.Parked(w, r)
+	})
+
+	// Table service: the floor plan, tabs moved, merged and settled, and
+	// the tables laid out in the designer (GET lists, POST saves, DELETE ?id=)
+	tablesHTTP := func(w http.ResponseWriter, r *http.Request) (*ui.TablesHTTP, bool) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		renderer, err := ui.NewRenderer(
+			filepath.Join("web", "ui", "layouts", "base.html"),
+			filepath.Join("web", "ui", "pages", "tables.html"),
+			filepath.Join("web", "ui", "partials", "tables.html"),
+			funcs,
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		return &ui.TablesHTTP{POS: engine, View: renderer, Terminal: httpx.KnownTerminal(w, r)}, true
+	}
+	mux.HandleFunc("/ui/tables", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := tablesHTTP(w, r); ok {
+			h.Show(w, r)
+		}
+	})
+	mux.HandleFunc("/api/tables", func(w http.ResponseWriter, r *http.Request) {
+		h, ok := tablesHTTP(w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.List(w, r)
+		case http.MethodPost:
+			h.Save(w, r)
+		case http.MethodDelete:
+			h.Delete(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/tables/", func(w http.ResponseWriter, r *http.Request) {
+		h, ok := tablesHTTP(w, r)
+		if !ok {
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/api/tables/") {
+		case "open":
+			h.Open(w, r)
+		case "move":
+			h.Move(w, r)
+		case "merge":
+			h.Merge(w, r)
+		case "settle":
+			h.Settle(w, r)
+		case "send":
+			h.Send(w, r)
+		case "delete":
+			h.Delete(w, r)
+		default:
+			http.NotFound(w, r)
+		}
 	})
 
 	mux.HandleFunc("/api/pos/tender", func(w http.ResponseWriter, r *http.Request) {
-		type In struct {
-			Amount int64  `json:"amount"`
-			Method string `json:"method"`
-		}
-		var in In
-		_ = json.NewDecoder(r.Body).Decode(&in)
-		_, _ = engine.Tender(in.Amount, in.Method)
-		b, _ := engine.Scan("")
 		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
-		basketView, _ := ui.NewBasketView(funcs)
-		_ = basketView.Render(w, b)
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: httpx.KnownTerminal(w, r)}
+		h.Tender(w, r)
+	})
+	// Taking payments back: one of them, or all to cancel tendering
+	mux.HandleFunc("/api/pos/tender/", func(w http.ResponseWriter, r *http.Request) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		basketView, err := ui.NewBasketView(funcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := &ui.BasketHTTP{POS: engine, View: basketView, Terminal: httpx.KnownTerminal(w, r)}
+		switch strings.TrimPrefix(r.URL.Path, "/api/pos/tender/") {
+		case "void":
+			h.VoidPayment(w, r)
+		case "cancel":
+			h.CancelTender(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// Refunds: look up a receipt, then return some or all of it
+	refundHTTP := func(w http.ResponseWriter, r *http.Request) (*ui.RefundHTTP, bool) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		renderer, err := ui.NewRenderer(
+			filepath.Join("web", "ui", "layouts", "base.html"),
+			filepath.Join("web", "ui", "pages", "refunds.html"),
+			filepath.Join("web", "ui", "partials", "refund.html"),
+			funcs,
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		return &ui.RefundHTTP{POS: engine, View: renderer, Terminal: httpx.ResolveTerminal(w, r)}, true
+	}
+	mux.HandleFunc("/ui/refund", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := refundHTTP(w, r); ok {
+			h.Lookup(w, r)
+		}
+	})
+	mux.HandleFunc("/api/pos/refund", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := refundHTTP(w, r); ok {
+			h.Refund(w, r)
+		}
+	})
+
+	// Till sessions: open with a float, cash in and out, X read and Z close
+	tillHTTP := func(w http.ResponseWriter, r *http.Request) (*ui.TillHTTP, bool) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		renderer, err := ui.NewRenderer(
+			filepath.Join("web", "ui", "layouts", "base.html"),
+			filepath.Join("web", "ui", "pages", "till.html"),
+			filepath.Join("web", "ui", "partials", "till.html"),
+			funcs,
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		cur := settings.GetAll()
+		return &ui.TillHTTP{POS: engine, View: renderer, Terminal: httpx.ResolveTerminal(w, r),
+			Denominations: cur.CashDenominations(), Blind: cur.BlindClose, Currencies: foreignCurrencies()}, true
+	}
+	mux.HandleFunc("/ui/till", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := tillHTTP(w, r); ok {
+			h.Show(w, r)
+		}
+	})
+	mux.HandleFunc("/ui/till/x", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := tillHTTP(w, r); ok {
+			h.X(w, r)
+		}
+	})
+	mux.HandleFunc("/api/till/", func(w http.ResponseWriter, r *http.Request) {
+		h, ok := tillHTTP(w, r)
+		if !ok {
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/api/till/") {
+		case "sessions":
+			// counts and variances for follow-up: ?date=YYYY-MM-DD (local), defaults to today
+			from, to, err := dayRange(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			list, err := engine.TillSessions(from, to)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if list == nil {
+				list = []pos.Session{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(list)
+		case "open":
+			h.Open(w, r)
+		case "cash":
+			h.Cash(w, r)
+		case "close":
+			h.Close(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// Customer records: search and edit, purchase history, and the till's attach picker
+	customersHTTP := func(w http.ResponseWriter, r *http.Request) (*ui.CustomersHTTP, bool) {
+		funcs := httpx.FuncsFor(httpx.ResolveLocale(w, r))
+		renderer, err := ui.NewRenderer(
+			filepath.Join("web", "ui", "layouts", "base.html"),
+			filepath.Join("web", "ui", "pages", "customers.html"),
+			filepath.Join("web", "ui", "partials", "customers.html"),
+			funcs,
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		return &ui.CustomersHTTP{Store: customers, POS: engine, View: renderer}, true
+	}
+	mux.HandleFunc("/ui/customers", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := customersHTTP(w, r); ok {
+			h.List(w, r)
+		}
+	})
+	mux.HandleFunc("/ui/customers/history", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := customersHTTP(w, r); ok {
+			h.History(w, r)
+		}
+	})
+	mux.HandleFunc("/ui/customers/pick", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := customersHTTP(w, r); ok {
+			h.Pick(w, r)
+		}
+	})
+	mux.HandleFunc("/api/customers/save", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := customersHTTP(w, r); ok {
+			h.Save(w, r)
+		}
+	})
+
+	// Sales journal: ?date=YYYY-MM-DD (local), defaults to today
+	mux.HandleFunc("/api/pos/sales", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dayRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sales, err := engine.Sales(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sales == nil {
+			sales = []pos.Sale{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sales)
+	})
+	// Tips by serving operator: ?date=YYYY-MM-DD (local), defaults to today
+	mux.HandleFunc("/api/pos/tips", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dayRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tips, err := engine.Tips(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tips)
+	})
+	// Promotions: GET lists, POST saves a JSON rule, DELETE ?id= removes
+	mux.HandleFunc("/api/promotions", func(w http.ResponseWriter, r *http.Request) {
+		h := &ui.PromotionsHTTP{Store: promos, POS: engine}
+		switch r.Method {
+		case http.MethodGet:
+			h.List(w, r)
+		case http.MethodPost:
+			h.Save(w, r)
+		case http.MethodDelete:
+			h.Delete(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Exchange rates: GET lists, POST saves a JSON rate (with an optional
+	// manual override), DELETE ?currency= removes
+	mux.HandleFunc("/api/fx/rates", func(w http.ResponseWriter, r *http.Request) {
+		h := &ui.RatesHTTP{Store: rates}
+		switch r.Method {
+		case http.MethodGet:
+			h.List(w, r)
+		case http.MethodPost:
+			h.Save(w, r)
+		case http.MethodDelete:
+			h.Delete(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Vouchers: GET lists, POST saves a JSON voucher
+	mux.HandleFunc("/api/vouchers", func(w http.ResponseWriter, r *http.Request) {
+		h := &ui.VouchersHTTP{Store: vouchers}
+		switch r.Method {
+		case http.MethodGet:
+			h.List(w, r)
+		case http.MethodPost:
+			h.Save(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Audit trail for a day: ?date=YYYY-MM-DD (local), defaults to today
+	mux.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dayRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		events, err := engine.AuditTrail(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if events == nil {
+			events = []pos.AuditEvent{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(events)
+	})
+
+	// Tax by rate for a day: ?date=YYYY-MM-DD (local), defaults to today
+	mux.HandleFunc("/api/pos/tax-report", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dayRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		bands, err := engine.TaxReport(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if bands == nil {
+			bands = []pos.TaxBand{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(bands)
 	})
 
 	mux.HandleFunc("/api/settings/save", func(w http.ResponseWriter, r *http.Request) {
@@ -299,21 +1093,141 @@ func main() {
 		if v := strings.TrimSpace(r.Form.Get("country")); v != "" {
 			cur.Country = v
 		}
-		if v := strings.TrimSpace(r.Form.Get("region")); v != "" {
-			cur.Region = v
+		// region may be cleared to drop back to country-wide rates
+		if r.Form.Has("region") {
+			cur.Region = strings.TrimSpace(r.Form.Get("region"))
 		}
 		cur.TaxInclusive = r.Form.Get("taxInclusive") == "on"
-		if v := r.Form.Get("taxRatePct"); v != "" {
-			if n, err := strconv.Atoi(v); err == nil && n >= 0 {
-				cur.TaxRatePct = n
+		// left blank, the tax table's standard rate applies
+		if r.Form.Has("taxRatePct") {
+			cur.TaxRatePct = common.ParseTaxRate(r.Form.Get("taxRatePct"))
+		}
+		if r.Form.Has("barcodeRules") {
+			rules := []common.BarcodeRule{} // saved as [] so clearing doesn't bring the defaults back
+			if v := strings.TrimSpace(r.Form.Get("barcodeRules")); v != "" {
+				if err := json.Unmarshal([]byte(v), &rules); err != nil {
+					http.Error(w, "barcode rules: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			for _, rule := range rules {
+				if err := pos.ValidateBarcodeRule(rule); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
 			}
+			cur.BarcodeRules = rules
+		}
+		cur.BlindClose = r.Form.Get("blindClose") == "on"
+		cur.TillCatalogAdd = r.Form.Get("tillCatalogAdd") == "on"
+		if r.Form.Has("denominations") {
+			denoms := map[string][]int64{}
+			if v := strings.TrimSpace(r.Form.Get("denominations")); v != "" {
+				if err := json.Unmarshal([]byte(v), &denoms); err != nil {
+					http.Error(w, "denominations: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			cur.Denominations = map[string][]int64{}
+			for code, list := range denoms {
+				for _, d := range list {
+					if d <= 0 {
+						http.Error(w, "denominations must be positive amounts in cents", http.StatusBadRequest)
+						return
+					}
+				}
+				sort.Slice(list, func(i, j int) bool { return list[i] > list[j] })
+				cur.Denominations[strings.ToUpper(strings.TrimSpace(code))] = list
+			}
+		}
+		if r.Form.Has("cashRounding") {
+			steps := map[string]int64{}
+			if v := strings.TrimSpace(r.Form.Get("cashRounding")); v != "" {
+				if err := json.Unmarshal([]byte(v), &steps); err != nil {
+					http.Error(w, "cash rounding: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			cur.CashRounding = map[string]int64{}
+			for code, step := range steps {
+				if step < 0 {
+					http.Error(w, pos.ErrCashRounding.Error(), http.StatusBadRequest)
+					return
+				}
+				cur.CashRounding[strings.ToUpper(strings.TrimSpace(code))] = step
+			}
+		}
+		cur.Loyalty.Enabled = r.Form.Get("loyaltyEnabled") == "on"
+		if v := r.Form.Get("pointsPerUnit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "points per unit: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			cur.Loyalty.PointsPerUnit = n
+		}
+		if v := r.Form.Get("pointValueCents"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "point value: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			cur.Loyalty.PointValueCents = n
+		}
+		if r.Form.Has("loyaltyRules") {
+			var m loyaltyMultipliers
+			if v := strings.TrimSpace(r.Form.Get("loyaltyRules")); v != "" {
+				if err := json.Unmarshal([]byte(v), &m); err != nil {
+					http.Error(w, "loyalty rules: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			cur.Loyalty.Categories, cur.Loyalty.Promotions, cur.Loyalty.Tiers = m.Categories, m.Promotions, m.Tiers
+		}
+		if err := pos.ValidateLoyaltyRules(cur.Loyalty); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if v := r.Form.Get("serviceChargePct"); v != "" {
+			pct, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				http.Error(w, "service charge: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			cur.Hospitality.ServiceChargePct = pct
+		}
+		if r.Form.Has("tipPercents") {
+			cur.Hospitality.TipPercents = nil
+			for _, f := range strings.Split(r.Form.Get("tipPercents"), ",") {
+				if f = strings.TrimSpace(f); f == "" {
+					continue
+				}
+				pct, err := strconv.ParseFloat(f, 64)
+				if err != nil {
+					http.Error(w, "tip suggestions: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				cur.Hospitality.TipPercents = append(cur.Hospitality.TipPercents, pct)
+			}
+		}
+		if err := pos.ValidateHospitalityRules(cur.Hospitality); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// everything is checked; only now save and put the settings to use
+		if err := settings.SetAll(cur); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		_ = settings.SetAll(cur)
 		// apply immediately
+		_ = engine.SetBarcodeRules(cur.BarcodeRules)
+		_ = engine.SetLoyaltyRules(cur.Loyalty)
+		_ = engine.SetHospitalityRules(cur.Hospitality)
 		httpx.InitCurrency(cur.Currency)
-		// swap tax engine on next basket compute via new service (simple for now)
-		resolver := ui.PriceResolverAdapter{Store: btnStore}
-		engine = pos.NewServiceWithResolver(pos.Config{TaxInclusive: cur.TaxInclusive}, resolver)
+		_ = engine.SetCashRounding(cur.CashRoundingStep())
+		engine.SetBaseCurrency(cur.Currency)
+		// swap tax engine in place so open baskets survive
+		engine.SetTaxEngine(taxEngine(taxTable, cur))
 		w.WriteHeader(http.StatusNoContent)
 	})
 
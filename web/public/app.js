@@ -10,6 +10,15 @@
     codeInput.value = code;
     if (window.htmx) { window.htmx.trigger(form, 'submit'); } else { form.submit(); }
   }
+  // GS1 scanners send FNC1 as the group separator, which never reaches
+  // keypress; keep it in the buffer so the server can split the AIs.
+  window.addEventListener('keydown', function(e){
+    if (e.key === 'GroupSeparator' || e.keyCode === 29 || (e.ctrlKey && e.key === ']')) {
+      e.preventDefault();
+      last = Date.now();
+      buf += "\x1d";
+    }
+  });
   window.addEventListener('keypress', function(e){
     var now = Date.now();
     if (now - last > 100) { buf = ""; }